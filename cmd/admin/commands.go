@@ -0,0 +1,470 @@
+package main
+
+import (
+	"auth-service/internal/audit"
+	"auth-service/internal/auth"
+	"auth-service/internal/entities"
+	"auth-service/internal/keys"
+	"auth-service/internal/oauth"
+	"auth-service/internal/passwordpolicy"
+	"auth-service/pkg/cookie"
+	"auth-service/postgres"
+	"bufio"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// source marks audit events of changes made with this tool
+const source = "admin-cli"
+
+// readPassword takes the password from the first line of stdin, or makes one
+// up when none is piped in.
+func readPassword(fromStdin bool) (string, bool, error) {
+	if !fromStdin {
+		bytes := make([]byte, 15)
+
+		if _, err := rand.Read(bytes); err != nil {
+			return "", false, err
+		}
+
+		return base64.RawURLEncoding.EncodeToString(bytes), true, nil
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+
+	if err != nil && line == "" {
+		return "", false, fmt.Errorf("reading password from stdin: %v", err)
+	}
+
+	return strings.TrimRight(line, "\r\n"), false, nil
+}
+
+// hashPassword applies the password policy and hashes the password.
+func hashPassword(password string, username string, email string) (string, error) {
+	if violations := passwordpolicy.Default.Check(password, username, email); len(violations) > 0 {
+		var reasons []string
+
+		for _, reason := range passwordpolicy.Localize(violations, "en") {
+			reasons = append(reasons, reason.Message)
+		}
+
+		return "", fmt.Errorf("password rejected: %s", strings.Join(reasons, "; "))
+	}
+
+	return auth.HashPassword(password)
+}
+
+type CreateUserResult struct {
+	Id       int    `json:"id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	// Password is only set when it was generated
+	Password string `json:"password,omitempty"`
+}
+
+var createUser = command{
+	summary: "create a user, optionally a platform admin",
+	flags: func(fs *flag.FlagSet) func(e *env) error {
+		email := fs.String("email", "", "email address (required)")
+		username := fs.String("username", "", "username (required)")
+		fullname := fs.String("fullname", "", "full name")
+		passwordStdin := fs.Bool("password-stdin", false, "read the password from stdin instead of generating one")
+		admin := fs.Bool("admin", false, "make the user a platform admin")
+		verified := fs.Bool("verified", false, "mark the email address as verified")
+
+		return func(e *env) error {
+			if *email == "" || *username == "" {
+				return fmt.Errorf("--email and --username are required")
+			}
+
+			password, generated, err := readPassword(*passwordStdin)
+
+			if err != nil {
+				return err
+			}
+
+			hash, err := hashPassword(password, *username, *email)
+
+			if err != nil {
+				return err
+			}
+
+			id, err := e.storage.InsertUser(entities.User{
+				Email:    *email,
+				Username: *username,
+				Fullname: *fullname,
+				Password: hash,
+			})
+
+			if err != nil {
+				return err
+			}
+
+			result := CreateUserResult{Id: id, Username: *username, Role: entities.RoleUser}
+
+			if *admin {
+				if err := e.storage.UpdateUserRole(id, entities.RoleAdmin); err != nil {
+					return err
+				}
+
+				result.Role = entities.RoleAdmin
+			}
+
+			if *verified {
+				if err := e.storage.MarkEmailVerified(id, *email); err != nil {
+					return err
+				}
+			}
+
+			if result.Role == entities.RoleAdmin {
+				e.audit.RecordOffline(source, audit.Event{
+					Action:     audit.RoleChanged,
+					TargetType: audit.TargetUser,
+					TargetId:   id,
+					After:      map[string]any{"role": result.Role},
+				})
+			}
+
+			text := fmt.Sprintf("created user %d (%s) with role %s", id, *username, result.Role)
+
+			if generated {
+				result.Password = password
+				text += "\npassword: " + password
+			}
+
+			return e.print(result, text)
+		}
+	},
+}
+
+type ResetPasswordResult struct {
+	UserId int  `json:"userId"`
+	DryRun bool `json:"dryRun,omitempty"`
+	// Password is only set when it was generated
+	Password string `json:"password,omitempty"`
+}
+
+var resetPassword = command{
+	summary:     "set a new password and sign the user out everywhere",
+	destructive: true,
+	flags: func(fs *flag.FlagSet) func(e *env) error {
+		userRef := fs.String("user", "", "user id or username (required)")
+		passwordStdin := fs.Bool("password-stdin", false, "read the password from stdin instead of generating one")
+
+		return func(e *env) error {
+			user, err := e.findUser(*userRef)
+
+			if err != nil {
+				return err
+			}
+
+			result := ResetPasswordResult{UserId: user.Id, DryRun: e.dryRun}
+
+			if e.dryRun {
+				return e.print(result, fmt.Sprintf("%sreset the password of user %d (%s) and sign them out", e.prefix(), user.Id, user.Username))
+			}
+
+			password, generated, err := readPassword(*passwordStdin)
+
+			if err != nil {
+				return err
+			}
+
+			hash, err := hashPassword(password, user.Username, user.Email)
+
+			if err != nil {
+				return err
+			}
+
+			if err := e.storage.UpdatePassword(user.Id, hash, 0); err != nil {
+				return err
+			}
+
+			e.audit.RecordOffline(source, audit.Event{
+				Action:     audit.PasswordReset,
+				TargetType: audit.TargetUser,
+				TargetId:   user.Id,
+			})
+
+			text := fmt.Sprintf("reset the password of user %d (%s)", user.Id, user.Username)
+
+			if generated {
+				result.Password = password
+				text += "\npassword: " + password
+			}
+
+			return e.print(result, text)
+		}
+	},
+}
+
+type CompanyKeyResult struct {
+	CompanyId int    `json:"companyId"`
+	DryRun    bool   `json:"dryRun,omitempty"`
+	Key       string `json:"key,omitempty"`
+}
+
+var regenerateCompanyKey = command{
+	summary:     "replace a company's join key",
+	destructive: true,
+	flags: func(fs *flag.FlagSet) func(e *env) error {
+		companyId := fs.Int("company", 0, "company id (required)")
+
+		return func(e *env) error {
+			company, err := e.storage.GetCompanyById(*companyId)
+
+			if err != nil {
+				return err
+			}
+
+			result := CompanyKeyResult{CompanyId: company.Id, DryRun: e.dryRun}
+
+			if e.dryRun {
+				return e.print(result, fmt.Sprintf("%sreplace the join key of company %d (%s)", e.prefix(), company.Id, company.Name))
+			}
+
+			bytes := make([]byte, 20)
+
+			if _, err := rand.Read(bytes); err != nil {
+				return err
+			}
+
+			result.Key = base64.URLEncoding.EncodeToString(bytes)[:20]
+
+			if err := e.storage.UpdateCompanyKey(company.Id, result.Key); err != nil {
+				return err
+			}
+
+			e.audit.RecordOffline(source, audit.Event{
+				Action:     audit.CompanyKeyRegenerated,
+				TargetType: audit.TargetCompany,
+				TargetId:   company.Id,
+			})
+
+			return e.print(result, fmt.Sprintf("new key of company %d (%s): %s", company.Id, company.Name, result.Key))
+		}
+	},
+}
+
+type SuspensionResult struct {
+	UserId    int    `json:"userId"`
+	Suspended bool   `json:"suspended"`
+	Reason    string `json:"reason,omitempty"`
+	DryRun    bool   `json:"dryRun,omitempty"`
+}
+
+var suspend = command{
+	summary:     "suspend an account and sign it out everywhere",
+	destructive: true,
+	flags: func(fs *flag.FlagSet) func(e *env) error {
+		userRef := fs.String("user", "", "user id or username (required)")
+		reason := fs.String("reason", "", "why the account is suspended (required)")
+
+		return func(e *env) error {
+			if strings.TrimSpace(*reason) == "" {
+				return fmt.Errorf("--reason is required")
+			}
+
+			user, err := e.findUser(*userRef)
+
+			if err != nil {
+				return err
+			}
+
+			result := SuspensionResult{UserId: user.Id, Suspended: true, Reason: *reason, DryRun: e.dryRun}
+			text := fmt.Sprintf("%ssuspend user %d (%s)", e.prefix(), user.Id, user.Username)
+
+			if e.dryRun {
+				return e.print(result, text)
+			}
+
+			if err := e.storage.SuspendUser(user.Id, *reason); err != nil {
+				return err
+			}
+
+			e.audit.RecordOffline(source, audit.Event{
+				Action:     audit.UserSuspended,
+				TargetType: audit.TargetUser,
+				TargetId:   user.Id,
+				Before:     map[string]any{"suspended": user.SuspendedAt != nil, "reason": user.SuspendedReason},
+				After:      map[string]any{"suspended": true, "reason": *reason},
+			})
+
+			return e.print(result, fmt.Sprintf("suspended user %d (%s)", user.Id, user.Username))
+		}
+	},
+}
+
+var unsuspend = command{
+	summary:     "lift the suspension of an account",
+	destructive: true,
+	flags: func(fs *flag.FlagSet) func(e *env) error {
+		userRef := fs.String("user", "", "user id or username (required)")
+
+		return func(e *env) error {
+			user, err := e.findUser(*userRef)
+
+			if err != nil {
+				return err
+			}
+
+			result := SuspensionResult{UserId: user.Id, DryRun: e.dryRun}
+
+			if e.dryRun {
+				return e.print(result, fmt.Sprintf("%sunsuspend user %d (%s)", e.prefix(), user.Id, user.Username))
+			}
+
+			if err := e.storage.UnsuspendUser(user.Id); err != nil {
+				return err
+			}
+
+			e.audit.RecordOffline(source, audit.Event{
+				Action:     audit.UserUnsuspended,
+				TargetType: audit.TargetUser,
+				TargetId:   user.Id,
+				Before:     map[string]any{"suspended": user.SuspendedAt != nil, "reason": user.SuspendedReason},
+				After:      map[string]any{"suspended": false, "reason": ""},
+			})
+
+			return e.print(result, fmt.Sprintf("unsuspended user %d (%s)", user.Id, user.Username))
+		}
+	},
+}
+
+type MigrateResult struct {
+	Applied bool   `json:"applied"`
+	Schema  string `json:"schema,omitempty"`
+}
+
+var migrate = command{
+	summary:     "create missing tables, indexes and triggers and add missing columns",
+	destructive: true,
+	flags: func(fs *flag.FlagSet) func(e *env) error {
+		return func(e *env) error {
+			if e.dryRun {
+				return e.print(MigrateResult{Schema: postgres.Schema}, e.prefix()+"run:\n\n"+postgres.Schema)
+			}
+
+			if err := e.storage.Migrate(postgres.Schema); err != nil {
+				return err
+			}
+
+			return e.print(MigrateResult{Applied: true}, "schema applied")
+		}
+	},
+}
+
+type RotateKeysResult struct {
+	JWTSecretKey            string `json:"jwtSecretKey"`
+	JWTPreviousSecretKey    string `json:"jwtPreviousSecretKey,omitempty"`
+	OAuthSigningKey         string `json:"oauthSigningKey"`
+	OAuthPreviousSigningKey string `json:"oauthPreviousSigningKey,omitempty"`
+	CookieKeys              string `json:"cookieKeys"`
+}
+
+// rotateKeys can't change the running configuration, it prints the values to
+// deploy: new keys to sign with, and the current ones as the previous keys
+// that keep verifying what they signed, so nobody is signed out.
+var rotateKeys = command{
+	summary: "generate new signing keys and keep the current ones as previous keys",
+	flags: func(fs *flag.FlagSet) func(e *env) error {
+		return func(e *env) error {
+			secret := make([]byte, 32)
+
+			if _, err := rand.Read(secret); err != nil {
+				return err
+			}
+
+			cookieKey := make([]byte, cookie.KeySize)
+
+			if _, err := rand.Read(cookieKey); err != nil {
+				return err
+			}
+
+			// the new key goes first to seal new cookies, the current ones
+			// stay to open the cookies they sealed
+			cookieKeys := base64.StdEncoding.EncodeToString(cookieKey)
+
+			if keys.COOKIE_KEYS != "" {
+				if _, err := cookie.ParseKeyring(keys.COOKIE_KEYS); err != nil {
+					return fmt.Errorf("current COOKIE_KEYS: %v", err)
+				}
+
+				cookieKeys += "," + keys.COOKIE_KEYS
+			}
+
+			key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+			if err != nil {
+				return fmt.Errorf("generating signing key: %v", err)
+			}
+
+			der, err := x509.MarshalPKCS8PrivateKey(key)
+
+			if err != nil {
+				return fmt.Errorf("encoding signing key: %v", err)
+			}
+
+			if keys.OAUTH_SIGNING_KEY != "" {
+				if _, err := oauth.NewSigner(keys.OAUTH_SIGNING_KEY); err != nil {
+					return fmt.Errorf("current OAUTH_SIGNING_KEY: %v", err)
+				}
+			}
+
+			result := RotateKeysResult{
+				JWTSecretKey:            base64.StdEncoding.EncodeToString(secret),
+				JWTPreviousSecretKey:    string(keys.JWT_SECRET_KEY),
+				OAuthSigningKey:         string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+				OAuthPreviousSigningKey: keys.OAUTH_SIGNING_KEY,
+				CookieKeys:              cookieKeys,
+			}
+
+			var text strings.Builder
+
+			fmt.Fprintf(&text, "JWT_SECRET_KEY=%s\n", result.JWTSecretKey)
+
+			if result.JWTPreviousSecretKey != "" {
+				fmt.Fprintf(&text, "JWT_PREVIOUS_SECRET_KEY=%s\n", result.JWTPreviousSecretKey)
+			}
+
+			fmt.Fprintf(&text, "\nOAUTH_SIGNING_KEY:\n%s", result.OAuthSigningKey)
+
+			if result.OAuthPreviousSigningKey != "" {
+				fmt.Fprintf(&text, "\nOAUTH_PREVIOUS_SIGNING_KEY:\n%s\n", strings.TrimSpace(result.OAuthPreviousSigningKey))
+			}
+
+			fmt.Fprintf(&text, "\nCOOKIE_KEYS=%s\n\n", result.CookieKeys)
+
+			text.WriteString("Sessions, links and OAuth tokens signed with the previous keys keep verifying.\n" +
+				"Drop JWT_PREVIOUS_SECRET_KEY and OAUTH_PREVIOUS_SIGNING_KEY, and the old entries of COOKIE_KEYS,\n" +
+				"once the tokens and cookies they signed have expired.")
+
+			return e.print(result, text.String())
+		}
+	},
+}
+
+var stats = command{
+	summary: "print counts of users, companies, articles and sessions",
+	flags: func(fs *flag.FlagSet) func(e *env) error {
+		return func(e *env) error {
+			stats, err := e.storage.GetStats()
+
+			if err != nil {
+				return err
+			}
+
+			text := fmt.Sprintf("users:            %d\nadmins:           %d\nsuspended users:  %d\nunverified users: %d\ncompanies:        %d\narticles:         %d\nactive sessions:  %d\naudit events:     %d",
+				stats.Users, stats.Admins, stats.SuspendedUsers, stats.UnverifiedUsers, stats.Companies, stats.Articles, stats.ActiveSessions, stats.AuditEvents)
+
+			return e.print(stats, text)
+		}
+	},
+}
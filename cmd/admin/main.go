@@ -0,0 +1,197 @@
+// Command admin runs operational tasks against the service's database with
+// the same configuration as the server:
+//
+//	admin <command> [flags]
+//
+// Every command takes --json to print its result as JSON, and commands that
+// change or remove data take --dry-run to only show what they would do.
+package main
+
+import (
+	"auth-service/internal/audit"
+	"auth-service/internal/auth"
+	"auth-service/internal/database"
+	"auth-service/internal/entities"
+	"auth-service/internal/keys"
+	"auth-service/internal/passwordpolicy"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+)
+
+type command struct {
+	summary string
+	// destructive commands get --dry-run
+	destructive bool
+	flags       func(fs *flag.FlagSet) func(env *env) error
+}
+
+var commands = map[string]command{
+	"create-user":            createUser,
+	"reset-password":         resetPassword,
+	"regenerate-company-key": regenerateCompanyKey,
+	"suspend":                suspend,
+	"unsuspend":              unsuspend,
+	"migrate":                migrate,
+	"rotate-keys":            rotateKeys,
+	"stats":                  stats,
+}
+
+// env is what a command runs with.
+type env struct {
+	storage *database.PostgresStorage
+	audit   *audit.Recorder
+	out     io.Writer
+	json    bool
+	dryRun  bool
+}
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "admin:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		usage(os.Stderr)
+		return nil
+	}
+
+	cmd, ok := commands[args[0]]
+
+	if !ok {
+		usage(os.Stderr)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+
+	e := &env{out: os.Stdout}
+
+	fs.BoolVar(&e.json, "json", false, "print the result as JSON")
+
+	if cmd.destructive {
+		fs.BoolVar(&e.dryRun, "dry-run", false, "only show what would be done")
+	}
+
+	exec := cmd.flags(fs)
+
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+
+		return err
+	}
+
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+
+	if err := configure(); err != nil {
+		return err
+	}
+
+	storage, err := database.NewPostgresStorage(os.Getenv("POSTGRES_CONN_STR"))
+
+	if err != nil {
+		return err
+	}
+
+	e.storage = storage
+	e.audit = audit.NewRecorder(storage, false)
+
+	return exec(e)
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: admin <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+
+	names := make([]string, 0, len(commands))
+
+	for name := range commands {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-24s %s\n", name, commands[name].summary)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `run "admin <command> -h" for the flags of a command`)
+}
+
+// configure applies the settings the server reads at startup and that
+// commands depend on.
+func configure() error {
+	if keys.PASSWORD_HASH != "" {
+		params, err := auth.ParsePasswordParams(keys.PASSWORD_HASH)
+
+		if err != nil {
+			return fmt.Errorf("invalid PASSWORD_HASH: %v", err)
+		}
+
+		auth.SetPasswordParams(params)
+	}
+
+	if err := passwordpolicy.Configure(); err != nil {
+		return fmt.Errorf("loading password policy: %v", err)
+	}
+
+	return nil
+}
+
+// print writes the result as JSON or as the text lines.
+func (e *env) print(result any, text string) error {
+	if e.json {
+		encoder := json.NewEncoder(e.out)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(result)
+	}
+
+	_, err := fmt.Fprintln(e.out, text)
+
+	return err
+}
+
+// prefix marks the output of dry runs.
+func (e *env) prefix() string {
+	if e.dryRun {
+		return "[dry run] would "
+	}
+
+	return ""
+}
+
+// findUser looks a user up by id or username.
+func (e *env) findUser(ref string) (entities.AdminUser, error) {
+	if ref == "" {
+		return entities.AdminUser{}, fmt.Errorf("--user is required")
+	}
+
+	id, err := strconv.Atoi(ref)
+
+	if err != nil {
+		user, err := e.storage.GetUserByUsername(ref)
+
+		if err != nil {
+			return entities.AdminUser{}, err
+		}
+
+		id = user.Id
+	}
+
+	return e.storage.GetAdminUser(id)
+}
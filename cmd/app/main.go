@@ -1,13 +1,33 @@
 package main
 
 import (
+	"auth-service/internal/accounts"
 	"auth-service/internal/auth"
+	"auth-service/internal/csrf"
 	"auth-service/internal/database"
+	"auth-service/internal/events"
+	"auth-service/internal/exports"
+	"auth-service/internal/keys"
+	"auth-service/internal/mail"
+	"auth-service/internal/oauth"
+	"auth-service/internal/oidc"
+	"auth-service/internal/passwordpolicy"
+	"auth-service/internal/ratelimit"
+	"auth-service/internal/requestid"
+	fileStorage "auth-service/internal/storage"
 	"auth-service/internal/transport"
+	"auth-service/internal/webhooks"
+	"auth-service/pkg/cookie"
+	"context"
 	"fmt"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
 	"net/http"
+
+	"github.com/rs/zerolog/log"
 )
 
 func main() {
@@ -21,33 +41,376 @@ func main() {
 		fmt.Printf("Failed to open database: %v", err)
 	}
 
-	resourse := transport.NewResourse(storage)
+	publishers := []events.Publisher{webhooks.NewPublisher(storage)}
+
+	if keys.KAFKA_BROKERS != "" {
+		topic := keys.KAFKA_TOPIC
+
+		if topic == "" {
+			topic = "auth-service.events"
+		}
+
+		publisher := events.NewKafkaPublisher(strings.Split(keys.KAFKA_BROKERS, ","), topic)
+		defer publisher.Close()
+
+		publishers = append(publishers, publisher)
+	} else {
+		log.Warn().Msg("KAFKA_BROKERS is not set, domain events are only delivered to webhooks")
+	}
+
+	go events.NewRelay(storage, events.MultiPublisher(publishers...)).Run(context.Background())
+	go webhooks.NewDispatcher(storage).Run(context.Background())
+
+	if keys.ACCOUNT_DELETION_GRACE_PERIOD != "" {
+		accounts.GracePeriod, err = time.ParseDuration(keys.ACCOUNT_DELETION_GRACE_PERIOD)
+
+		if err != nil || accounts.GracePeriod < 0 {
+			log.Fatal().Err(err).Msg("Invalid ACCOUNT_DELETION_GRACE_PERIOD")
+		}
+	}
+
+	reaper := accounts.NewReaper(storage, func(url string) error {
+		return fileStorage.DeleteFileFromS3(url, keys.BUCKET_NAME, keys.AWS_REGION, keys.AWS_ACCESS_KEY, keys.AWS_SECRET_KEY)
+	})
+
+	go reaper.Run(context.Background())
+
+	if keys.DATA_EXPORT_TTL != "" {
+		exports.TTL, err = time.ParseDuration(keys.DATA_EXPORT_TTL)
+
+		if err != nil || exports.TTL <= 0 {
+			log.Fatal().Err(err).Msg("Invalid DATA_EXPORT_TTL")
+		}
+	}
+
+	// archives hold everything about a user, so they never go to the public
+	// uploads bucket
+	switch keys.EXPORT_BUCKET_NAME {
+	case "":
+		log.Warn().Msg("EXPORT_BUCKET_NAME is not set, data exports are disabled")
+	case keys.BUCKET_NAME:
+		log.Fatal().Msg("EXPORT_BUCKET_NAME must be a private bucket, not the uploads bucket")
+	default:
+		if err := fileStorage.CheckBucketPrivate(keys.EXPORT_BUCKET_NAME, keys.AWS_REGION, keys.AWS_ACCESS_KEY, keys.AWS_SECRET_KEY); err != nil {
+			log.Fatal().Err(err).Msg("Data export bucket is not private")
+		}
+
+		go exports.NewWorker(storage, exports.S3Files{
+			Bucket:        keys.EXPORT_BUCKET_NAME,
+			UploadsBucket: keys.BUCKET_NAME,
+			Region:        keys.AWS_REGION,
+			AccessKey:     keys.AWS_ACCESS_KEY,
+			SecretKey:     keys.AWS_SECRET_KEY,
+		}).Run(context.Background())
+	}
+
+	var mailer mail.Mailer
+
+	switch keys.MAIL_DRIVER {
+	case "smtp":
+		mailer = mail.NewSMTPMailer(keys.SMTP_ADDR, keys.SMTP_USERNAME, keys.SMTP_PASSWORD, keys.MAIL_FROM)
+	case "file":
+		dir := keys.MAIL_DIR
+
+		if dir == "" {
+			dir = "mail"
+		}
+
+		mailer = mail.NewFileMailer(dir, keys.MAIL_FROM)
+	default:
+		log.Warn().Msg("MAIL_DRIVER is not set, emails are kept in memory and never sent")
+		mailer = mail.NewMemoryMailer()
+	}
+
+	if keys.APP_BASE_URL == "" {
+		keys.APP_BASE_URL = "http://localhost:8080"
+	}
+
+	// emailed links open pages of the frontend, which call back into this API
+	if keys.FRONTEND_URL == "" {
+		keys.FRONTEND_URL = keys.APP_BASE_URL
+	}
+
+	if keys.PASSWORD_HASH != "" {
+		params, err := auth.ParsePasswordParams(keys.PASSWORD_HASH)
+
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid PASSWORD_HASH")
+		}
+
+		auth.SetPasswordParams(params)
+	}
+
+	if err := passwordpolicy.Configure(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to load password policy")
+	}
+
+	var signer *oauth.Signer
+
+	if keys.OAUTH_SIGNING_KEY != "" {
+		signer, err = oauth.NewSigner(keys.OAUTH_SIGNING_KEY)
+	} else {
+		log.Warn().Msg("OAUTH_SIGNING_KEY is not set, tokens issued to OAuth clients won't survive a restart")
+		signer, err = oauth.GenerateSigner()
+	}
+
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load OAuth signing key")
+	}
+
+	// the previous key keeps verifying tokens issued before a rotation
+	if keys.OAUTH_PREVIOUS_SIGNING_KEY != "" {
+		if err := signer.AddPreviousKey(keys.OAUTH_PREVIOUS_SIGNING_KEY); err != nil {
+			log.Fatal().Err(err).Msg("Failed to load previous OAuth signing key")
+		}
+	}
+
+	cookies := cookie.Attributes{
+		HttpOnly:   keys.COOKIE_HTTP_ONLY,
+		Secure:     keys.COOKIE_SECURE,
+		SameSite:   http.SameSiteLaxMode,
+		Domain:     keys.COOKIE_DOMAIN,
+		HostPrefix: keys.COOKIE_HOST_PREFIX,
+	}
+
+	if keys.COOKIE_SAMESITE != "" {
+		cookies.SameSite, err = cookie.ParseSameSite(keys.COOKIE_SAMESITE)
+
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid COOKIE_SAMESITE")
+		}
+	}
+
+	if err := cookies.Validate(); err != nil {
+		log.Fatal().Err(err).Msg("Invalid cookie settings")
+	}
+
+	var cookieKeys *cookie.Keyring
+
+	if keys.COOKIE_KEYS != "" {
+		cookieKeys, err = cookie.ParseKeyring(keys.COOKIE_KEYS)
+	} else {
+		log.Warn().Msg("COOKIE_KEYS is not set, sessions won't survive a restart")
+		cookieKeys, err = cookie.GenerateKeyring()
+	}
+
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load cookie keys")
+	}
+
+	policies, err := ratelimit.LoadPolicies(keys.RATE_LIMITS)
+
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid RATE_LIMITS")
+	}
+
+	var backend ratelimit.Backend = ratelimit.NewMemoryBackend()
+
+	if keys.RATE_LIMIT_BACKEND == "postgres" {
+		backend = ratelimit.NewPostgresBackend(storage)
+	}
+
+	limiter := ratelimit.NewLimiter(backend, policies, keys.TRUST_PROXY)
+
+	resourse := transport.NewResourse(storage, mailer, loadOIDCProviders(), signer, cookies, cookieKeys, limiter, loadWebAuthn(), reaper)
+	authn := auth.NewMiddleware(storage, cookies, cookieKeys)
+
+	// the token endpoint authenticates clients, the consent form carries its own token
+	protector := csrf.NewProtector(cookies, "/oauth/token", "/authorize")
+
+	mux.HandleFunc("GET /csrf", protector.Token)
+
+	mux.HandleFunc("/signin", limiter.Limit("signin", resourse.Login))
+
+	mux.HandleFunc("POST /signin/2fa", limiter.Limit("signin", resourse.LoginTwoFactor))
+	mux.HandleFunc("POST /signin/magic", limiter.Limit("magic-link", resourse.RequestMagicLink))
+	mux.HandleFunc("POST /signin/magic/consume", limiter.Limit("signin", resourse.ConsumeMagicLink))
+	mux.HandleFunc("POST /signin/passkey/options", limiter.Limit("signin", resourse.PasskeyLoginOptions))
+	mux.HandleFunc("POST /signin/passkey", limiter.Limit("signin", resourse.PasskeyLogin))
+
+	mux.HandleFunc("GET /oidc/{provider}/login", resourse.OIDCLogin)
+	mux.HandleFunc("GET /oidc/{provider}/callback", resourse.OIDCCallback)
 
-	mux.HandleFunc("/signin", resourse.Login)
+	mux.HandleFunc("GET /.well-known/openid-configuration", resourse.OpenIdConfiguration)
+	mux.HandleFunc("GET /oauth/jwks", resourse.OAuthJWKS)
+	mux.HandleFunc("GET /authorize", authn.OptionalAuth(resourse.Authorize))
+	mux.HandleFunc("POST /authorize", authn.OptionalAuth(resourse.AuthorizeDecision))
+	mux.HandleFunc("POST /oauth/token", resourse.Token)
+	mux.HandleFunc("GET /oauth/userinfo", resourse.UserInfo)
 
-	mux.HandleFunc("GET /users", auth.CheckAuth(resourse.GetUsers))
-	mux.HandleFunc("GET /users/{id}", auth.CheckAuth(resourse.GetUserById))
-	mux.HandleFunc("/users", resourse.CreateUser)
-	mux.HandleFunc("/users/{id}", auth.CheckAuth(resourse.UpdateUser))
-	mux.HandleFunc("DELETE /users/{id}", auth.CheckAuth(resourse.DeleteUser))
-	mux.HandleFunc("/users/{id}/photo", auth.CheckAuth(resourse.UpdateUserPhoto))
+	mux.HandleFunc("POST /me/2fa/totp", authn.CheckAuth(resourse.EnrollTOTP))
+	mux.HandleFunc("POST /me/2fa/totp/confirm", authn.CheckAuth(resourse.ConfirmTOTP))
+	mux.HandleFunc("DELETE /me/2fa/totp", authn.CheckAuth(limiter.Limit("password-change", resourse.DisableTOTP)))
+	mux.HandleFunc("POST /me/2fa/recovery-codes", authn.CheckAuth(limiter.Limit("password-change", resourse.RegenerateRecoveryCodes)))
 
-	mux.HandleFunc("/articles", auth.CheckAuth(resourse.GetArticles))
-	mux.HandleFunc("GET /articles/{id}", resourse.GetArticleById)
-	mux.HandleFunc("POST /articles", resourse.CreateArticle)
-	mux.HandleFunc("PUT /articles/{id}", auth.CheckAuth(resourse.UpdateArticle))
-	mux.HandleFunc("DELETE /articles/{id}", auth.CheckAuth(resourse.DeleteArticle))
-	mux.HandleFunc("GET /users/{id}/articles", resourse.GetArticlesByAuthorId)
-	mux.HandleFunc("GET /companies/{id}/articles", resourse.GetArticlesByCompanyId)
+	mux.HandleFunc("POST /me/tokens", authn.CheckAuth(resourse.CreatePersonalAccessToken))
+	mux.HandleFunc("GET /me/tokens", authn.CheckAuth(resourse.GetPersonalAccessTokens))
+	mux.HandleFunc("DELETE /me/tokens/{id}", authn.CheckAuth(resourse.DeletePersonalAccessToken))
+
+	mux.HandleFunc("POST /me/passkeys/options", authn.CheckAuth(resourse.PasskeyRegistrationOptions))
+	mux.HandleFunc("POST /me/passkeys", authn.CheckAuth(resourse.RegisterPasskey))
+	mux.HandleFunc("GET /me/passkeys", authn.CheckAuth(resourse.GetPasskeys))
+	mux.HandleFunc("PATCH /me/passkeys/{id}", authn.CheckAuth(resourse.RenamePasskey))
+	mux.HandleFunc("DELETE /me/passkeys/{id}", authn.CheckAuth(resourse.DeletePasskey))
+
+	if keys.EXPORT_BUCKET_NAME != "" {
+		mux.HandleFunc("GET /me/export", authn.CheckAuth(resourse.GetDataExport))
+		mux.HandleFunc("POST /me/export", authn.CheckAuth(limiter.Limit("data-export", resourse.RequestDataExport)))
+	}
+
+	mux.HandleFunc("GET /me/sessions", authn.CheckAuth(resourse.GetSessions))
+	mux.HandleFunc("DELETE /me/sessions", authn.CheckAuth(resourse.DeleteOtherSessions))
+	mux.HandleFunc("DELETE /me/sessions/{id}", authn.CheckAuth(resourse.DeleteSession))
+
+	mux.HandleFunc("GET /verify-email", resourse.VerifyEmail)
+	mux.HandleFunc("POST /verify-email/resend", authn.CheckAuth(limiter.Limit("verify-email-resend", resourse.ResendVerificationEmail)))
+
+	mux.HandleFunc("POST /password/forgot", limiter.Limit("password-forgot", resourse.ForgotPassword))
+	mux.HandleFunc("POST /password/reset", resourse.ResetPassword)
+	mux.HandleFunc("PUT /me/password", authn.CheckAuth(limiter.Limit("password-change", resourse.ChangePassword)))
+
+	mux.HandleFunc("GET /users", authn.CheckAuth(resourse.GetUsers))
+	mux.HandleFunc("GET /users/{id}", authn.CheckAuth(resourse.GetUserById))
+	mux.HandleFunc("/users", limiter.Limit("signup", resourse.CreateUser))
+	mux.HandleFunc("/users/{id}", authn.CheckAuth(resourse.UpdateUser))
+	mux.HandleFunc("DELETE /users/{id}", authn.CheckAuth(resourse.DeleteUser))
+	mux.HandleFunc("GET /users/{id}/deletion", authn.CheckAuth(resourse.GetAccountDeletion))
+	mux.HandleFunc("DELETE /users/{id}/deletion", authn.CheckAuth(resourse.CancelAccountDeletion))
+	mux.HandleFunc("/users/{id}/photo", authn.CheckAuth(resourse.UpdateUserPhoto))
+
+	mux.HandleFunc("/articles", authn.RequireScope(auth.ScopeReadArticles, resourse.GetArticles))
+	mux.HandleFunc("GET /articles/{id}", authn.OptionalAuth(resourse.GetArticleById))
+	mux.HandleFunc("POST /articles", authn.RequireScope(auth.ScopeWriteArticles, authn.RequireVerifiedEmail(resourse.CreateArticle)))
+	mux.HandleFunc("PUT /articles/{id}", authn.RequireScope(auth.ScopeWriteArticles, resourse.UpdateArticle))
+	mux.HandleFunc("DELETE /articles/{id}", authn.RequireScope(auth.ScopeWriteArticles, resourse.DeleteArticle))
+	mux.HandleFunc("GET /users/{id}/articles", authn.OptionalAuth(resourse.GetArticlesByAuthorId))
+	mux.HandleFunc("GET /companies/{id}/articles", authn.OptionalAuth(resourse.GetArticlesByCompanyId))
+
+	mux.HandleFunc("GET /tags", resourse.GetTags)
+	mux.HandleFunc("GET /tags/{slug}/articles", authn.OptionalAuth(resourse.GetArticlesByTag))
 
 	mux.HandleFunc("GET /companies", resourse.GetCompanies)
 	mux.HandleFunc("GET /companies/{id}", resourse.GetCompanyById)
-	mux.HandleFunc("/companies", resourse.CreateCompany)
-	mux.HandleFunc("PUT /companies/{id}", auth.CheckAuth(resourse.UpdateCompany))
-	mux.HandleFunc("DELETE /companies/{id}", auth.CheckAuth(resourse.DeleteCompany))
-	mux.HandleFunc("/join-company", auth.CheckAuth(resourse.JoinCompany))
+	mux.HandleFunc("/companies", authn.RequireScope(auth.ScopeManageCompany, authn.RequireVerifiedEmail(resourse.CreateCompany)))
+	mux.HandleFunc("PUT /companies/{id}", authn.RequireScope(auth.ScopeManageCompany, resourse.UpdateCompany))
+	mux.HandleFunc("DELETE /companies/{id}", authn.RequireScope(auth.ScopeManageCompany, resourse.DeleteCompany))
+	mux.HandleFunc("/join-company", authn.CheckAuth(limiter.Limit("join-company", resourse.JoinCompany)))
+	mux.HandleFunc("PUT /companies/{id}/members/{userId}/role", authn.RequireScope(auth.ScopeManageCompany, resourse.UpdateMemberRole))
+	mux.HandleFunc("POST /companies/{id}/key", authn.RequireScope(auth.ScopeManageCompany, resourse.RegenerateCompanyKey))
+
+	mux.HandleFunc("POST /companies/{id}/webhooks", authn.RequireScope(auth.ScopeManageCompany, resourse.CreateWebhook))
+	mux.HandleFunc("GET /companies/{id}/webhooks", authn.RequireScope(auth.ScopeManageCompany, resourse.GetWebhooks))
+	mux.HandleFunc("DELETE /companies/{id}/webhooks/{webhookId}", authn.RequireScope(auth.ScopeManageCompany, resourse.DeleteWebhook))
+	mux.HandleFunc("GET /companies/{id}/webhooks/{webhookId}/deliveries", authn.RequireScope(auth.ScopeManageCompany, resourse.GetWebhookDeliveries))
+	mux.HandleFunc("POST /companies/{id}/webhooks/{webhookId}/deliveries/{deliveryId}/redeliver", authn.RequireScope(auth.ScopeManageCompany, resourse.RedeliverWebhook))
+
+	mux.HandleFunc("POST /users/{id}/follow", authn.CheckAuth(resourse.FollowUser))
+	mux.HandleFunc("DELETE /users/{id}/follow", authn.CheckAuth(resourse.UnfollowUser))
+	mux.HandleFunc("POST /companies/{id}/follow", authn.CheckAuth(resourse.FollowCompany))
+	mux.HandleFunc("DELETE /companies/{id}/follow", authn.CheckAuth(resourse.UnfollowCompany))
+	mux.HandleFunc("GET /feed", authn.RequireScope(auth.ScopeReadArticles, resourse.GetFeed))
+
+	mux.HandleFunc("PUT /articles/{id}/bookmark", authn.RequireScope(auth.ScopeWriteArticles, resourse.AddBookmark))
+	mux.HandleFunc("DELETE /articles/{id}/bookmark", authn.RequireScope(auth.ScopeWriteArticles, resourse.RemoveBookmark))
+	mux.HandleFunc("GET /me/bookmarks", authn.RequireScope(auth.ScopeReadArticles, resourse.GetBookmarks))
+
+	mux.HandleFunc("POST /reading-lists", authn.RequireScope(auth.ScopeWriteArticles, resourse.CreateReadingList))
+	mux.HandleFunc("GET /users/{id}/reading-lists", authn.OptionalAuth(resourse.GetReadingListsByUserId))
+	mux.HandleFunc("GET /reading-lists/{id}", authn.OptionalAuth(resourse.GetReadingListById))
+	mux.HandleFunc("PUT /reading-lists/{id}", authn.RequireScope(auth.ScopeWriteArticles, resourse.UpdateReadingList))
+	mux.HandleFunc("DELETE /reading-lists/{id}", authn.RequireScope(auth.ScopeWriteArticles, resourse.DeleteReadingList))
+	mux.HandleFunc("POST /reading-lists/{id}/articles", authn.RequireScope(auth.ScopeWriteArticles, resourse.AddReadingListArticle))
+	mux.HandleFunc("PUT /reading-lists/{id}/articles", authn.RequireScope(auth.ScopeWriteArticles, resourse.ReorderReadingList))
+	mux.HandleFunc("DELETE /reading-lists/{id}/articles/{articleId}", authn.RequireScope(auth.ScopeWriteArticles, resourse.RemoveReadingListArticle))
+
+	mux.HandleFunc("POST /admin/oauth/clients", authn.RequireAdmin(resourse.CreateOAuthClient))
+	mux.HandleFunc("GET /admin/oauth/clients", authn.RequireAdmin(resourse.GetOAuthClients))
+	mux.HandleFunc("DELETE /admin/oauth/clients/{id}", authn.RequireAdmin(resourse.DeleteOAuthClient))
+	mux.HandleFunc("POST /admin/users/{id}/unlock", authn.RequireAdmin(resourse.UnlockAccount))
+	mux.HandleFunc("GET /admin/users", authn.RequireAdmin(resourse.SearchUsers))
+	mux.HandleFunc("GET /admin/users/{id}", authn.RequireAdmin(resourse.GetAdminUser))
+	mux.HandleFunc("PUT /admin/users/{id}/role", authn.RequireAdmin(resourse.UpdateUserRole))
+	mux.HandleFunc("POST /admin/users/{id}/suspension", authn.RequireAdmin(resourse.SuspendUser))
+	mux.HandleFunc("DELETE /admin/users/{id}/suspension", authn.RequireAdmin(resourse.UnsuspendUser))
+	mux.HandleFunc("POST /admin/users/{id}/password-reset", authn.RequireAdmin(resourse.ForcePasswordReset))
+	mux.HandleFunc("POST /admin/users/{id}/articles/reassign", authn.RequireAdmin(resourse.ReassignArticles))
+	mux.HandleFunc("DELETE /admin/companies/{id}", authn.RequireAdmin(resourse.AdminDeleteCompany))
+	mux.HandleFunc("POST /admin/companies/{id}/merge", authn.RequireAdmin(resourse.MergeCompany))
+	mux.HandleFunc("GET /admin/audit-events", authn.RequireAdmin(resourse.GetAuditEvents))
+	mux.HandleFunc("GET /admin/audit-events/export", authn.RequireAdmin(resourse.ExportAuditEvents))
+
+	http.ListenAndServe(":8080", requestid.Middleware(protector.Protect(mux)))
+}
+
+// loadOIDCProviders discovers the providers listed in OIDC_PROVIDERS, e.g.
+// "google". Each one is configured with OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID
+// and OIDC_<NAME>_CLIENT_SECRET. Providers that fail discovery are left out.
+func loadOIDCProviders() map[string]*oidc.Provider {
+	providers := make(map[string]*oidc.Provider)
+
+	if keys.OIDC_PROVIDERS == "" {
+		return providers
+	}
+
+	for _, name := range strings.Split(keys.OIDC_PROVIDERS, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+
+		provider, err := oidc.Discover(ctx, oidc.Config{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  keys.APP_BASE_URL + "/oidc/" + name + "/callback",
+		})
+
+		cancel()
+
+		if err != nil {
+			log.Error().Err(err).Str("provider", name).Msg("Failed to set up OIDC provider")
+			continue
+		}
+
+		providers[name] = provider
+	}
+
+	return providers
+}
+
+// loadWebAuthn sets up passkeys for the site at APP_BASE_URL, unless
+// WEBAUTHN_RP_ID and WEBAUTHN_ORIGINS (comma separated) say otherwise.
+func loadWebAuthn() *auth.WebAuthn {
+	rpId := keys.WEBAUTHN_RP_ID
+
+	if rpId == "" {
+		base, err := url.Parse(keys.APP_BASE_URL)
+
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid APP_BASE_URL")
+		}
+
+		rpId = base.Hostname()
+	}
+
+	rpName := keys.WEBAUTHN_RP_NAME
+
+	if rpName == "" {
+		rpName = "Auth Service"
+	}
+
+	origins := []string{strings.TrimSuffix(keys.APP_BASE_URL, "/")}
+
+	if keys.WEBAUTHN_ORIGINS != "" {
+		origins = nil
+
+		for _, origin := range strings.Split(keys.WEBAUTHN_ORIGINS, ",") {
+			origins = append(origins, strings.TrimSpace(origin))
+		}
+	}
 
-	http.ListenAndServe(":8080", mux)
+	return auth.NewWebAuthn(rpId, rpName, origins)
 }
 
 type User struct {
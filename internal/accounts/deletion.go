@@ -0,0 +1,125 @@
+// Package accounts carries out account deletions once their grace period is
+// over, including the files the account left in object storage.
+package accounts
+
+import (
+	"auth-service/internal/audit"
+	"auth-service/internal/database"
+	"auth-service/internal/entities"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// GracePeriod is how long a deletion can be cancelled before it happens.
+var GracePeriod = 30 * 24 * time.Hour
+
+const batchSize = 20
+
+type Store interface {
+	audit.Store
+	GetDueAccountDeletions(limit int) ([]entities.AccountDeletion, error)
+	DeleteAccount(userId int) ([]string, error)
+	IsFileReferenced(url string) (bool, error)
+}
+
+// FileRemover deletes an uploaded file by its URL.
+type FileRemover func(url string) error
+
+type Reaper struct {
+	store      Store
+	removeFile FileRemover
+	audit      *audit.Recorder
+	interval   time.Duration
+}
+
+func NewReaper(store Store, removeFile FileRemover) *Reaper {
+	return &Reaper{
+		store:      store,
+		removeFile: removeFile,
+		audit:      audit.NewRecorder(store, false),
+		interval:   time.Minute,
+	}
+}
+
+func (r *Reaper) Run(ctx context.Context) {
+	for {
+		deletions, err := r.store.GetDueAccountDeletions(batchSize)
+
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to get due account deletions")
+		}
+
+		deleted := 0
+
+		for _, deletion := range deletions {
+			err := r.Delete(deletion)
+
+			if err == nil {
+				deleted++
+			} else if !errors.Is(err, database.ErrDeletionNotDue) {
+				log.Error().Err(err).Int("user", deletion.UserId).Msg("Failed to delete account")
+			}
+		}
+
+		// a batch that failed as a whole would come back unchanged, so only
+		// progress earns another round without waiting
+		if len(deletions) == batchSize && deleted > 0 && ctx.Err() == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.interval):
+		}
+	}
+}
+
+// Delete carries out a due deletion and removes the files nothing else
+// points at. A file that can't be removed is logged and left behind, the
+// account is gone either way.
+func (r *Reaper) Delete(deletion entities.AccountDeletion) error {
+	files, err := r.store.DeleteAccount(deletion.UserId)
+
+	if err != nil {
+		return err
+	}
+
+	r.audit.RecordOffline("account-deletion", audit.Event{
+		ActorId:    derefId(deletion.RequestedBy),
+		Action:     audit.UserDeleted,
+		TargetType: audit.TargetUser,
+		TargetId:   deletion.UserId,
+		After:      map[string]any{"strategy": deletion.Strategy, "reassignTo": deletion.ReassignTo},
+	})
+
+	for _, file := range files {
+		referenced, err := r.store.IsFileReferenced(file)
+
+		if err != nil {
+			log.Error().Err(err).Str("file", file).Msg("Failed to check file references")
+			continue
+		}
+
+		if referenced {
+			continue
+		}
+
+		if err := r.removeFile(file); err != nil {
+			log.Error().Err(err).Str("file", file).Msg("Failed to remove file of deleted account")
+		}
+	}
+
+	return nil
+}
+
+func derefId(id *int) int {
+	if id == nil {
+		return 0
+	}
+
+	return *id
+}
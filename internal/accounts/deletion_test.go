@@ -0,0 +1,67 @@
+package accounts
+
+import (
+	"auth-service/internal/entities"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingStore has a full batch of due deletions that all fail.
+type failingStore struct {
+	fetches atomic.Int32
+}
+
+func (s *failingStore) InsertAuditEvent(event entities.AuditEvent) error {
+	return nil
+}
+
+func (s *failingStore) GetDueAccountDeletions(limit int) ([]entities.AccountDeletion, error) {
+	s.fetches.Add(1)
+
+	deletions := make([]entities.AccountDeletion, limit)
+
+	for i := range deletions {
+		deletions[i].UserId = i + 1
+	}
+
+	return deletions, nil
+}
+
+func (s *failingStore) DeleteAccount(userId int) ([]string, error) {
+	return nil, errors.New("foreign key violation")
+}
+
+func (s *failingStore) IsFileReferenced(url string) (bool, error) {
+	return false, nil
+}
+
+func TestReaperWaitsAfterAFailedBatch(t *testing.T) {
+	store := &failingStore{}
+
+	reaper := NewReaper(store, func(string) error { return nil })
+	reaper.interval = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		reaper.Run(ctx)
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("reaper did not stop")
+	}
+
+	if got := store.fetches.Load(); got != 1 {
+		t.Fatalf("fetched the failing batch %d times, want once before waiting", got)
+	}
+}
@@ -0,0 +1,187 @@
+// Package audit records security relevant and administrative actions in the
+// append-only audit_events table: who did what to which object, what changed,
+// and from where.
+package audit
+
+import (
+	"auth-service/internal/auth"
+	"auth-service/internal/entities"
+	"auth-service/internal/requestid"
+	"auth-service/pkg/realip"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+)
+
+// actions
+const (
+	Login                 = "user.login"
+	LoginFailed           = "user.login_failed"
+	PasswordChanged       = "user.password_changed"
+	PasswordReset         = "user.password_reset"
+	TwoFactorDisabled     = "user.two_factor_disabled"
+	UserDeleted           = "user.deleted"
+	DeletionScheduled     = "user.deletion_scheduled"
+	DeletionCancelled     = "user.deletion_cancelled"
+	DataExportRequested   = "user.data_export_requested"
+	AccountUnlocked       = "user.unlocked"
+	UserSuspended         = "user.suspended"
+	UserUnsuspended       = "user.unsuspended"
+	PasswordResetForced   = "user.password_reset_forced"
+	RoleChanged           = "user.role_changed"
+	ArticlesReassigned    = "user.articles_reassigned"
+	CompanyMerged         = "company.merged"
+	CompanyDeleted        = "company.deleted"
+	CompanyJoined         = "company.joined"
+	CompanyKeyRegenerated = "company.key_regenerated"
+	MemberRoleChanged     = "company.member_role_changed"
+	OAuthClientCreated    = "oauth_client.created"
+	OAuthClientDeleted    = "oauth_client.deleted"
+)
+
+// target types
+const (
+	TargetUser        = "user"
+	TargetCompany     = "company"
+	TargetOAuthClient = "oauth_client"
+)
+
+type Store interface {
+	InsertAuditEvent(event entities.AuditEvent) error
+}
+
+type Recorder struct {
+	store      Store
+	trustProxy bool
+}
+
+func NewRecorder(store Store, trustProxy bool) *Recorder {
+	return &Recorder{store: store, trustProxy: trustProxy}
+}
+
+// Event describes an action. Before and After are the target's state around
+// the change, only the fields that differ end up in the log.
+type Event struct {
+	// ActorId defaults to the authenticated caller
+	ActorId    int
+	Action     string
+	TargetType string
+	TargetId   any
+	Before     any
+	After      any
+}
+
+// Record writes the event with the request's caller, IP and request id. The
+// action already happened, so a failure to record it is logged rather than
+// failing the request.
+func (rec *Recorder) Record(r *http.Request, event Event) {
+	if event.ActorId == 0 {
+		event.ActorId, _ = auth.UserIdFromContext(r.Context())
+	}
+
+	rec.insert(event, realip.FromRequest(r, rec.trustProxy), requestid.FromContext(r.Context()))
+}
+
+// RecordOffline writes an event that didn't come in through the API, such
+// as a change made with the admin tool. The source stands in for the request id.
+func (rec *Recorder) RecordOffline(source string, event Event) {
+	rec.insert(event, "", source)
+}
+
+func (rec *Recorder) insert(event Event, ip string, requestId string) {
+	before, after := Diff(event.Before, event.After)
+
+	entry := entities.AuditEvent{
+		Action:     event.Action,
+		TargetType: event.TargetType,
+		TargetId:   targetId(event.TargetId),
+		Before:     before,
+		After:      after,
+		Ip:         ip,
+		RequestId:  requestId,
+	}
+
+	if event.ActorId != 0 {
+		entry.ActorId = &event.ActorId
+	}
+
+	if err := rec.store.InsertAuditEvent(entry); err != nil {
+		log.Error().Err(err).Str("action", event.Action).Str("requestId", requestId).Msg("Failed to record audit event")
+	}
+}
+
+func targetId(id any) string {
+	switch id := id.(type) {
+	case nil:
+		return ""
+	case string:
+		return id
+	case int:
+		return strconv.Itoa(id)
+	case int64:
+		return strconv.FormatInt(id, 10)
+	}
+
+	encoded, _ := json.Marshal(id)
+
+	return string(encoded)
+}
+
+// Diff reduces two states to the fields that differ between them. Either
+// side may be nil, for objects that were created or deleted; the other side
+// is kept whole then.
+func Diff(before any, after any) (json.RawMessage, json.RawMessage) {
+	beforeFields, beforeOk := fields(before)
+	afterFields, afterOk := fields(after)
+
+	if !beforeOk || !afterOk {
+		return marshal(before), marshal(after)
+	}
+
+	for name, value := range beforeFields {
+		if other, ok := afterFields[name]; ok && reflect.DeepEqual(value, other) {
+			delete(beforeFields, name)
+			delete(afterFields, name)
+		}
+	}
+
+	return marshal(beforeFields), marshal(afterFields)
+}
+
+// fields turns a struct or map into its JSON fields.
+func fields(value any) (map[string]any, bool) {
+	if value == nil {
+		return nil, false
+	}
+
+	encoded, err := json.Marshal(value)
+
+	if err != nil {
+		return nil, false
+	}
+
+	var decoded map[string]any
+
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return nil, false
+	}
+
+	return decoded, true
+}
+
+func marshal(value any) json.RawMessage {
+	if value == nil || reflect.ValueOf(value).Kind() == reflect.Map && reflect.ValueOf(value).Len() == 0 {
+		return nil
+	}
+
+	encoded, err := json.Marshal(value)
+
+	if err != nil {
+		return nil
+	}
+
+	return encoded
+}
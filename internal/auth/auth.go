@@ -1,13 +1,114 @@
 package auth
 
 import (
+	"auth-service/internal/entities"
 	"auth-service/pkg/cookie"
+	"fmt"
 	"net/http"
+	"slices"
+	"strings"
 
 	"github.com/rs/zerolog/log"
 )
 
-func CheckAuth(next http.HandlerFunc) http.HandlerFunc {
+type Store interface {
+	GetUserRole(id int) (string, error)
+	IsEmailVerified(id int) (bool, error)
+	TouchSession(id int) (userId int, err error)
+	UsePersonalAccessToken(tokenHash string) (userId int, username string, scopes []string, err error)
+}
+
+// Middleware holds the checks that need to look the caller up in storage.
+type Middleware struct {
+	store      Store
+	cookies    cookie.Attributes
+	cookieKeys *cookie.Keyring
+	sessions   *sessionCache
+}
+
+func NewMiddleware(store Store, cookies cookie.Attributes, cookieKeys *cookie.Keyring) *Middleware {
+	return &Middleware{
+		store:      store,
+		cookies:    cookies,
+		cookieKeys: cookieKeys,
+		sessions:   newSessionCache(sessionCacheTTL, sessionCacheSize),
+	}
+}
+
+// authenticate verifies the access token cookie and checks its session
+// hasn't been signed out. A personal access token in the Authorization
+// header is used instead of the cookie when present.
+func (m *Middleware) authenticate(r *http.Request) (*Claims, error) {
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return m.authenticatePersonalToken(bearer)
+	}
+
+	token, err := cookie.ReadEncrypted(r, m.cookies.Name(cookie.AccessTokenName), m.cookieKeys)
+
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := VerifyToken(token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.checkSession(claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// checkSession looks the token's session up, from the cache when it was
+// seen recently.
+func (m *Middleware) checkSession(claims *Claims) error {
+	// tokens issued before sessions were recorded
+	if claims.SessionId == 0 {
+		return fmt.Errorf("token has no session")
+	}
+
+	userId, ok := m.sessions.get(claims.SessionId)
+
+	if !ok {
+		var err error
+
+		userId, err = m.store.TouchSession(claims.SessionId)
+
+		if err != nil {
+			return err
+		}
+
+		m.sessions.put(claims.SessionId, userId)
+	}
+
+	if userId != claims.UserId {
+		return fmt.Errorf("session belongs to another user")
+	}
+
+	return nil
+}
+
+func (m *Middleware) authenticatePersonalToken(token string) (*Claims, error) {
+	if !strings.HasPrefix(token, PersonalAccessTokenPrefix) {
+		return nil, fmt.Errorf("unsupported bearer token")
+	}
+
+	userId, username, scopes, err := m.store.UsePersonalAccessToken(HashOpaqueToken(token))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Claims{UserId: userId, Username: username, Scopes: scopes}, nil
+}
+
+// checkAuth authenticates the request. Personal access tokens only get
+// through when the route asks for a scope they carry, so account settings
+// stay out of their reach.
+func (m *Middleware) checkAuth(scope string, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		if r.Method == http.MethodOptions {
@@ -15,17 +116,88 @@ func CheckAuth(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		token, err := cookie.Read(r, "accessToken")
+		claims, err := m.authenticate(r)
 
 		if err != nil {
-			log.Error().Err(err).Msg("Error encrypting token")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			log.Error().Err(err).Msg("Failed to verify token")
+			return
+		}
+
+		if claims.Scopes != nil && (scope == "" || !slices.Contains(claims.Scopes, scope)) {
+			http.Error(w, "Token is missing the required scope", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithClaims(r.Context(), claims)))
+	}
+}
+
+func (m *Middleware) CheckAuth(next http.HandlerFunc) http.HandlerFunc {
+	return m.checkAuth("", next)
+}
+
+// RequireScope is CheckAuth for routes personal access tokens may use.
+// Cookie sessions aren't limited by scopes.
+func (m *Middleware) RequireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return m.checkAuth(scope, next)
+}
+
+// OptionalAuth attaches the caller's claims to the request when a valid
+// token is present, but lets anonymous requests through as well. Personal
+// access tokens count when they may read articles.
+func (m *Middleware) OptionalAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if claims, err := m.authenticate(r); err == nil {
+			if claims.Scopes == nil || slices.Contains(claims.Scopes, ScopeReadArticles) {
+				r = r.WithContext(WithClaims(r.Context(), claims))
+			}
 		}
 
-		err = VerifyToken(token)
+		next.ServeHTTP(w, r)
+	}
+}
+
+// RequireAdmin only lets platform admins through. The role is read on every
+// request, so revoking it takes effect immediately.
+func (m *Middleware) RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return m.CheckAuth(func(w http.ResponseWriter, r *http.Request) {
+		userId, _ := UserIdFromContext(r.Context())
+
+		role, err := m.store.GetUserRole(userId)
 
 		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			log.Error().Err(err).Msg("Failed to verify token")
+			log.Error().Err(err).Msg("Failed to get user role")
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		if role != entities.RoleAdmin {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireVerifiedEmail only lets through users who confirmed their email
+// address. It needs the caller's claims, so it must run inside CheckAuth or
+// RequireScope.
+func (m *Middleware) RequireVerifiedEmail(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, _ := UserIdFromContext(r.Context())
+
+		verified, err := m.store.IsEmailVerified(userId)
+
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to check email verification")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if !verified {
+			http.Error(w, "Email address is not verified", http.StatusForbidden)
 			return
 		}
 
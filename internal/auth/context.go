@@ -0,0 +1,25 @@
+package auth
+
+import "context"
+
+type claimsContextKey struct{}
+
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*Claims)
+	return claims, ok
+}
+
+// UserIdFromContext returns the id of the authenticated caller, if any.
+func UserIdFromContext(ctx context.Context) (int, bool) {
+	claims, ok := ClaimsFromContext(ctx)
+
+	if !ok {
+		return 0, false
+	}
+
+	return claims.UserId, true
+}
@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// NewOpaqueToken returns a random token for the user and the hash to store in
+// its place, so a leaked table can't be replayed.
+func NewOpaqueToken() (token string, hash string, err error) {
+	bytes := make([]byte, 32)
+
+	_, err = rand.Read(bytes)
+
+	if err != nil {
+		return "", "", fmt.Errorf("reading random bytes: %v", err)
+	}
+
+	token = base64.RawURLEncoding.EncodeToString(bytes)
+
+	return token, HashOpaqueToken(token), nil
+}
+
+// HashOpaqueToken hashes a token for lookup. The tokens are random and long,
+// so a fast unsalted hash is enough.
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,256 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+// bcrypt only looks at the first 72 bytes, longer passwords are refused
+// instead of being cut short without anyone noticing
+const bcryptMaxPasswordLength = 72
+
+var ErrPasswordTooLong = errors.New("password is too long")
+
+// PasswordParams pick the algorithm and cost of new password hashes.
+type PasswordParams struct {
+	Algorithm string
+	// argon2id memory in KiB, iterations and lanes
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+	// bcrypt cost
+	Cost int
+}
+
+// DefaultPasswordParams follow the OWASP recommendation for argon2id.
+var DefaultPasswordParams = PasswordParams{
+	Algorithm: AlgorithmArgon2id,
+	Memory:    19 * 1024,
+	Time:      2,
+	Threads:   1,
+}
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+var passwordParams = DefaultPasswordParams
+
+// SetPasswordParams changes the parameters new hashes are made with. Stored
+// hashes made with others are upgraded as their users sign in.
+func SetPasswordParams(params PasswordParams) {
+	passwordParams = params
+}
+
+// ParsePasswordParams reads "argon2id,m=19456,t=2,p=1" or "bcrypt,cost=12".
+// Parameters left out keep their defaults.
+func ParsePasswordParams(config string) (PasswordParams, error) {
+	fields := strings.Split(config, ",")
+
+	var params PasswordParams
+
+	switch strings.TrimSpace(fields[0]) {
+	case AlgorithmArgon2id:
+		params = DefaultPasswordParams
+	case AlgorithmBcrypt:
+		params = PasswordParams{Algorithm: AlgorithmBcrypt, Cost: bcrypt.DefaultCost}
+	default:
+		return PasswordParams{}, fmt.Errorf("unknown password hash algorithm %q", fields[0])
+	}
+
+	for _, field := range fields[1:] {
+		name, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+
+		if !ok {
+			return PasswordParams{}, fmt.Errorf("invalid password hash parameter %q", field)
+		}
+
+		number, err := strconv.ParseUint(value, 10, 32)
+
+		if err != nil || number == 0 {
+			return PasswordParams{}, fmt.Errorf("invalid password hash parameter %q", field)
+		}
+
+		switch {
+		case params.Algorithm == AlgorithmArgon2id && name == "m":
+			params.Memory = uint32(number)
+		case params.Algorithm == AlgorithmArgon2id && name == "t":
+			params.Time = uint32(number)
+		case params.Algorithm == AlgorithmArgon2id && name == "p" && number <= 255:
+			params.Threads = uint8(number)
+		case params.Algorithm == AlgorithmBcrypt && name == "cost" && number >= uint64(bcrypt.MinCost) && number <= uint64(bcrypt.MaxCost):
+			params.Cost = int(number)
+		default:
+			return PasswordParams{}, fmt.Errorf("invalid password hash parameter %q", field)
+		}
+	}
+
+	return params, nil
+}
+
+// HashPassword hashes the password with the current parameters. Argon2id
+// hashes are stored in the PHC string format, bcrypt in its own.
+func HashPassword(password string) (string, error) {
+	params := passwordParams
+
+	if params.Algorithm == AlgorithmBcrypt {
+		if len(password) > bcryptMaxPasswordLength {
+			return "", ErrPasswordTooLong
+		}
+
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), params.Cost)
+
+		if err != nil {
+			return "", err
+		}
+
+		return string(hashedPassword), nil
+	}
+
+	salt := make([]byte, argon2SaltLength)
+
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, argon2KeyLength)
+
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", AlgorithmArgon2id, argon2.Version, params.Memory, params.Time, params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+type argon2Hash struct {
+	params PasswordParams
+	salt   []byte
+	key    []byte
+}
+
+func parseArgon2Hash(hashedPassword string) (argon2Hash, error) {
+	parts := strings.Split(hashedPassword, "$")
+
+	if len(parts) != 6 || parts[0] != "" || parts[1] != AlgorithmArgon2id {
+		return argon2Hash{}, fmt.Errorf("not an argon2id hash")
+	}
+
+	if parts[2] != "v="+strconv.Itoa(argon2.Version) {
+		return argon2Hash{}, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+
+	hash := argon2Hash{params: PasswordParams{Algorithm: AlgorithmArgon2id}}
+
+	_, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &hash.params.Memory, &hash.params.Time, &hash.params.Threads)
+
+	if err != nil {
+		return argon2Hash{}, fmt.Errorf("invalid argon2 parameters: %v", err)
+	}
+
+	hash.salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+
+	if err != nil {
+		return argon2Hash{}, fmt.Errorf("invalid argon2 salt: %v", err)
+	}
+
+	hash.key, err = base64.RawStdEncoding.DecodeString(parts[5])
+
+	if err != nil || len(hash.key) == 0 {
+		return argon2Hash{}, fmt.Errorf("invalid argon2 key")
+	}
+
+	return hash, nil
+}
+
+// CheckPasswordHash compares the password with a hash of either algorithm.
+// Accounts without a usable hash, such as passwordless ones, take as long to
+// reject as any other.
+func CheckPasswordHash(password, hashedPassword string) bool {
+	match, err := compareHash(password, hashedPassword)
+
+	if err != nil {
+		EqualizePasswordCheck(password)
+		return false
+	}
+
+	return match
+}
+
+// compareHash works through the hash even for passwords that can't match, so
+// every check against a hash of the same kind takes as long.
+func compareHash(password, hashedPassword string) (bool, error) {
+	if strings.HasPrefix(hashedPassword, "$"+AlgorithmArgon2id+"$") {
+		hash, err := parseArgon2Hash(hashedPassword)
+
+		if err != nil {
+			return false, err
+		}
+
+		key := argon2.IDKey([]byte(password), hash.salt, hash.params.Time, hash.params.Memory, hash.params.Threads, uint32(len(hash.key)))
+
+		return subtle.ConstantTimeCompare(key, hash.key) == 1, nil
+	}
+
+	if _, err := bcrypt.Cost([]byte(hashedPassword)); err != nil {
+		return false, err
+	}
+
+	// bcrypt would compare just the first 72 bytes, so longer passwords never match
+	tooLong := len(password) > bcryptMaxPasswordLength
+
+	if tooLong {
+		password = password[:bcryptMaxPasswordLength]
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+
+	return err == nil && !tooLong, nil
+}
+
+// NeedsRehash reports whether the hash was made with other parameters than
+// the current ones, so it should be replaced once the password is known.
+func NeedsRehash(hashedPassword string) bool {
+	params := passwordParams
+
+	if params.Algorithm == AlgorithmBcrypt {
+		cost, err := bcrypt.Cost([]byte(hashedPassword))
+
+		return err != nil || cost != params.Cost
+	}
+
+	hash, err := parseArgon2Hash(hashedPassword)
+
+	return err != nil || hash.params != params || len(hash.key) != argon2KeyLength
+}
+
+// dummyHash is compared against when there is no hash to check, so unknown
+// usernames take as long to reject as wrong passwords. It is made with the
+// current parameters like every new hash, and hashes with older ones are
+// upgraded at sign in, so real accounts converge on the same cost.
+var dummyHash = sync.OnceValue(func() string {
+	hash, err := HashPassword("timing equalization")
+
+	if err != nil {
+		panic(err)
+	}
+
+	return hash
+})
+
+// EqualizePasswordCheck does the work of checking a password without a hash
+// to check it against.
+func EqualizePasswordCheck(password string) {
+	compareHash(password, dummyHash())
+}
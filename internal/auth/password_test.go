@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestCheckPasswordHashRejectsUnusableHashes(t *testing.T) {
+	hashes := map[string]string{
+		"passwordless":      "",
+		"garbage":           "not a hash",
+		"broken argon2id":   "$argon2id$v=19$m=19456,t=2,p=1$c2FsdA$",
+		"argon2 version":    "$argon2id$v=16$m=19456,t=2,p=1$c2FsdA$a2V5",
+		"truncated bcrypt":  "$2a$10$abc",
+		"unknown algorithm": "$scrypt$ln=15,r=8,p=1$c2FsdA$a2V5",
+	}
+
+	for name, hash := range hashes {
+		for _, password := range []string{"", "hunter2"} {
+			if CheckPasswordHash(password, hash) {
+				t.Errorf("%s: %q matched", name, password)
+			}
+		}
+	}
+}
+
+var (
+	cheapArgon2 = PasswordParams{Algorithm: AlgorithmArgon2id, Memory: 64, Time: 1, Threads: 1}
+	cheapBcrypt = PasswordParams{Algorithm: AlgorithmBcrypt, Cost: bcrypt.MinCost}
+)
+
+// withPasswordParams hashes with the given parameters for the test.
+func withPasswordParams(t *testing.T, params PasswordParams) {
+	t.Helper()
+
+	old := passwordParams
+	SetPasswordParams(params)
+
+	t.Cleanup(func() {
+		SetPasswordParams(old)
+	})
+}
+
+func hash(t *testing.T, params PasswordParams, password string) string {
+	t.Helper()
+
+	withPasswordParams(t, params)
+
+	hashedPassword, err := HashPassword(password)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return hashedPassword
+}
+
+func TestParsePasswordParams(t *testing.T) {
+	tests := []struct {
+		config string
+		want   PasswordParams
+		err    bool
+	}{
+		{config: "argon2id", want: DefaultPasswordParams},
+		{config: "argon2id,m=65536,t=3,p=4", want: PasswordParams{Algorithm: AlgorithmArgon2id, Memory: 65536, Time: 3, Threads: 4}},
+		{config: "argon2id, t=1", want: PasswordParams{Algorithm: AlgorithmArgon2id, Memory: DefaultPasswordParams.Memory, Time: 1, Threads: 1}},
+		{config: "bcrypt", want: PasswordParams{Algorithm: AlgorithmBcrypt, Cost: bcrypt.DefaultCost}},
+		{config: "bcrypt,cost=12", want: PasswordParams{Algorithm: AlgorithmBcrypt, Cost: 12}},
+		{config: "scrypt", err: true},
+		{config: "", err: true},
+		{config: "argon2id,m", err: true},
+		{config: "argon2id,m=0", err: true},
+		{config: "argon2id,m=-1", err: true},
+		{config: "argon2id,p=256", err: true},
+		{config: "argon2id,cost=12", err: true},
+		{config: "bcrypt,m=65536", err: true},
+		{config: "bcrypt,cost=3", err: true},
+		{config: "bcrypt,cost=32", err: true},
+	}
+
+	for _, tt := range tests {
+		params, err := ParsePasswordParams(tt.config)
+
+		if (err != nil) != tt.err {
+			t.Errorf("%q: error %v, want error %v", tt.config, err, tt.err)
+			continue
+		}
+
+		if params != tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.config, params, tt.want)
+		}
+	}
+}
+
+func TestParseArgon2Hash(t *testing.T) {
+	tests := []struct {
+		hash string
+		want PasswordParams
+		err  bool
+	}{
+		{hash: "$argon2id$v=19$m=19456,t=2,p=1$c2FsdHNhbHRzYWx0$a2V5a2V5a2V5", want: PasswordParams{Algorithm: AlgorithmArgon2id, Memory: 19456, Time: 2, Threads: 1}},
+		{hash: "$argon2i$v=19$m=19456,t=2,p=1$c2FsdA$a2V5", err: true},
+		{hash: "$argon2id$v=16$m=19456,t=2,p=1$c2FsdA$a2V5", err: true},
+		{hash: "$argon2id$v=19$m=19456,t=2$c2FsdA$a2V5", err: true},
+		{hash: "$argon2id$v=19$m=19456,t=2,p=1$c2FsdA==$a2V5", err: true},
+		{hash: "$argon2id$v=19$m=19456,t=2,p=1$c2FsdA$", err: true},
+		{hash: "$argon2id$v=19$m=19456,t=2,p=1$c2FsdA", err: true},
+		{hash: "argon2id$v=19$m=19456,t=2,p=1$c2FsdA$a2V5$", err: true},
+	}
+
+	for _, tt := range tests {
+		hash, err := parseArgon2Hash(tt.hash)
+
+		if (err != nil) != tt.err {
+			t.Errorf("%q: error %v, want error %v", tt.hash, err, tt.err)
+			continue
+		}
+
+		if hash.params != tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.hash, hash.params, tt.want)
+		}
+	}
+}
+
+func TestCheckPasswordHash(t *testing.T) {
+	for _, params := range []PasswordParams{cheapArgon2, cheapBcrypt} {
+		hashedPassword := hash(t, params, "correct horse battery staple")
+
+		tests := map[string]bool{
+			"correct horse battery staple":  true,
+			"correct horse battery staple ": false,
+			"Correct horse battery staple":  false,
+			"":                              false,
+		}
+
+		for password, want := range tests {
+			if got := CheckPasswordHash(password, hashedPassword); got != want {
+				t.Errorf("%s: %q matched %v, want %v", params.Algorithm, password, got, want)
+			}
+		}
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	argon2Hash := hash(t, cheapArgon2, "password")
+	bcryptHash := hash(t, cheapBcrypt, "password")
+
+	tests := []struct {
+		name   string
+		params PasswordParams
+		hash   string
+		want   bool
+	}{
+		{name: "argon2id, same parameters", params: cheapArgon2, hash: argon2Hash, want: false},
+		{name: "argon2id, more memory", params: PasswordParams{Algorithm: AlgorithmArgon2id, Memory: 128, Time: 1, Threads: 1}, hash: argon2Hash, want: true},
+		{name: "argon2id, more iterations", params: PasswordParams{Algorithm: AlgorithmArgon2id, Memory: 64, Time: 2, Threads: 1}, hash: argon2Hash, want: true},
+		{name: "argon2id, short key", params: cheapArgon2, hash: "$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHRzYWx0$a2V5", want: true},
+		{name: "bcrypt to argon2id", params: cheapArgon2, hash: bcryptHash, want: true},
+		{name: "bcrypt, same cost", params: cheapBcrypt, hash: bcryptHash, want: false},
+		{name: "bcrypt, higher cost", params: PasswordParams{Algorithm: AlgorithmBcrypt, Cost: bcrypt.MinCost + 1}, hash: bcryptHash, want: true},
+		{name: "argon2id to bcrypt", params: cheapBcrypt, hash: argon2Hash, want: true},
+		{name: "no hash", params: cheapArgon2, hash: "", want: true},
+	}
+
+	for _, tt := range tests {
+		withPasswordParams(t, tt.params)
+
+		if got := NeedsRehash(tt.hash); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBcryptRejectsPasswordsOver72Bytes(t *testing.T) {
+	long := strings.Repeat("a", bcryptMaxPasswordLength)
+
+	withPasswordParams(t, cheapBcrypt)
+
+	if _, err := HashPassword(long + "b"); !errors.Is(err, ErrPasswordTooLong) {
+		t.Fatalf("hashing %d bytes: %v, want ErrPasswordTooLong", len(long)+1, err)
+	}
+
+	hashedPassword, err := HashPassword(long)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]bool{
+		long:       true,
+		long + "b": false,
+		long + "a": false,
+	}
+
+	for password, want := range tests {
+		if got := CheckPasswordHash(password, hashedPassword); got != want {
+			t.Errorf("%d bytes: matched %v, want %v", len(password), got, want)
+		}
+	}
+
+	// argon2id reads the whole password, however long
+	withPasswordParams(t, cheapArgon2)
+
+	hashedPassword, err = HashPassword(long + "b")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if CheckPasswordHash(long+"c", hashedPassword) || !CheckPasswordHash(long+"b", hashedPassword) {
+		t.Fatal("argon2id compared only part of a long password")
+	}
+}
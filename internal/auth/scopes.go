@@ -0,0 +1,33 @@
+package auth
+
+import "slices"
+
+// PersonalAccessTokenPrefix marks personal access tokens, so they are easy to
+// tell apart and to spot in leaked code.
+const PersonalAccessTokenPrefix = "pat_"
+
+// scopes of personal access tokens
+const (
+	ScopeReadArticles  = "read:articles"
+	ScopeWriteArticles = "write:articles"
+	ScopeManageCompany = "manage:company"
+)
+
+var TokenScopes = []string{ScopeReadArticles, ScopeWriteArticles, ScopeManageCompany}
+
+func IsTokenScope(scope string) bool {
+	return slices.Contains(TokenScopes, scope)
+}
+
+// NewPersonalAccessToken returns a token to show the user once and the hash to store.
+func NewPersonalAccessToken() (token string, hash string, err error) {
+	token, _, err = NewOpaqueToken()
+
+	if err != nil {
+		return "", "", err
+	}
+
+	token = PersonalAccessTokenPrefix + token
+
+	return token, HashOpaqueToken(token), nil
+}
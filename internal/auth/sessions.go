@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// Active sessions are cached for a short while, so most requests don't look
+// their session up. A revoked session keeps working until its entry expires.
+const (
+	sessionCacheTTL  = 10 * time.Second
+	sessionCacheSize = 10000
+)
+
+type sessionEntry struct {
+	userId    int
+	expiresAt time.Time
+}
+
+type sessionCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	size    int
+	entries map[int]sessionEntry
+}
+
+func newSessionCache(ttl time.Duration, size int) *sessionCache {
+	return &sessionCache{ttl: ttl, size: size, entries: make(map[int]sessionEntry)}
+}
+
+func (c *sessionCache) get(sessionId int) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[sessionId]
+
+	if !ok || time.Now().After(entry.expiresAt) {
+		return 0, false
+	}
+
+	return entry.userId, true
+}
+
+func (c *sessionCache) put(sessionId int, userId int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	if len(c.entries) >= c.size {
+		for id, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, id)
+			}
+		}
+	}
+
+	// every entry is fresh, starting over is cheaper than tracking their age
+	if len(c.entries) >= c.size {
+		clear(c.entries)
+	}
+
+	c.entries[sessionId] = sessionEntry{userId: userId, expiresAt: now.Add(c.ttl)}
+}
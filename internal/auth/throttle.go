@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"time"
+)
+
+type LoginAttemptStore interface {
+	RecordLoginAttempt(username string, ip string, success bool) error
+	// CountLoginFailures counts failures inside the window: for the account
+	// since its last success or lockout, and for the IP across all accounts.
+	CountLoginFailures(username string, ip string, window time.Duration) (int, int, error)
+	GetLockoutRemaining(username string) (time.Duration, error)
+	InsertLockout(username string, ip string, failures int, duration time.Duration) error
+}
+
+type LoginPolicy struct {
+	MaxAccountFailures int
+	MaxIPFailures      int
+	Window             time.Duration
+	LockoutDuration    time.Duration
+	BaseDelay          time.Duration
+	MaxDelay           time.Duration
+}
+
+var DefaultLoginPolicy = LoginPolicy{
+	MaxAccountFailures: 5,
+	MaxIPFailures:      50,
+	Window:             15 * time.Minute,
+	LockoutDuration:    15 * time.Minute,
+	BaseDelay:          250 * time.Millisecond,
+	MaxDelay:           4 * time.Second,
+}
+
+// LoginGuard throttles password guessing. Attempts are tracked by the
+// submitted username, whether the account exists or not, so throttling
+// itself doesn't tell existing accounts apart.
+type LoginGuard struct {
+	store  LoginAttemptStore
+	policy LoginPolicy
+}
+
+func NewLoginGuard(store LoginAttemptStore, policy LoginPolicy) *LoginGuard {
+	return &LoginGuard{store: store, policy: policy}
+}
+
+// Check decides whether a login attempt may go ahead. A non-zero retryAfter
+// means the account is locked or the IP is throttled; otherwise the attempt
+// should be stalled for delay, which doubles with every recent failure.
+func (g *LoginGuard) Check(username string, ip string) (time.Duration, time.Duration, error) {
+	remaining, err := g.store.GetLockoutRemaining(username)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if remaining > 0 {
+		return 0, remaining, nil
+	}
+
+	accountFailures, ipFailures, err := g.store.CountLoginFailures(username, ip, g.policy.Window)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if ipFailures >= g.policy.MaxIPFailures {
+		return 0, g.policy.Window, nil
+	}
+
+	if accountFailures == 0 {
+		return 0, 0, nil
+	}
+
+	delay := g.policy.MaxDelay
+
+	if accountFailures < 16 {
+		delay = min(g.policy.BaseDelay<<(accountFailures-1), g.policy.MaxDelay)
+	}
+
+	return delay, 0, nil
+}
+
+// Failed records a failed attempt and locks the account once it reaches the limit.
+func (g *LoginGuard) Failed(username string, ip string) error {
+	err := g.store.RecordLoginAttempt(username, ip, false)
+
+	if err != nil {
+		return err
+	}
+
+	accountFailures, _, err := g.store.CountLoginFailures(username, ip, g.policy.Window)
+
+	if err != nil {
+		return err
+	}
+
+	if accountFailures >= g.policy.MaxAccountFailures {
+		return g.store.InsertLockout(username, ip, accountFailures, g.policy.LockoutDuration)
+	}
+
+	return nil
+}
+
+func (g *LoginGuard) Succeeded(username string, ip string) error {
+	return g.store.RecordLoginAttempt(username, ip, true)
+}
@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// memoryAttempts counts failures the way the database does: for the account
+// since its last success or lockout, for the IP across all accounts.
+type memoryAttempts struct {
+	accountFailures map[string]int
+	ipFailures      map[string]int
+	lockouts        map[string]time.Duration
+}
+
+func newMemoryAttempts() *memoryAttempts {
+	return &memoryAttempts{
+		accountFailures: map[string]int{},
+		ipFailures:      map[string]int{},
+		lockouts:        map[string]time.Duration{},
+	}
+}
+
+func (s *memoryAttempts) RecordLoginAttempt(username string, ip string, success bool) error {
+	if success {
+		s.accountFailures[username] = 0
+		return nil
+	}
+
+	s.accountFailures[username]++
+	s.ipFailures[ip]++
+
+	return nil
+}
+
+func (s *memoryAttempts) CountLoginFailures(username string, ip string, window time.Duration) (int, int, error) {
+	return s.accountFailures[username], s.ipFailures[ip], nil
+}
+
+func (s *memoryAttempts) GetLockoutRemaining(username string) (time.Duration, error) {
+	return s.lockouts[username], nil
+}
+
+func (s *memoryAttempts) InsertLockout(username string, ip string, failures int, duration time.Duration) error {
+	s.lockouts[username] = duration
+	s.accountFailures[username] = 0
+
+	return nil
+}
+
+func TestLoginDelayDoubles(t *testing.T) {
+	tests := []struct {
+		failures int
+		delay    time.Duration
+	}{
+		{failures: 0, delay: 0},
+		{failures: 1, delay: 250 * time.Millisecond},
+		{failures: 2, delay: 500 * time.Millisecond},
+		{failures: 3, delay: time.Second},
+		{failures: 4, delay: 2 * time.Second},
+		{failures: 5, delay: 4 * time.Second},
+		{failures: 6, delay: 4 * time.Second},
+		// past the point where the shift would overflow
+		{failures: 70, delay: 4 * time.Second},
+	}
+
+	for _, tt := range tests {
+		store := newMemoryAttempts()
+		store.accountFailures["ada"] = tt.failures
+
+		delay, retryAfter, err := NewLoginGuard(store, DefaultLoginPolicy).Check("ada", "203.0.113.1")
+
+		if err != nil || delay != tt.delay || retryAfter != 0 {
+			t.Errorf("%d failures: delay %v, retry after %v, %v, want delay %v", tt.failures, delay, retryAfter, err, tt.delay)
+		}
+	}
+}
+
+func TestAccountLockout(t *testing.T) {
+	store := newMemoryAttempts()
+	guard := NewLoginGuard(store, DefaultLoginPolicy)
+
+	for i := 1; i <= DefaultLoginPolicy.MaxAccountFailures; i++ {
+		// from different IPs, the account is what gets locked
+		ip := "203.0.113." + strconv.Itoa(i)
+
+		if _, retryAfter, _ := guard.Check("ada", ip); retryAfter != 0 {
+			t.Fatalf("locked after %d failures, want %d", i-1, DefaultLoginPolicy.MaxAccountFailures)
+		}
+
+		if err := guard.Failed("ada", ip); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, retryAfter, _ := guard.Check("ada", "198.51.100.1"); retryAfter != DefaultLoginPolicy.LockoutDuration {
+		t.Fatalf("retry after %v once locked, want %v", retryAfter, DefaultLoginPolicy.LockoutDuration)
+	}
+
+	if _, retryAfter, _ := guard.Check("grace", "198.51.100.1"); retryAfter != 0 {
+		t.Fatal("lockout spilled over to another account")
+	}
+
+	// the counter starts over after a lockout, and a lockout runs its course
+	delete(store.lockouts, "ada")
+
+	if delay, retryAfter, _ := guard.Check("ada", "198.51.100.1"); delay != 0 || retryAfter != 0 {
+		t.Fatalf("after the lockout: delay %v, retry after %v, want neither", delay, retryAfter)
+	}
+}
+
+func TestSuccessResetsTheDelay(t *testing.T) {
+	store := newMemoryAttempts()
+	guard := NewLoginGuard(store, DefaultLoginPolicy)
+
+	for i := 0; i < DefaultLoginPolicy.MaxAccountFailures-1; i++ {
+		guard.Failed("ada", "203.0.113.1")
+	}
+
+	if delay, _, _ := guard.Check("ada", "203.0.113.1"); delay == 0 {
+		t.Fatal("no delay after failures")
+	}
+
+	guard.Succeeded("ada", "203.0.113.1")
+
+	if delay, _, _ := guard.Check("ada", "203.0.113.1"); delay != 0 {
+		t.Fatalf("delay %v after a success, want none", delay)
+	}
+
+	if len(store.lockouts) != 0 {
+		t.Fatalf("locked %v below the threshold", store.lockouts)
+	}
+}
+
+func TestIPThrottle(t *testing.T) {
+	tests := []struct {
+		failures   int
+		retryAfter time.Duration
+	}{
+		{failures: DefaultLoginPolicy.MaxIPFailures - 1, retryAfter: 0},
+		{failures: DefaultLoginPolicy.MaxIPFailures, retryAfter: DefaultLoginPolicy.Window},
+		{failures: DefaultLoginPolicy.MaxIPFailures + 10, retryAfter: DefaultLoginPolicy.Window},
+	}
+
+	for _, tt := range tests {
+		store := newMemoryAttempts()
+		store.ipFailures["203.0.113.1"] = tt.failures
+
+		guard := NewLoginGuard(store, DefaultLoginPolicy)
+
+		// spread over accounts that never failed themselves
+		if _, retryAfter, _ := guard.Check("someone-new", "203.0.113.1"); retryAfter != tt.retryAfter {
+			t.Errorf("%d failures from the IP: retry after %v, want %v", tt.failures, retryAfter, tt.retryAfter)
+		}
+
+		if _, retryAfter, _ := guard.Check("someone-new", "198.51.100.1"); retryAfter != 0 {
+			t.Errorf("%d failures from another IP: retry after %v, want none", tt.failures, retryAfter)
+		}
+	}
+}
@@ -2,19 +2,52 @@ package auth
 
 import (
 	"auth-service/internal/keys"
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 )
 
-func CreateToken(username string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256,
-		jwt.MapClaims{
-			"username": username,
-			"exp":      time.Now().Add(time.Hour * 48).Unix(),
-		})
+type Claims struct {
+	UserId   int    `json:"id"`
+	Username string `json:"username"`
+	// Purpose is empty for access tokens and names the flow for single-purpose tokens
+	Purpose string `json:"purpose,omitempty"`
+	Email   string `json:"email,omitempty"`
+	// SessionId is the session the access token belongs to, it stops working once the session is revoked
+	SessionId int `json:"sid,omitempty"`
+	// Scopes limit requests made with a personal access token, nil for cookie sessions
+	Scopes []string `json:"-"`
+	jwt.RegisteredClaims
+}
+
+const (
+	PurposeEmailVerification = "email-verification"
+	// PurposeOAuthConsent tokens tie a submitted consent form to the page we rendered
+	PurposeOAuthConsent = "oauth-consent"
+)
+
+// SessionTTL is how long a sign-in lasts.
+const SessionTTL = time.Hour * 48
+
+func CreateToken(userId int, username string, sessionId int) (string, error) {
+	return signToken(Claims{
+		UserId:    userId,
+		Username:  username,
+		SessionId: sessionId,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(SessionTTL)),
+		},
+	})
+}
+
+// signToken signs with JWT_SECRET_KEY and names the key in the header, so
+// the token still verifies once the key has moved to JWT_PREVIOUS_SECRET_KEY.
+func signToken(claims Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = secretKeyId(keys.JWT_SECRET_KEY)
 
 	tokenString, err := token.SignedString(keys.JWT_SECRET_KEY)
 
@@ -25,35 +58,88 @@ func CreateToken(username string) (string, error) {
 	return tokenString, nil
 }
 
-func VerifyToken(token string) error {
-	jwt, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return keys.JWT_SECRET_KEY, nil
-	})
+// key ids are a prefix of the key's hash, so they don't have to be configured
+func secretKeyId(key []byte) string {
+	sum := sha256.Sum256(key)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:6])
+}
+
+// verificationKey picks the secret the token names. Tokens from before key
+// ids were added name none and were signed with the current key.
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	kid, _ := token.Header["kid"].(string)
+
+	if kid != "" && len(keys.JWT_PREVIOUS_SECRET_KEY) > 0 && kid == secretKeyId(keys.JWT_PREVIOUS_SECRET_KEY) {
+		return keys.JWT_PREVIOUS_SECRET_KEY, nil
+	}
+
+	return keys.JWT_SECRET_KEY, nil
+}
+
+func parseToken(token string) (*Claims, error) {
+	var claims Claims
+
+	jwt, err := jwt.ParseWithClaims(token, &claims, verificationKey)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if !jwt.Valid {
-		return fmt.Errorf("invalid token")
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	// tokens issued before the user id was added to the claims
+	if claims.UserId == 0 {
+		return nil, fmt.Errorf("token has no user id")
 	}
 
-	return nil
+	return &claims, nil
 }
 
-func HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+func VerifyToken(token string) (*Claims, error) {
+	claims, err := parseToken(token)
+
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	// single-purpose tokens are signed with the same key but must never grant access
+	if claims.Purpose != "" {
+		return nil, fmt.Errorf("not an access token")
 	}
 
-	return string(hashedPassword), nil
+	return claims, nil
 }
 
-func CheckPasswordHash(password, hashedPassword string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
-	return err == nil
+// CreatePurposeToken signs a short-lived token that is only good for one flow,
+// such as confirming an email address.
+func CreatePurposeToken(purpose string, userId int, email string, ttl time.Duration) (string, error) {
+	return signToken(Claims{
+		UserId:  userId,
+		Purpose: purpose,
+		Email:   email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+		},
+	})
+}
+
+func VerifyPurposeToken(token string, purpose string) (*Claims, error) {
+	claims, err := parseToken(token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Purpose != purpose {
+		return nil, fmt.Errorf("token is not meant for %s", purpose)
+	}
+
+	return claims, nil
 }
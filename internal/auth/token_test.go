@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"auth-service/internal/keys"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// withSecrets sets the JWT keys for the test.
+func withSecrets(t *testing.T, current string, previous string) {
+	t.Helper()
+
+	oldCurrent, oldPrevious := keys.JWT_SECRET_KEY, keys.JWT_PREVIOUS_SECRET_KEY
+	keys.JWT_SECRET_KEY, keys.JWT_PREVIOUS_SECRET_KEY = []byte(current), []byte(previous)
+
+	t.Cleanup(func() {
+		keys.JWT_SECRET_KEY, keys.JWT_PREVIOUS_SECRET_KEY = oldCurrent, oldPrevious
+	})
+}
+
+func TestTokensSurviveKeyRotation(t *testing.T) {
+	withSecrets(t, "old-secret", "")
+
+	token, err := CreateToken(1, "ada", 7)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withSecrets(t, "new-secret", "old-secret")
+
+	claims, err := VerifyToken(token)
+
+	if err != nil || claims.UserId != 1 || claims.SessionId != 7 {
+		t.Fatalf("token signed before the rotation: %+v, %v", claims, err)
+	}
+
+	fresh, err := CreateToken(1, "ada", 7)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := VerifyToken(fresh); err != nil {
+		t.Fatalf("token signed after the rotation: %v", err)
+	}
+
+	// once the previous key is dropped, what it signed stops verifying
+	withSecrets(t, "new-secret", "")
+
+	if _, err := VerifyToken(token); err == nil {
+		t.Fatal("token verified without its key")
+	}
+}
+
+func TestTokensWithoutKeyIdUseTheCurrentKey(t *testing.T) {
+	withSecrets(t, "current-secret", "previous-secret")
+
+	sign := func(secret string) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+			UserId:           1,
+			RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+		}).SignedString([]byte(secret))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return token
+	}
+
+	if _, err := VerifyToken(sign("current-secret")); err != nil {
+		t.Fatalf("token without a key id: %v", err)
+	}
+
+	if _, err := VerifyToken(sign("previous-secret")); err == nil {
+		t.Fatal("token without a key id verified with the previous key")
+	}
+}
+
+func TestTokensRejectForgeries(t *testing.T) {
+	withSecrets(t, "current-secret", "previous-secret")
+
+	forge := func(method jwt.SigningMethod, key any, kid string) string {
+		token := jwt.NewWithClaims(method, Claims{
+			UserId:           1,
+			RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+		})
+
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+
+		signed, err := token.SignedString(key)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return signed
+	}
+
+	tests := map[string]string{
+		"unknown key":               forge(jwt.SigningMethodHS256, []byte("other-secret"), ""),
+		"unknown key with a key id": forge(jwt.SigningMethodHS256, []byte("other-secret"), secretKeyId([]byte("other-secret"))),
+		"current key id, other key": forge(jwt.SigningMethodHS256, []byte("other-secret"), secretKeyId([]byte("current-secret"))),
+		"alg none":                  forge(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, ""),
+	}
+
+	for name, token := range tests {
+		if _, err := VerifyToken(token); err == nil {
+			t.Errorf("%s: token verified", name)
+		}
+	}
+}
+
+func TestPurposeTokensAreNotAccessTokens(t *testing.T) {
+	withSecrets(t, "current-secret", "")
+
+	token, err := CreatePurposeToken(PurposeEmailVerification, 1, "ada@example.com", time.Hour)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := VerifyToken(token); err == nil {
+		t.Fatal("purpose token accepted as an access token")
+	}
+
+	if _, err := VerifyPurposeToken(token, PurposeOAuthConsent); err == nil {
+		t.Fatal("purpose token accepted for another purpose")
+	}
+
+	if claims, err := VerifyPurposeToken(token, PurposeEmailVerification); err != nil || claims.Email != "ada@example.com" {
+		t.Fatalf("purpose token: %+v, %v", claims, err)
+	}
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// PurposeLoginChallenge tokens prove the password step of a two-step login.
+const PurposeLoginChallenge = "login-challenge"
+
+const recoveryCodeCount = 10
+
+// CreateLoginChallenge signs a login challenge token. It also returns the
+// token id, which is stored so the challenge can only be answered once.
+func CreateLoginChallenge(userId int, ttl time.Duration) (string, string, error) {
+	_, id, err := NewOpaqueToken()
+
+	if err != nil {
+		return "", "", err
+	}
+
+	tokenString, err := signToken(Claims{
+		UserId:  userId,
+		Purpose: PurposeLoginChallenge,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        id,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+		},
+	})
+
+	if err != nil {
+		return "", "", err
+	}
+
+	return tokenString, id, nil
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewRecoveryCodes returns one-time codes to show the user once, with the
+// hashes to store.
+func NewRecoveryCodes() (codes []string, hashes []string, err error) {
+	for i := 0; i < recoveryCodeCount; i++ {
+		bytes := make([]byte, 5)
+
+		_, err = rand.Read(bytes)
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading random bytes: %v", err)
+		}
+
+		code := strings.ToLower(recoveryEncoding.EncodeToString(bytes))
+
+		codes = append(codes, code[:4]+"-"+code[4:])
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode hashes a code the way the user may type it back: any
+// case, with or without the dash.
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return HashOpaqueToken(code)
+}
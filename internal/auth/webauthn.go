@@ -0,0 +1,411 @@
+package auth
+
+import (
+	"auth-service/pkg/cbor"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ceremony types, as reported in the client data
+const (
+	WebAuthnCreate = "webauthn.create"
+	WebAuthnGet    = "webauthn.get"
+)
+
+// COSE algorithms accepted for passkeys
+const (
+	coseES256 = -7
+	coseEdDSA = -8
+	coseRS256 = -257
+)
+
+// WebAuthnAlgorithms lists the accepted algorithms in order of preference.
+var WebAuthnAlgorithms = []int{coseES256, coseEdDSA, coseRS256}
+
+// authenticator data flags
+const (
+	flagUserPresent      = 0x01
+	flagUserVerified     = 0x04
+	flagAttestedCredData = 0x40
+)
+
+// Base64URL is binary data that travels as unpadded base64url in JSON, the
+// encoding WebAuthn clients use.
+type Base64URL []byte
+
+func (b Base64URL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *Base64URL) UnmarshalJSON(data []byte) error {
+	var encoded string
+
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+
+	// some clients pad, so the padding is dropped before decoding
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+
+	if err != nil {
+		return err
+	}
+
+	*b = decoded
+
+	return nil
+}
+
+// WebAuthn verifies passkey ceremonies for one relying party. Origins are the
+// pages allowed to run them, e.g. "https://example.com".
+type WebAuthn struct {
+	RPID    string
+	RPName  string
+	Origins []string
+}
+
+func NewWebAuthn(rpId string, rpName string, origins []string) *WebAuthn {
+	return &WebAuthn{RPID: rpId, RPName: rpName, Origins: origins}
+}
+
+// NewWebAuthnChallenge returns a random challenge, base64url encoded as it
+// comes back in the client data.
+func NewWebAuthnChallenge() (string, error) {
+	bytes := make([]byte, 32)
+
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// WebAuthnUserHandle is the user handle a user's passkeys are created with.
+func WebAuthnUserHandle(userId int) []byte {
+	return []byte(strconv.Itoa(userId))
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// ClientDataChallenge reads the challenge from the client data, so the
+// ceremony's stored state can be looked up before verifying it.
+func ClientDataChallenge(clientDataJSON []byte) (string, error) {
+	var data clientData
+
+	if err := json.Unmarshal(clientDataJSON, &data); err != nil {
+		return "", fmt.Errorf("invalid client data: %v", err)
+	}
+
+	return data.Challenge, nil
+}
+
+func (wa *WebAuthn) checkClientData(clientDataJSON []byte, ceremony string, challenge string) error {
+	var data clientData
+
+	if err := json.Unmarshal(clientDataJSON, &data); err != nil {
+		return fmt.Errorf("invalid client data: %v", err)
+	}
+
+	if data.Type != ceremony {
+		return fmt.Errorf("unexpected ceremony %q", data.Type)
+	}
+
+	if data.Challenge != challenge {
+		return fmt.Errorf("challenge mismatch")
+	}
+
+	if !slices.Contains(wa.Origins, data.Origin) {
+		return fmt.Errorf("unexpected origin %q", data.Origin)
+	}
+
+	return nil
+}
+
+type authenticatorData struct {
+	rpIdHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialId []byte
+	publicKey    []byte
+}
+
+func parseAuthenticatorData(data []byte) (authenticatorData, error) {
+	if len(data) < 37 {
+		return authenticatorData{}, fmt.Errorf("authenticator data too short")
+	}
+
+	parsed := authenticatorData{
+		rpIdHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+
+	if parsed.flags&flagAttestedCredData == 0 {
+		return parsed, nil
+	}
+
+	// AAGUID, then the credential id with its length, then the COSE key
+	rest := data[37:]
+
+	if len(rest) < 18 {
+		return authenticatorData{}, fmt.Errorf("attested credential data too short")
+	}
+
+	idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+
+	if len(rest) < idLength {
+		return authenticatorData{}, fmt.Errorf("credential id too short")
+	}
+
+	parsed.credentialId = rest[:idLength]
+	rest = rest[idLength:]
+
+	// extensions may follow the key, so only the first item is taken
+	_, extensions, err := cbor.DecodeFirst(rest)
+
+	if err != nil {
+		return authenticatorData{}, fmt.Errorf("invalid credential public key: %v", err)
+	}
+
+	parsed.publicKey = rest[:len(rest)-len(extensions)]
+
+	return parsed, nil
+}
+
+func (wa *WebAuthn) checkAuthenticatorData(data authenticatorData) error {
+	rpIdHash := sha256.Sum256([]byte(wa.RPID))
+
+	if !bytes.Equal(data.rpIdHash, rpIdHash[:]) {
+		return fmt.Errorf("credential is for another relying party")
+	}
+
+	// passkeys stand in for the password, so the authenticator must have
+	// checked it's the user and not just someone touching the key
+	if data.flags&flagUserPresent == 0 || data.flags&flagUserVerified == 0 {
+		return fmt.Errorf("user was not verified")
+	}
+
+	return nil
+}
+
+// WebAuthnCredential is a verified new credential.
+type WebAuthnCredential struct {
+	Id        []byte
+	PublicKey []byte
+	SignCount uint32
+}
+
+// VerifyRegistration checks the response to a registration ceremony started
+// with the challenge. Attestation isn't requested, so its statement isn't
+// checked; the credential is trusted as much as the signed-in user that
+// registers it.
+func (wa *WebAuthn) VerifyRegistration(clientDataJSON []byte, attestationObject []byte, challenge string) (WebAuthnCredential, error) {
+	if err := wa.checkClientData(clientDataJSON, WebAuthnCreate, challenge); err != nil {
+		return WebAuthnCredential{}, err
+	}
+
+	decoded, err := cbor.Decode(attestationObject)
+
+	if err != nil {
+		return WebAuthnCredential{}, fmt.Errorf("invalid attestation object: %v", err)
+	}
+
+	attestation, ok := decoded.(map[any]any)
+
+	if !ok {
+		return WebAuthnCredential{}, fmt.Errorf("invalid attestation object")
+	}
+
+	rawAuthData, ok := attestation["authData"].([]byte)
+
+	if !ok {
+		return WebAuthnCredential{}, fmt.Errorf("attestation object has no authenticator data")
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+
+	if err != nil {
+		return WebAuthnCredential{}, err
+	}
+
+	if err := wa.checkAuthenticatorData(authData); err != nil {
+		return WebAuthnCredential{}, err
+	}
+
+	if authData.credentialId == nil {
+		return WebAuthnCredential{}, fmt.Errorf("no credential in authenticator data")
+	}
+
+	// make sure the key is one we can verify logins with
+	if _, _, err := parseCOSEKey(authData.publicKey); err != nil {
+		return WebAuthnCredential{}, err
+	}
+
+	return WebAuthnCredential{
+		Id:        authData.credentialId,
+		PublicKey: authData.publicKey,
+		SignCount: authData.signCount,
+	}, nil
+}
+
+// VerifyAssertion checks the response to a login ceremony against the stored
+// credential and returns the authenticator's new signature counter. A counter
+// that didn't move forward means the credential may have been cloned.
+func (wa *WebAuthn) VerifyAssertion(publicKey []byte, storedSignCount uint32, clientDataJSON []byte, rawAuthData []byte, signature []byte, challenge string) (uint32, error) {
+	if err := wa.checkClientData(clientDataJSON, WebAuthnGet, challenge); err != nil {
+		return 0, err
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if err := wa.checkAuthenticatorData(authData); err != nil {
+		return 0, err
+	}
+
+	key, alg, err := parseCOSEKey(publicKey)
+
+	if err != nil {
+		return 0, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), rawAuthData...), clientDataHash[:]...)
+
+	if err := verifySignature(key, alg, signed, signature); err != nil {
+		return 0, err
+	}
+
+	// authenticators without a counter always report 0
+	if (authData.signCount != 0 || storedSignCount != 0) && authData.signCount <= storedSignCount {
+		return 0, fmt.Errorf("signature counter went backwards, the credential may be cloned")
+	}
+
+	return authData.signCount, nil
+}
+
+func verifySignature(key crypto.PublicKey, alg int64, signed []byte, signature []byte) error {
+	switch alg {
+	case coseES256:
+		digest := sha256.Sum256(signed)
+
+		if !ecdsa.VerifyASN1(key.(*ecdsa.PublicKey), digest[:], signature) {
+			return fmt.Errorf("invalid signature")
+		}
+	case coseEdDSA:
+		if !ed25519.Verify(key.(ed25519.PublicKey), signed, signature) {
+			return fmt.Errorf("invalid signature")
+		}
+	case coseRS256:
+		digest := sha256.Sum256(signed)
+
+		if err := rsa.VerifyPKCS1v15(key.(*rsa.PublicKey), crypto.SHA256, digest[:], signature); err != nil {
+			return fmt.Errorf("invalid signature")
+		}
+	default:
+		return fmt.Errorf("unsupported algorithm %d", alg)
+	}
+
+	return nil
+}
+
+// COSE key parameters (RFC 9053)
+const (
+	coseKty  = 1
+	coseAlg  = 3
+	coseCrv  = -1
+	coseX    = -2
+	coseY    = -3
+	coseRSAN = -1
+	coseRSAE = -2
+	coseOKP  = 1
+	coseEC2  = 2
+	coseRSA  = 3
+
+	coseP256    = 1
+	coseEd25519 = 6
+)
+
+func parseCOSEKey(raw []byte) (crypto.PublicKey, int64, error) {
+	decoded, err := cbor.Decode(raw)
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid COSE key: %v", err)
+	}
+
+	params, ok := decoded.(map[any]any)
+
+	if !ok {
+		return nil, 0, fmt.Errorf("invalid COSE key")
+	}
+
+	kty, _ := params[int64(coseKty)].(int64)
+	alg, _ := params[int64(coseAlg)].(int64)
+
+	switch {
+	case kty == coseEC2 && alg == coseES256:
+		crv, _ := params[int64(coseCrv)].(int64)
+		x, _ := params[int64(coseX)].([]byte)
+		y, _ := params[int64(coseY)].([]byte)
+
+		if crv != coseP256 || len(x) != 32 || len(y) != 32 {
+			return nil, 0, fmt.Errorf("invalid EC2 key")
+		}
+
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, 0, fmt.Errorf("EC2 key is not on the curve")
+		}
+
+		return key, alg, nil
+	case kty == coseOKP && alg == coseEdDSA:
+		crv, _ := params[int64(coseCrv)].(int64)
+		x, _ := params[int64(coseX)].([]byte)
+
+		if crv != coseEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, 0, fmt.Errorf("invalid OKP key")
+		}
+
+		return ed25519.PublicKey(x), alg, nil
+	case kty == coseRSA && alg == coseRS256:
+		n, _ := params[int64(coseRSAN)].([]byte)
+		e, _ := params[int64(coseRSAE)].([]byte)
+
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, 0, fmt.Errorf("invalid RSA key")
+		}
+
+		exponent := 0
+
+		for _, b := range e {
+			exponent = exponent<<8 | int(b)
+		}
+
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}, alg, nil
+	}
+
+	return nil, 0, fmt.Errorf("unsupported key type %d with algorithm %d", kty, alg)
+}
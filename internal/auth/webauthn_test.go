@@ -0,0 +1,336 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// cborPair keeps map entries in the order they are written.
+type cborPair struct {
+	key   any
+	value any
+}
+
+type cborMap []cborPair
+
+// encodeCBOR encodes the values the authenticator below produces: maps,
+// integers, byte strings and text.
+func encodeCBOR(value any) []byte {
+	head := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n <= 0xff:
+			return []byte{major<<5 | 24, byte(n)}
+		case n <= 0xffff:
+			return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+		default:
+			return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+		}
+	}
+
+	switch v := value.(type) {
+	case int:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+
+		return head(0, uint64(v))
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case cborMap:
+		out := head(5, uint64(len(v)))
+
+		for _, pair := range v {
+			out = append(out, encodeCBOR(pair.key)...)
+			out = append(out, encodeCBOR(pair.value)...)
+		}
+
+		return out
+	}
+
+	panic("unsupported CBOR value")
+}
+
+// softAuthenticator is a passkey held in memory. It signs whatever it is
+// asked to, with flags and counter under the test's control.
+type softAuthenticator struct {
+	rpId         string
+	origin       string
+	credentialId []byte
+	signer       crypto.Signer
+	alg          int
+	signCount    uint32
+	flags        byte
+}
+
+func newSoftAuthenticator(t *testing.T, alg int) *softAuthenticator {
+	t.Helper()
+
+	a := &softAuthenticator{
+		rpId:         "example.com",
+		origin:       "https://example.com",
+		credentialId: []byte("credential-1"),
+		alg:          alg,
+		flags:        flagUserPresent | flagUserVerified,
+	}
+
+	var err error
+
+	switch alg {
+	case coseES256:
+		a.signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case coseEdDSA:
+		_, a.signer, err = ed25519.GenerateKey(rand.Reader)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a
+}
+
+func (a *softAuthenticator) coseKey() []byte {
+	switch key := a.signer.Public().(type) {
+	case *ecdsa.PublicKey:
+		return encodeCBOR(cborMap{
+			{coseKty, coseEC2},
+			{coseAlg, coseES256},
+			{coseCrv, coseP256},
+			{coseX, key.X.FillBytes(make([]byte, 32))},
+			{coseY, key.Y.FillBytes(make([]byte, 32))},
+		})
+	case ed25519.PublicKey:
+		return encodeCBOR(cborMap{
+			{coseKty, coseOKP},
+			{coseAlg, coseEdDSA},
+			{coseCrv, coseEd25519},
+			{coseX, []byte(key)},
+		})
+	}
+
+	panic("unsupported key")
+}
+
+func (a *softAuthenticator) clientData(ceremony string, challenge string) []byte {
+	data, _ := json.Marshal(clientData{Type: ceremony, Challenge: challenge, Origin: a.origin})
+	return data
+}
+
+func (a *softAuthenticator) authData(flags byte) []byte {
+	rpIdHash := sha256.Sum256([]byte(a.rpId))
+
+	data := append(rpIdHash[:], flags)
+
+	return binary.BigEndian.AppendUint32(data, a.signCount)
+}
+
+// register returns the client data and attestation object for a "none"
+// attestation.
+func (a *softAuthenticator) register(challenge string) ([]byte, []byte) {
+	authData := a.authData(a.flags | flagAttestedCredData)
+	authData = append(authData, make([]byte, 16)...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialId)))
+	authData = append(authData, a.credentialId...)
+	authData = append(authData, a.coseKey()...)
+
+	attestation := encodeCBOR(cborMap{
+		{"fmt", "none"},
+		{"attStmt", cborMap{}},
+		{"authData", authData},
+	})
+
+	return a.clientData(WebAuthnCreate, challenge), attestation
+}
+
+// assert bumps the counter and returns the client data, authenticator data
+// and signature.
+func (a *softAuthenticator) assert(t *testing.T, challenge string) ([]byte, []byte, []byte) {
+	t.Helper()
+
+	a.signCount++
+
+	clientDataJSON := a.clientData(WebAuthnGet, challenge)
+	authData := a.authData(a.flags)
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), authData...), clientDataHash[:]...)
+
+	var signature []byte
+	var err error
+
+	if a.alg == coseES256 {
+		digest := sha256.Sum256(signed)
+		signature, err = a.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	} else {
+		signature, err = a.signer.Sign(rand.Reader, signed, crypto.Hash(0))
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return clientDataJSON, authData, signature
+}
+
+func testWebAuthn() *WebAuthn {
+	return NewWebAuthn("example.com", "Example", []string{"https://example.com"})
+}
+
+func registerSoftAuthenticator(t *testing.T, wa *WebAuthn, a *softAuthenticator) WebAuthnCredential {
+	t.Helper()
+
+	clientDataJSON, attestation := a.register("register-challenge")
+
+	credential, err := wa.VerifyRegistration(clientDataJSON, attestation, "register-challenge")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return credential
+}
+
+func TestWebAuthnCeremonies(t *testing.T) {
+	for name, alg := range map[string]int{"ES256": coseES256, "EdDSA": coseEdDSA} {
+		t.Run(name, func(t *testing.T) {
+			wa := testWebAuthn()
+			a := newSoftAuthenticator(t, alg)
+
+			credential := registerSoftAuthenticator(t, wa, a)
+
+			if string(credential.Id) != string(a.credentialId) || credential.SignCount != 0 {
+				t.Fatalf("unexpected credential %+v", credential)
+			}
+
+			stored := credential.SignCount
+
+			for i := 0; i < 3; i++ {
+				clientDataJSON, authData, signature := a.assert(t, "login-challenge")
+
+				count, err := wa.VerifyAssertion(credential.PublicKey, stored, clientDataJSON, authData, signature, "login-challenge")
+
+				if err != nil {
+					t.Fatalf("assertion %d: %v", i, err)
+				}
+
+				if count != a.signCount {
+					t.Fatalf("assertion %d: counter %d, want %d", i, count, a.signCount)
+				}
+
+				stored = count
+			}
+		})
+	}
+}
+
+func TestWebAuthnAssertionRejectsCounterRegression(t *testing.T) {
+	wa := testWebAuthn()
+	a := newSoftAuthenticator(t, coseES256)
+	credential := registerSoftAuthenticator(t, wa, a)
+
+	// a clone of the authenticator replays a counter the server has seen
+	a.signCount = 5
+	clientDataJSON, authData, signature := a.assert(t, "login-challenge")
+
+	for _, stored := range []uint32{6, 7} {
+		_, err := wa.VerifyAssertion(credential.PublicKey, stored, clientDataJSON, authData, signature, "login-challenge")
+
+		if err == nil || !strings.Contains(err.Error(), "counter") {
+			t.Errorf("counter 6 after %d: got %v, want a counter error", stored, err)
+		}
+	}
+
+	// authenticators without a counter always report 0, which assert's
+	// increment gets to by wrapping around
+	a.signCount = ^uint32(0)
+	clientDataJSON, authData, signature = a.assert(t, "login-challenge")
+
+	if count, err := wa.VerifyAssertion(credential.PublicKey, 0, clientDataJSON, authData, signature, "login-challenge"); err != nil || count != 0 {
+		t.Fatalf("counterless authenticator: %d, %v", count, err)
+	}
+}
+
+func TestWebAuthnAssertionRejections(t *testing.T) {
+	tests := map[string]func(a *softAuthenticator, clientDataJSON, authData, signature []byte) ([]byte, []byte, []byte){
+		"other challenge": func(a *softAuthenticator, _, authData, _ []byte) ([]byte, []byte, []byte) {
+			clientDataJSON := a.clientData(WebAuthnGet, "other-challenge")
+			return clientDataJSON, authData, nil
+		},
+		"registration client data": func(a *softAuthenticator, _, authData, signature []byte) ([]byte, []byte, []byte) {
+			return a.clientData(WebAuthnCreate, "login-challenge"), authData, signature
+		},
+		"tampered authenticator data": func(_ *softAuthenticator, clientDataJSON, authData, signature []byte) ([]byte, []byte, []byte) {
+			authData[36]++
+			return clientDataJSON, authData, signature
+		},
+		"tampered signature": func(_ *softAuthenticator, clientDataJSON, authData, signature []byte) ([]byte, []byte, []byte) {
+			signature[len(signature)-1] ^= 0x01
+			return clientDataJSON, authData, signature
+		},
+	}
+
+	for name, tamper := range tests {
+		wa := testWebAuthn()
+		a := newSoftAuthenticator(t, coseES256)
+		credential := registerSoftAuthenticator(t, wa, a)
+
+		clientDataJSON, authData, signature := a.assert(t, "login-challenge")
+		clientDataJSON, authData, signature = tamper(a, clientDataJSON, authData, signature)
+
+		if _, err := wa.VerifyAssertion(credential.PublicKey, 0, clientDataJSON, authData, signature, "login-challenge"); err == nil {
+			t.Errorf("%s: assertion accepted", name)
+		}
+	}
+}
+
+func TestWebAuthnAssertionRejectsOtherKey(t *testing.T) {
+	wa := testWebAuthn()
+	credential := registerSoftAuthenticator(t, wa, newSoftAuthenticator(t, coseES256))
+
+	other := newSoftAuthenticator(t, coseES256)
+	clientDataJSON, authData, signature := other.assert(t, "login-challenge")
+
+	if _, err := wa.VerifyAssertion(credential.PublicKey, 0, clientDataJSON, authData, signature, "login-challenge"); err == nil {
+		t.Fatal("accepted a signature from another authenticator")
+	}
+}
+
+func TestWebAuthnRegistrationRejections(t *testing.T) {
+	tests := map[string]func(a *softAuthenticator){
+		"other relying party": func(a *softAuthenticator) { a.rpId = "evil.example" },
+		"other origin":        func(a *softAuthenticator) { a.origin = "https://evil.example" },
+		"user not verified":   func(a *softAuthenticator) { a.flags = flagUserPresent },
+		"user not present":    func(a *softAuthenticator) { a.flags = flagUserVerified },
+	}
+
+	for name, change := range tests {
+		wa := testWebAuthn()
+		a := newSoftAuthenticator(t, coseEdDSA)
+		change(a)
+
+		clientDataJSON, attestation := a.register("register-challenge")
+
+		if _, err := wa.VerifyRegistration(clientDataJSON, attestation, "register-challenge"); err == nil {
+			t.Errorf("%s: registration accepted", name)
+		}
+	}
+
+	wa := testWebAuthn()
+	clientDataJSON, attestation := newSoftAuthenticator(t, coseEdDSA).register("register-challenge")
+
+	if _, err := wa.VerifyRegistration(clientDataJSON, attestation, "other-challenge"); err == nil {
+		t.Error("registration accepted for another challenge")
+	}
+}
@@ -0,0 +1,100 @@
+// Package csrf protects cookie authenticated endpoints with double-submit
+// tokens: a random token is kept in a cookie the page can read, and unsafe
+// requests must echo it in the X-CSRF-Token header. Other sites can make the
+// browser send the cookie but can't read it to set the header.
+package csrf
+
+import (
+	"auth-service/internal/cors"
+	"auth-service/pkg/cookie"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	CookieName = "csrfToken"
+	HeaderName = "X-CSRF-Token"
+
+	tokenTTL = 24 * time.Hour
+)
+
+type Protector struct {
+	cookies cookie.Attributes
+	exempt  []string
+}
+
+// NewProtector returns the middleware. Requests to the exempt paths are not
+// checked, for endpoints with their own protection like the OAuth token endpoint.
+func NewProtector(cookies cookie.Attributes, exempt ...string) *Protector {
+	// the page's scripts have to read the token
+	cookies.HttpOnly = false
+
+	return &Protector{cookies: cookies, exempt: exempt}
+}
+
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// Protect rejects unsafe requests without a matching token. Requests that
+// authenticate with a bearer token are exempt: browsers never attach those
+// on their own, so they can't be forged.
+func (p *Protector) Protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if safeMethod(r.Method) || slices.Contains(p.exempt, r.URL.Path) || strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		expected, err := cookie.Read(r, p.cookies.Name(CookieName))
+		actual := r.Header.Get(HeaderName)
+
+		if err != nil || actual == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(actual)) != 1 {
+			cors.EnableCors(&w)
+			http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+type TokenResponse struct {
+	Token string `json:"csrfToken"`
+}
+
+// Token hands out the caller's CSRF token, creating it on the first call.
+// Frontends call it before their first unsafe request.
+func (p *Protector) Token(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	token, err := cookie.Read(r, p.cookies.Name(CookieName))
+
+	if err != nil || token == "" {
+		bytes := make([]byte, 32)
+
+		if _, err := rand.Read(bytes); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		token = base64.RawURLEncoding.EncodeToString(bytes)
+
+		err = cookie.Write(w, p.cookies.New(CookieName, token, tokenTTL))
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	json.NewEncoder(w).Encode(TokenResponse{Token: token})
+}
@@ -0,0 +1,420 @@
+package database
+
+import (
+	"auth-service/internal/entities"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrAccountSuspended = errors.New("account is suspended")
+	ErrCompanyNotFound  = errors.New("company not found")
+)
+
+// users
+
+const adminUserColumns = "id, email, username, fullname, role, company_id, company_role, email_verified_at IS NOT NULL, suspended_at, suspended_reason"
+
+func scanAdminUser(row interface{ Scan(...any) error }) (entities.AdminUser, error) {
+	var user entities.AdminUser
+	var companyId sql.NullInt64
+	var suspendedAt sql.NullTime
+
+	err := row.Scan(&user.Id, &user.Email, &user.Username, &user.Fullname, &user.Role, &companyId, &user.CompanyRole, &user.EmailVerified, &suspendedAt, &user.SuspendedReason)
+
+	if err != nil {
+		return entities.AdminUser{}, err
+	}
+
+	if companyId.Valid {
+		id := int(companyId.Int64)
+		user.CompanyId = &id
+	}
+
+	if suspendedAt.Valid {
+		user.SuspendedAt = &suspendedAt.Time
+	}
+
+	return user, nil
+}
+
+// SearchUsers finds users whose username, email or full name contain the
+// query, newest first. beforeId pages backwards, 0 starts from the newest.
+func (s *PostgresStorage) SearchUsers(query string, beforeId int, limit int) ([]entities.AdminUser, error) {
+	pattern := "%" + escapeLike(query) + "%"
+
+	rows, err := s.db.Query("SELECT "+adminUserColumns+" FROM users WHERE (username ILIKE $1 OR email ILIKE $1 OR fullname ILIKE $1) AND ($2 = 0 OR id < $2) ORDER BY id DESC LIMIT $3", pattern, beforeId, limit)
+
+	if err != nil {
+		return nil, fmt.Errorf("searching users: %v", err)
+	}
+
+	defer rows.Close()
+
+	var users []entities.AdminUser
+
+	for rows.Next() {
+		user, err := scanAdminUser(rows)
+
+		if err != nil {
+			return nil, fmt.Errorf("scanning rows: %v", err)
+		}
+
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+func escapeLike(value string) string {
+	var escaped []rune
+
+	for _, c := range value {
+		if c == '%' || c == '_' || c == '\\' {
+			escaped = append(escaped, '\\')
+		}
+
+		escaped = append(escaped, c)
+	}
+
+	return string(escaped)
+}
+
+func (s *PostgresStorage) GetAdminUser(id int) (entities.AdminUser, error) {
+	user, err := scanAdminUser(s.db.QueryRow("SELECT "+adminUserColumns+" FROM users WHERE id = $1", id))
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entities.AdminUser{}, ErrUserNotFound
+		}
+
+		return entities.AdminUser{}, fmt.Errorf("getting user: %v", err)
+	}
+
+	return user, nil
+}
+
+func (s *PostgresStorage) UpdateUserRole(id int, role string) error {
+	result, err := s.db.Exec("UPDATE users SET role = $1 WHERE id = $2", role, id)
+
+	if err != nil {
+		return fmt.Errorf("updating user role: %v", err)
+	}
+
+	return expectUpdated(result, ErrUserNotFound)
+}
+
+// SuspendUser blocks the account: its sessions, OAuth refresh tokens and
+// personal access tokens are revoked and no new ones are issued until it is
+// unsuspended.
+func (s *PostgresStorage) SuspendUser(id int, reason string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %v", err)
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var result sql.Result
+
+	result, err = tx.Exec("UPDATE users SET suspended_at = COALESCE(suspended_at, LOCALTIMESTAMP), suspended_reason = $1 WHERE id = $2", reason, id)
+
+	if err != nil {
+		return fmt.Errorf("suspending user: %v", err)
+	}
+
+	if err = expectUpdated(result, ErrUserNotFound); err != nil {
+		return err
+	}
+
+	if err = revokeSignIns(tx, id, 0); err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("committing transaction: %v", err)
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) UnsuspendUser(id int) error {
+	result, err := s.db.Exec("UPDATE users SET suspended_at = NULL, suspended_reason = '' WHERE id = $1", id)
+
+	if err != nil {
+		return fmt.Errorf("unsuspending user: %v", err)
+	}
+
+	return expectUpdated(result, ErrUserNotFound)
+}
+
+// ForcePasswordReset makes the current password stop working and stores a
+// reset token, so the user has to choose a new password through the emailed
+// link. The user is signed out everywhere.
+func (s *PostgresStorage) ForcePasswordReset(id int, tokenHash string, ttl time.Duration) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %v", err)
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var result sql.Result
+
+	// an empty hash matches no password
+	result, err = tx.Exec("UPDATE users SET password = '' WHERE id = $1", id)
+
+	if err != nil {
+		return fmt.Errorf("clearing password: %v", err)
+	}
+
+	if err = expectUpdated(result, ErrUserNotFound); err != nil {
+		return err
+	}
+
+	if err = revokeSignIns(tx, id, 0); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM password_reset_tokens WHERE user_id = $1", id)
+
+	if err != nil {
+		return fmt.Errorf("deleting reset tokens: %v", err)
+	}
+
+	_, err = tx.Exec("INSERT INTO password_reset_tokens(token_hash, user_id, expires_at) VALUES ($1, $2, LOCALTIMESTAMP + $3 * INTERVAL '1 second')", tokenHash, id, ttl.Seconds())
+
+	if err != nil {
+		return fmt.Errorf("inserting password reset token: %v", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("committing transaction: %v", err)
+	}
+
+	return nil
+}
+
+// revokeSignIns signs the user out of every session but keepSession, which is
+// 0 to keep none, and out of every OAuth client, and deletes their personal
+// access tokens.
+func revokeSignIns(tx *sql.Tx, userId int, keepSession int) error {
+	_, err := tx.Exec("DELETE FROM user_sessions WHERE user_id = $1 AND id <> $2", userId, keepSession)
+
+	if err != nil {
+		return fmt.Errorf("deleting sessions: %v", err)
+	}
+
+	_, err = tx.Exec("DELETE FROM personal_access_tokens WHERE user_id = $1", userId)
+
+	if err != nil {
+		return fmt.Errorf("deleting personal access tokens: %v", err)
+	}
+
+	_, err = tx.Exec("UPDATE oauth_refresh_tokens SET revoked_at = LOCALTIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL", userId)
+
+	if err != nil {
+		return fmt.Errorf("revoking refresh tokens: %v", err)
+	}
+
+	return nil
+}
+
+func expectUpdated(result sql.Result, notFound error) error {
+	updated, err := result.RowsAffected()
+
+	if err != nil {
+		return fmt.Errorf("getting affected rows: %v", err)
+	}
+
+	if updated == 0 {
+		return notFound
+	}
+
+	return nil
+}
+
+// articles
+
+// ReassignArticles moves articles from one author to another, all of them
+// when articleIds is empty. It returns how many moved.
+func (s *PostgresStorage) ReassignArticles(fromUserId int, toUserId int, articleIds []int) (int64, error) {
+	result, err := s.db.Exec("UPDATE articles SET author_id = $2 WHERE author_id = $1 AND (COALESCE(cardinality($3::int[]), 0) = 0 OR id = ANY($3))", fromUserId, toUserId, pq.Array(articleIds))
+
+	if err != nil {
+		return 0, fmt.Errorf("reassigning articles: %v", err)
+	}
+
+	moved, err := result.RowsAffected()
+
+	if err != nil {
+		return 0, fmt.Errorf("reassigning articles: %v", err)
+	}
+
+	return moved, nil
+}
+
+// companies
+
+// DetachAndDeleteCompany deletes the company. Its members and articles stay,
+// without a company.
+func (s *PostgresStorage) DetachAndDeleteCompany(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %v", err)
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.Exec("UPDATE users SET company_id = NULL, company_role = '', position = '' WHERE company_id = $1", id)
+
+	if err != nil {
+		return fmt.Errorf("detaching members: %v", err)
+	}
+
+	_, err = tx.Exec("UPDATE articles SET company_id = NULL WHERE company_id = $1", id)
+
+	if err != nil {
+		return fmt.Errorf("detaching articles: %v", err)
+	}
+
+	var result sql.Result
+
+	result, err = tx.Exec("DELETE FROM companies WHERE id = $1", id)
+
+	if err != nil {
+		return fmt.Errorf("deleting company: %v", err)
+	}
+
+	if err = expectUpdated(result, ErrCompanyNotFound); err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("committing transaction: %v", err)
+	}
+
+	return nil
+}
+
+// MergeCompanies moves the members, articles and followers of one company
+// into another and deletes the emptied company. Its owner joins as an admin,
+// the target keeps its own owner. Webhooks of the merged company go with it.
+func (s *PostgresStorage) MergeCompanies(fromId int, intoId int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %v", err)
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var exists bool
+
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM companies WHERE id = $1)", intoId).Scan(&exists)
+
+	if err != nil {
+		return fmt.Errorf("checking company: %v", err)
+	}
+
+	if !exists {
+		err = ErrCompanyNotFound
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE users SET company_id = $2, company_role = CASE WHEN company_role = $3 THEN $4 ELSE company_role END WHERE company_id = $1",
+		fromId, intoId, entities.CompanyRoleOwner, entities.CompanyRoleAdmin)
+
+	if err != nil {
+		return fmt.Errorf("moving members: %v", err)
+	}
+
+	_, err = tx.Exec("UPDATE articles SET company_id = $2 WHERE company_id = $1", fromId, intoId)
+
+	if err != nil {
+		return fmt.Errorf("moving articles: %v", err)
+	}
+
+	_, err = tx.Exec("INSERT INTO company_follows(follower_id, company_id, created_at) SELECT follower_id, $2, created_at FROM company_follows WHERE company_id = $1 ON CONFLICT DO NOTHING", fromId, intoId)
+
+	if err != nil {
+		return fmt.Errorf("moving followers: %v", err)
+	}
+
+	var result sql.Result
+
+	result, err = tx.Exec("DELETE FROM companies WHERE id = $1", fromId)
+
+	if err != nil {
+		return fmt.Errorf("deleting company: %v", err)
+	}
+
+	if err = expectUpdated(result, ErrCompanyNotFound); err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("committing transaction: %v", err)
+	}
+
+	return nil
+}
+
+// maintenance
+
+// Migrate runs the schema script. Its statements only create tables and add
+// columns that are missing, and backfill a new column when they add it, so
+// running it on an up to date database changes nothing.
+func (s *PostgresStorage) Migrate(schema string) error {
+	_, err := s.db.Exec(schema)
+
+	if err != nil {
+		return fmt.Errorf("running schema: %v", err)
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) GetStats() (entities.Stats, error) {
+	var stats entities.Stats
+
+	err := s.db.QueryRow(`SELECT
+		(SELECT COUNT(*) FROM users),
+		(SELECT COUNT(*) FROM users WHERE role = $1),
+		(SELECT COUNT(*) FROM users WHERE suspended_at IS NOT NULL),
+		(SELECT COUNT(*) FROM users WHERE email_verified_at IS NULL),
+		(SELECT COUNT(*) FROM companies),
+		(SELECT COUNT(*) FROM articles),
+		(SELECT COUNT(*) FROM user_sessions WHERE expires_at > LOCALTIMESTAMP),
+		(SELECT COUNT(*) FROM audit_events)`, entities.RoleAdmin).
+		Scan(&stats.Users, &stats.Admins, &stats.SuspendedUsers, &stats.UnverifiedUsers, &stats.Companies, &stats.Articles, &stats.ActiveSessions, &stats.AuditEvents)
+
+	if err != nil {
+		return entities.Stats{}, fmt.Errorf("getting stats: %v", err)
+	}
+
+	return stats, nil
+}
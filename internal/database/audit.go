@@ -0,0 +1,146 @@
+package database
+
+import (
+	"auth-service/internal/entities"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func (s *PostgresStorage) InsertAuditEvent(event entities.AuditEvent) error {
+	_, err := s.db.Exec("INSERT INTO audit_events(actor_id, action, target_type, target_id, before, after, ip, request_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		event.ActorId, event.Action, event.TargetType, event.TargetId, nullJSON(event.Before), nullJSON(event.After), event.Ip, event.RequestId)
+
+	if err != nil {
+		return fmt.Errorf("inserting audit event: %v", err)
+	}
+
+	return nil
+}
+
+// nullJSON stores missing diffs as NULL rather than as invalid empty JSON.
+func nullJSON(value []byte) any {
+	if len(value) == 0 {
+		return nil
+	}
+
+	return string(value)
+}
+
+const auditEventColumns = "id, actor_id, action, target_type, target_id, before, after, ip, request_id, created_at"
+
+// auditEventQuery builds the query for the filter, newest events first.
+func auditEventQuery(filter entities.AuditEventFilter) (string, []any) {
+	var conditions []string
+	var args []any
+
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.ReplaceAll(condition, "?", "$"+strconv.Itoa(len(args))))
+	}
+
+	if filter.ActorId != 0 {
+		add("actor_id = ?", filter.ActorId)
+	}
+
+	if filter.Action != "" {
+		add("action = ?", filter.Action)
+	}
+
+	if filter.TargetType != "" {
+		add("target_type = ?", filter.TargetType)
+	}
+
+	if filter.TargetId != "" {
+		add("target_id = ?", filter.TargetId)
+	}
+
+	if !filter.From.IsZero() {
+		add("created_at >= ?", filter.From)
+	}
+
+	if !filter.To.IsZero() {
+		add("created_at < ?", filter.To)
+	}
+
+	if filter.BeforeId != 0 {
+		add("id < ?", filter.BeforeId)
+	}
+
+	query := "SELECT " + auditEventColumns + " FROM audit_events"
+
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query += " ORDER BY id DESC"
+
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += " LIMIT $" + strconv.Itoa(len(args))
+	}
+
+	return query, args
+}
+
+func scanAuditEvent(rows *sql.Rows) (entities.AuditEvent, error) {
+	var event entities.AuditEvent
+	var actorId sql.NullInt64
+	var before, after []byte
+
+	err := rows.Scan(&event.Id, &actorId, &event.Action, &event.TargetType, &event.TargetId, &before, &after, &event.Ip, &event.RequestId, &event.CreatedAt)
+
+	if err != nil {
+		return entities.AuditEvent{}, err
+	}
+
+	if actorId.Valid {
+		id := int(actorId.Int64)
+		event.ActorId = &id
+	}
+
+	event.Before = before
+	event.After = after
+
+	return event, nil
+}
+
+func (s *PostgresStorage) GetAuditEvents(filter entities.AuditEventFilter) ([]entities.AuditEvent, error) {
+	var events []entities.AuditEvent
+
+	err := s.EachAuditEvent(filter, func(event entities.AuditEvent) error {
+		events = append(events, event)
+		return nil
+	})
+
+	return events, err
+}
+
+// EachAuditEvent streams the matching events to fn, for exports too large to
+// hold in memory. It stops at the first error fn returns.
+func (s *PostgresStorage) EachAuditEvent(filter entities.AuditEventFilter, fn func(entities.AuditEvent) error) error {
+	query, args := auditEventQuery(filter)
+
+	rows, err := s.db.Query(query, args...)
+
+	if err != nil {
+		return fmt.Errorf("getting audit events: %v", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+
+		if err != nil {
+			return fmt.Errorf("scanning rows: %v", err)
+		}
+
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
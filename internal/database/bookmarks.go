@@ -0,0 +1,279 @@
+package database
+
+import (
+	"auth-service/internal/entities"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrReadingListNotFound = errors.New("reading list not found")
+	ErrInvalidOrder        = errors.New("order must list every article of the reading list exactly once")
+)
+
+// bookmarks
+
+func (s *PostgresStorage) AddBookmark(userId int, articleId int) error {
+	_, err := s.db.Exec("INSERT INTO bookmarks(user_id, article_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", userId, articleId)
+
+	if err != nil {
+		return fmt.Errorf("adding bookmark: %v", err)
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) RemoveBookmark(userId int, articleId int) error {
+	_, err := s.db.Exec("DELETE FROM bookmarks WHERE user_id = $1 AND article_id = $2", userId, articleId)
+
+	if err != nil {
+		return fmt.Errorf("removing bookmark: %v", err)
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) GetBookmarks(userId int) ([]entities.Article, error) {
+	rows, err := s.db.Query(`SELECT `+articleColumns+` FROM articles a
+		JOIN bookmarks b ON b.article_id = a.id
+		WHERE b.user_id = $1
+		ORDER BY b.created_at DESC`, userId)
+
+	if err != nil {
+		return nil, fmt.Errorf("getting bookmarks: %v", err)
+	}
+
+	defer rows.Close()
+
+	articles, err := scanArticles(rows)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range articles {
+		articles[i].Bookmarked = true
+	}
+
+	return s.attachTags(articles)
+}
+
+// MarkBookmarked sets Bookmarked on the articles the user has bookmarked.
+func (s *PostgresStorage) MarkBookmarked(userId int, articles []entities.Article) ([]entities.Article, error) {
+	if len(articles) == 0 {
+		return articles, nil
+	}
+
+	ids := make([]int64, len(articles))
+
+	for i, article := range articles {
+		ids[i] = int64(article.Id)
+	}
+
+	rows, err := s.db.Query("SELECT article_id FROM bookmarks WHERE user_id = $1 AND article_id = ANY($2)", userId, pq.Array(ids))
+
+	if err != nil {
+		return nil, fmt.Errorf("querying bookmarks: %v", err)
+	}
+
+	defer rows.Close()
+
+	bookmarked := make(map[int]bool)
+
+	for rows.Next() {
+		var articleId int
+
+		if err := rows.Scan(&articleId); err != nil {
+			return nil, fmt.Errorf("scanning rows: %v", err)
+		}
+
+		bookmarked[articleId] = true
+	}
+
+	for i := range articles {
+		articles[i].Bookmarked = bookmarked[articles[i].Id]
+	}
+
+	return articles, rows.Err()
+}
+
+// reading lists
+
+func (s *PostgresStorage) InsertReadingList(list entities.ReadingList) (int, error) {
+	var id int
+
+	err := s.db.QueryRow("INSERT INTO reading_lists(user_id, name, is_public) VALUES ($1, $2, $3) RETURNING id", list.UserId, list.Name, list.IsPublic).Scan(&id)
+
+	if err != nil {
+		return 0, fmt.Errorf("inserting reading list: %v", err)
+	}
+
+	return id, nil
+}
+
+func (s *PostgresStorage) GetReadingListsByUserId(userId int, includePrivate bool) ([]entities.ReadingList, error) {
+	rows, err := s.db.Query("SELECT id, user_id, name, is_public, created_at FROM reading_lists WHERE user_id = $1 AND (is_public OR $2) ORDER BY created_at", userId, includePrivate)
+
+	if err != nil {
+		return nil, fmt.Errorf("getting reading lists: %v", err)
+	}
+
+	defer rows.Close()
+
+	var lists []entities.ReadingList
+
+	for rows.Next() {
+		var list entities.ReadingList
+
+		err := rows.Scan(&list.Id, &list.UserId, &list.Name, &list.IsPublic, &list.CreatedAt)
+
+		if err != nil {
+			return nil, fmt.Errorf("scanning rows: %v", err)
+		}
+
+		lists = append(lists, list)
+	}
+
+	return lists, rows.Err()
+}
+
+// GetReadingListById returns the list together with its articles in the owner's order.
+func (s *PostgresStorage) GetReadingListById(id int) (entities.ReadingList, error) {
+	var list entities.ReadingList
+
+	err := s.db.QueryRow("SELECT id, user_id, name, is_public, created_at FROM reading_lists WHERE id = $1", id).Scan(&list.Id, &list.UserId, &list.Name, &list.IsPublic, &list.CreatedAt)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entities.ReadingList{}, ErrReadingListNotFound
+		}
+
+		return entities.ReadingList{}, fmt.Errorf("getting reading list: %v", err)
+	}
+
+	rows, err := s.db.Query(`SELECT `+articleColumns+` FROM articles a
+		JOIN reading_list_items i ON i.article_id = a.id
+		WHERE i.list_id = $1
+		ORDER BY i.position`, id)
+
+	if err != nil {
+		return entities.ReadingList{}, fmt.Errorf("getting reading list articles: %v", err)
+	}
+
+	defer rows.Close()
+
+	articles, err := scanArticles(rows)
+
+	if err != nil {
+		return entities.ReadingList{}, err
+	}
+
+	list.Articles, err = s.attachTags(articles)
+
+	if err != nil {
+		return entities.ReadingList{}, err
+	}
+
+	return list, nil
+}
+
+func (s *PostgresStorage) UpdateReadingList(id int, list entities.ReadingList) error {
+	_, err := s.db.Exec("UPDATE reading_lists SET name = $1, is_public = $2 WHERE id = $3", list.Name, list.IsPublic, id)
+
+	if err != nil {
+		return fmt.Errorf("updating reading list: %v", err)
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) DeleteReadingList(id int) error {
+	_, err := s.db.Exec("DELETE FROM reading_lists WHERE id = $1", id)
+
+	if err != nil {
+		return fmt.Errorf("deleting reading list: %v", err)
+	}
+
+	return nil
+}
+
+// AddReadingListArticle appends the article to the end of the list.
+func (s *PostgresStorage) AddReadingListArticle(listId int, articleId int) error {
+	_, err := s.db.Exec(`INSERT INTO reading_list_items(list_id, article_id, position)
+		SELECT $1, $2, COALESCE(MAX(position), 0) + 1 FROM reading_list_items WHERE list_id = $1
+		ON CONFLICT DO NOTHING`, listId, articleId)
+
+	if err != nil {
+		return fmt.Errorf("adding article to reading list: %v", err)
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) RemoveReadingListArticle(listId int, articleId int) error {
+	_, err := s.db.Exec("DELETE FROM reading_list_items WHERE list_id = $1 AND article_id = $2", listId, articleId)
+
+	if err != nil {
+		return fmt.Errorf("removing article from reading list: %v", err)
+	}
+
+	return nil
+}
+
+// ReorderReadingList sets the positions of the list items to the order of articleIds.
+func (s *PostgresStorage) ReorderReadingList(listId int, articleIds []int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %v", err)
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var count int
+
+	err = tx.QueryRow("SELECT COUNT(*) FROM reading_list_items WHERE list_id = $1", listId).Scan(&count)
+
+	if err != nil {
+		return fmt.Errorf("counting reading list items: %v", err)
+	}
+
+	ids := make([]int64, len(articleIds))
+
+	for i, id := range articleIds {
+		ids[i] = int64(id)
+	}
+
+	result, err := tx.Exec(`UPDATE reading_list_items i SET position = o.position
+		FROM unnest($2::int[]) WITH ORDINALITY AS o(article_id, position)
+		WHERE i.list_id = $1 AND i.article_id = o.article_id`, listId, pq.Array(ids))
+
+	if err != nil {
+		return fmt.Errorf("reordering reading list: %v", err)
+	}
+
+	updated, err := result.RowsAffected()
+
+	if err != nil {
+		return fmt.Errorf("reordering reading list: %v", err)
+	}
+
+	// duplicates or foreign ids in articleIds leave some rows untouched
+	if int(updated) != count || len(articleIds) != count {
+		err = ErrInvalidOrder
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("committing transaction: %v", err)
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"auth-service/internal/entities"
+	"auth-service/internal/events"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -10,6 +11,13 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+var (
+	ErrUserNotFound    = errors.New("user not found")
+	ErrEmailExists     = errors.New("email already exists")
+	ErrUsernameExists  = errors.New("username already exists")
+	ErrArticleNotFound = errors.New("article not found")
+)
+
 type PostgresStorage struct {
 	db *sql.DB
 }
@@ -64,6 +72,10 @@ func (s *PostgresStorage) GetUsers() ([]entities.User, error) {
 }
 
 func (s *PostgresStorage) InsertUser(user entities.User) (int, error) {
+	if err := checkReserved(user); err != nil {
+		return 0, err
+	}
+
 	tx, err := s.db.Begin()
 	if err != nil {
 		return 0, fmt.Errorf("beginning transaction: %v", err)
@@ -83,9 +95,9 @@ func (s *PostgresStorage) InsertUser(user entities.User) (int, error) {
 		if pqErr, ok := err.(*pq.Error); ok {
 			if pqErr.Code == "23505" {
 				if pqErr.Constraint == "users_email_key" {
-					return 0, errors.New("email already exists")
+					return 0, ErrEmailExists
 				} else if pqErr.Constraint == "users_username_key" {
-					return 0, errors.New("username already exists")
+					return 0, ErrUsernameExists
 				}
 			}
 		}
@@ -93,6 +105,17 @@ func (s *PostgresStorage) InsertUser(user entities.User) (int, error) {
 		return 0, fmt.Errorf("running transaction: %v", err)
 	}
 
+	err = insertOutboxEvent(tx, events.AggregateUser, userId, events.UserCreated, events.UserCreatedPayload{
+		Id:       userId,
+		Email:    user.Email,
+		Username: user.Username,
+		Fullname: user.Fullname,
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		return 0, fmt.Errorf("committing transaction: %v", err)
@@ -102,7 +125,7 @@ func (s *PostgresStorage) InsertUser(user entities.User) (int, error) {
 }
 
 func (s *PostgresStorage) GetUserById(id int) (entities.User, error) {
-	rows, err := s.db.Query("SELECT id, email, username, fullname, position, company_id, avatar_url FROM users WHERE id = $1", id)
+	rows, err := s.db.Query("SELECT id, email, username, fullname, position, company_id, company_role, avatar_url, email_verified_at IS NOT NULL FROM users WHERE id = $1", id)
 
 	if err != nil {
 		return entities.User{}, fmt.Errorf("getting user by id: %v", err)
@@ -113,20 +136,20 @@ func (s *PostgresStorage) GetUserById(id int) (entities.User, error) {
 	var user entities.User
 
 	if rows.Next() {
-		err := rows.Scan(&user.Id, &user.Email, &user.Username, &user.Fullname, &user.Position, &user.CompanyId, &user.AvatarUrl)
+		err := rows.Scan(&user.Id, &user.Email, &user.Username, &user.Fullname, &user.Position, &user.CompanyId, &user.CompanyRole, &user.AvatarUrl, &user.EmailVerified)
 
 		if err != nil {
 			return entities.User{}, fmt.Errorf("scanning rows: %v", err)
 		}
 	} else {
-		return entities.User{}, fmt.Errorf("user not found")
+		return entities.User{}, ErrUserNotFound
 	}
 
 	return user, nil
 }
 
 func (s *PostgresStorage) GetUserByUsername(username string) (entities.User, error) { //TODO: get whole user or passworl only
-	rows, err := s.db.Query("SELECT * FROM users WHERE username = $1", username)
+	rows, err := s.db.Query("SELECT id, username, email, password, fullname, company_id, position, avatar_url FROM users WHERE username = $1", username)
 
 	if err != nil {
 		return entities.User{}, fmt.Errorf("getting user: %v", err)
@@ -143,24 +166,63 @@ func (s *PostgresStorage) GetUserByUsername(username string) (entities.User, err
 			return entities.User{}, fmt.Errorf("scanning rows: %v", err)
 		}
 	} else {
-		return entities.User{}, fmt.Errorf("user not found")
+		return entities.User{}, ErrUserNotFound
 	}
 
 	return user, nil
 }
 
+func (s *PostgresStorage) GetUserRole(id int) (string, error) {
+	var role string
+
+	err := s.db.QueryRow("SELECT role FROM users WHERE id = $1", id).Scan(&role)
+
+	if err != nil {
+		return "", fmt.Errorf("getting user role: %v", err)
+	}
+
+	return role, nil
+}
+
 func (s *PostgresStorage) UpdateUserCompanyInfo(userId int, companyId int, position string) error {
-	_, err := s.db.Exec("UPDATE users SET company_id = $1, position = $2 WHERE id = $3", companyId, position, userId)
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %v", err)
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.Exec("UPDATE users SET company_id = $1, position = $2, company_role = $3 WHERE id = $4", companyId, position, entities.CompanyRoleMember, userId)
 
 	if err != nil {
 		return fmt.Errorf("updating user company info: %v", err)
 	}
 
+	err = insertOutboxEvent(tx, events.AggregateCompany, companyId, events.MemberJoined, events.MemberJoinedPayload{
+		CompanyId: companyId,
+		UserId:    userId,
+		Position:  position,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("committing transaction: %v", err)
+	}
+
 	return nil
 }
 
+// UpdateUser overwrites the profile. A new email address has to be verified again.
 func (s *PostgresStorage) UpdateUser(id int, user entities.User) error {
-	_, err := s.db.Exec("UPDATE users SET email = $1, username = $2, fullname = $3, company_id = $4, avatar_url = $5 WHERE id = $6", user.Email, user.Username, user.Fullname, user.CompanyId, user.AvatarUrl, id)
+	_, err := s.db.Exec("UPDATE users SET email = $1, username = $2, fullname = $3, company_id = $4, avatar_url = $5, email_verified_at = CASE WHEN email = $1 THEN email_verified_at END WHERE id = $6", user.Email, user.Username, user.Fullname, user.CompanyId, user.AvatarUrl, id)
 
 	if err != nil {
 		return fmt.Errorf("updating user: %v", err)
@@ -179,29 +241,62 @@ func (s *PostgresStorage) UpdateUserPhoto(photoUrl string, id int) error {
 	return nil
 }
 
-func (s *PostgresStorage) DeleteUser(id int) error {
-	_, err := s.db.Exec("DELETE FROM users WHERE id = $1", id)
+// articles
+const articleColumns = "a.id, a.author_id, COALESCE(a.company_id, 0), a.title, a.text, COALESCE(a.cover_url, ''), a.rating, a.created_at"
+
+func scanArticles(rows *sql.Rows) ([]entities.Article, error) {
+	var articles []entities.Article
 
-	if err != nil {
-		return fmt.Errorf("deleting user %v", err)
+	for rows.Next() {
+		var article entities.Article
+
+		err := rows.Scan(&article.Id, &article.AuthorId, &article.CompanyId, &article.Title, &article.Text, &article.CoverUrl, &article.Rating, &article.CreatedAt)
+
+		if err != nil {
+			return nil, fmt.Errorf("scanning rows: %v", err)
+		}
+
+		articles = append(articles, article)
 	}
 
-	return nil
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating rows: %v", err)
+	}
+
+	return articles, nil
 }
 
-// articles
-func (s *PostgresStorage) GetArticles(sortBy string) ([]entities.Article, error) {
-	// var orderBy string
+func (s *PostgresStorage) GetArticles(sortBy string, tags []string) ([]entities.Article, error) {
+	orderBy := "DESC"
+
+	if sortBy == "oldest" {
+		orderBy = "ASC"
+	}
 
-	// switch sortBy {
-	// case "newest":
-	// 	orderBy = "DESC"
-	// case "oldest":
-	// 	orderBy = "ASC"
-	// }
+	var rows *sql.Rows
+	var err error
 
-	// rows, err := s.db.Query("SELECT id, author_id, company_id, title, text, rating FROM articles ORDER_BY created_at $1", orderBy)
-	rows, err := s.db.Query("SELECT id, author_id, company_id, title, text, rating FROM articles")
+	if len(tags) == 0 {
+		rows, err = s.db.Query("SELECT " + articleColumns + " FROM articles a ORDER BY a.created_at " + orderBy + ", a.id " + orderBy)
+	} else {
+		var slugs []string
+
+		slugs, err = filterSlugs(tags)
+
+		if err != nil {
+			return nil, err
+		}
+
+		rows, err = s.db.Query(`SELECT `+articleColumns+` FROM articles a
+			WHERE a.id IN (
+				SELECT at.article_id FROM article_tags at
+				JOIN tags t ON t.id = at.tag_id
+				WHERE t.slug = ANY($1)
+				GROUP BY at.article_id
+				HAVING COUNT(DISTINCT t.id) = $2
+			)
+			ORDER BY a.created_at `+orderBy+`, a.id `+orderBy, pq.Array(slugs), len(slugs))
+	}
 
 	if err != nil {
 		return nil, fmt.Errorf("querying articles: %v", err)
@@ -209,45 +304,68 @@ func (s *PostgresStorage) GetArticles(sortBy string) ([]entities.Article, error)
 
 	defer rows.Close()
 
-	var articles []entities.Article
+	articles, err := scanArticles(rows)
 
-	for rows.Next() {
-		var article entities.Article
+	if err != nil {
+		return nil, err
+	}
 
-		err := rows.Scan(&article.Id, &article.AuthorId, &article.CompanyId, &article.Title, &article.Text, &article.Rating)
+	return s.attachTags(articles)
+}
 
+func (s *PostgresStorage) InsertArticle(article entities.Article) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("beginning transaction: %v", err)
+	}
+
+	defer func() {
 		if err != nil {
-			return nil, fmt.Errorf("scanning rows: %v", err)
+			tx.Rollback()
 		}
+	}()
 
-		articles = append(articles, article)
+	var articleId int
+
+	err = tx.QueryRow("INSERT INTO articles(author_id, company_id, title, text, rating, cover_url) VALUES ($1, NULLIF($2, 0), $3, $4, $5, $6) RETURNING id", article.AuthorId, article.CompanyId, article.Title, article.Text, article.Rating, article.CoverUrl).Scan(&articleId)
+
+	if err != nil {
+		return 0, fmt.Errorf("inserting article: %v", err)
 	}
 
-	return articles, nil
+	err = setArticleTags(tx, articleId, article.Tags)
 
-}
+	if err != nil {
+		return 0, err
+	}
 
-func (s *PostgresStorage) InsertArticle(article entities.Article) error {
-	if article.CompanyId != 0 {
-		_, err := s.db.Exec("INSERT INTO articles(author_id, company_id, title, text, rating, cover_url) VALUES ($1, $2, $3, $4, $5, $6)", article.AuthorId, article.CompanyId, article.Title, article.Text, article.Rating, article.CoverUrl)
+	companyId, err := articleCompanyId(tx, articleId)
 
-		if err != nil {
-			return fmt.Errorf("inserting article: %v", err)
-		}
+	if err != nil {
+		return 0, err
+	}
 
-	} else {
-		_, err := s.db.Exec("INSERT INTO articles(author_id, title, text, rating, cover_url) VALUES ($1, $2, $3, $4, $5)", article.AuthorId, article.Title, article.Text, article.Rating, article.CoverUrl)
+	err = insertOutboxEvent(tx, events.AggregateArticle, articleId, events.ArticlePublished, events.ArticlePayload{
+		Id:        articleId,
+		AuthorId:  article.AuthorId,
+		CompanyId: companyId,
+		Title:     article.Title,
+	})
 
-		if err != nil {
-			return fmt.Errorf("inserting article: %v", err)
-		}
+	if err != nil {
+		return 0, err
 	}
 
-	return nil
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("committing transaction: %v", err)
+	}
+
+	return articleId, nil
 }
 
 func (s *PostgresStorage) GetArticleById(id int) (entities.Article, error) {
-	rows, err := s.db.Query("SELECT * FROM articles WHERE id = $1", id)
+	rows, err := s.db.Query("SELECT "+articleColumns+" FROM articles a WHERE a.id = $1", id)
 
 	if err != nil {
 		return entities.Article{}, fmt.Errorf("getting article by id: %v", err)
@@ -255,23 +373,27 @@ func (s *PostgresStorage) GetArticleById(id int) (entities.Article, error) {
 
 	defer rows.Close()
 
-	var article entities.Article
+	articles, err := scanArticles(rows)
 
-	if rows.Next() {
-		err := rows.Scan(&article.Id, &article.AuthorId, &article.Title, &article.Text, &article.Rating, &article.CreatedAt)
+	if err != nil {
+		return entities.Article{}, err
+	}
 
-		if err != nil {
-			return entities.Article{}, fmt.Errorf("scanning rows: %v", err)
-		}
-	} else {
-		return entities.Article{}, fmt.Errorf("article not found")
+	if len(articles) == 0 {
+		return entities.Article{}, ErrArticleNotFound
 	}
 
-	return article, nil
+	articles, err = s.attachTags(articles)
+
+	if err != nil {
+		return entities.Article{}, err
+	}
+
+	return articles[0], nil
 }
 
 func (s *PostgresStorage) GetArticlesByAuthorId(authorId int) ([]entities.Article, error) {
-	rows, err := s.db.Query("SELECT * FROM articles WHERE author_id = $1", authorId)
+	rows, err := s.db.Query("SELECT "+articleColumns+" FROM articles a WHERE a.author_id = $1 ORDER BY a.created_at DESC, a.id DESC", authorId)
 
 	if err != nil {
 		return nil, fmt.Errorf("getting articles by authorId: %v", err)
@@ -279,25 +401,17 @@ func (s *PostgresStorage) GetArticlesByAuthorId(authorId int) ([]entities.Articl
 
 	defer rows.Close()
 
-	var articles []entities.Article
-
-	for rows.Next() {
-		var article entities.Article
-
-		err := rows.Scan(&article.Id, &article.AuthorId, &article.CompanyId, &article.Title, &article.Text, &article.Rating)
-
-		if err != nil {
-			return nil, fmt.Errorf("scanning rows: %v", err)
-		}
+	articles, err := scanArticles(rows)
 
-		articles = append(articles, article)
+	if err != nil {
+		return nil, err
 	}
 
-	return articles, nil
+	return s.attachTags(articles)
 }
 
-func (s *PostgresStorage) GetArticlesByCompanyId(authorId int) ([]entities.Article, error) {
-	rows, err := s.db.Query("SELECT * FROM articles WHERE company_id = $1", authorId)
+func (s *PostgresStorage) GetArticlesByCompanyId(companyId int) ([]entities.Article, error) {
+	rows, err := s.db.Query("SELECT "+articleColumns+" FROM articles a WHERE a.company_id = $1 ORDER BY a.created_at DESC, a.id DESC", companyId)
 
 	if err != nil {
 		return nil, fmt.Errorf("getting articles by companyId: %v", err)
@@ -305,43 +419,128 @@ func (s *PostgresStorage) GetArticlesByCompanyId(authorId int) ([]entities.Artic
 
 	defer rows.Close()
 
-	var articles []entities.Article
+	articles, err := scanArticles(rows)
 
-	for rows.Next() {
-		var article entities.Article
+	if err != nil {
+		return nil, err
+	}
 
-		err := rows.Scan(&article.Id, &article.AuthorId, &article.CompanyId, &article.Title, &article.Text, &article.Rating)
+	return s.attachTags(articles)
+}
 
+func (s *PostgresStorage) UpdateArticle(id int, article entities.Article) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %v", err)
+	}
+
+	defer func() {
 		if err != nil {
-			return nil, fmt.Errorf("scanning rows: %v", err)
+			tx.Rollback()
 		}
+	}()
 
-		articles = append(articles, article)
+	_, err = tx.Exec("UPDATE articles SET author_id = $1, company_id = NULLIF($2, 0), title = $3, text = $4, rating = $5 WHERE id = $6", article.AuthorId, article.CompanyId, article.Title, article.Text, article.Rating, id)
+
+	if err != nil {
+		return fmt.Errorf("updating article: %v", err)
 	}
 
-	return articles, nil
-}
+	// nil tags mean the client did not send them, so the current ones are kept
+	if article.Tags != nil {
+		err = setArticleTags(tx, id, article.Tags)
 
-func (s *PostgresStorage) UpdateArticle(id int, article entities.Article) error {
-	_, err := s.db.Exec("UPDATE articles SET id = $1, author_id = $2, company_id = $3, title = $4, text = $5, rating = $6 WHERE id = $7", article.Id, article.AuthorId, article.CompanyId, article.Title, article.Text, article.Rating, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	companyId, err := articleCompanyId(tx, id)
 
 	if err != nil {
-		return fmt.Errorf("updating article: %v", err)
+		return err
+	}
+
+	err = insertOutboxEvent(tx, events.AggregateArticle, id, events.ArticleUpdated, events.ArticlePayload{
+		Id:        id,
+		AuthorId:  article.AuthorId,
+		CompanyId: companyId,
+		Title:     article.Title,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("committing transaction: %v", err)
 	}
 
 	return nil
 }
 
 func (s *PostgresStorage) DeleteArticle(id int) error {
-	_, err := s.db.Exec("DELETE FROM articles WHERE id = $1", id)
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %v", err)
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// the company has to be resolved before the row is gone
+	companyId, err := articleCompanyId(tx, id)
+
+	if err != nil {
+		return err
+	}
+
+	var payload events.ArticlePayload
+
+	err = tx.QueryRow("DELETE FROM articles WHERE id = $1 RETURNING id, author_id, title", id).Scan(&payload.Id, &payload.AuthorId, &payload.Title)
 
 	if err != nil {
 		return fmt.Errorf("deleting article: %v", err)
 	}
 
+	payload.CompanyId = companyId
+
+	err = insertOutboxEvent(tx, events.AggregateArticle, id, events.ArticleDeleted, payload)
+
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("committing transaction: %v", err)
+	}
+
 	return nil
 }
 
+// articleCompanyId returns the company of the article, falling back to the
+// author's company for articles that were not published on behalf of one.
+func articleCompanyId(tx *sql.Tx, articleId int) (int, error) {
+	var companyId int
+
+	err := tx.QueryRow("SELECT COALESCE(a.company_id, u.company_id, 0) FROM articles a JOIN users u ON u.id = a.author_id WHERE a.id = $1", articleId).Scan(&companyId)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrArticleNotFound
+		}
+
+		return 0, fmt.Errorf("getting article company: %v", err)
+	}
+
+	return companyId, nil
+}
+
 // companies
 func (s *PostgresStorage) GetCompanies() ([]entities.Company, error) {
 	rows, err := s.db.Query("SELECT id, name, description, website, logo_url FROM companies")
@@ -390,12 +589,22 @@ func (s *PostgresStorage) InsertCompany(company entities.Company, userId int, po
 
 	log.Debug().Msgf("position: %v", position)
 
-	_, err = tx.Exec("UPDATE users SET company_id = $1, position = $2 WHERE id = $3", companyId, position, userId)
+	_, err = tx.Exec("UPDATE users SET company_id = $1, position = $2, company_role = $3 WHERE id = $4", companyId, position, entities.CompanyRoleOwner, userId)
 
 	if err != nil {
 		return fmt.Errorf("updating user: %v", err)
 	}
 
+	err = insertOutboxEvent(tx, events.AggregateCompany, companyId, events.CompanyCreated, events.CompanyCreatedPayload{
+		Id:      companyId,
+		Name:    company.Name,
+		OwnerId: userId,
+	})
+
+	if err != nil {
+		return err
+	}
+
 	err = tx.Commit()
 
 	if err != nil {
@@ -473,6 +682,16 @@ func (s *PostgresStorage) UpdateCompany(id int, company entities.Company) error
 	return nil
 }
 
+func (s *PostgresStorage) UpdateCompanyKey(id int, key string) error {
+	_, err := s.db.Exec("UPDATE companies SET key = $1 WHERE id = $2", key, id)
+
+	if err != nil {
+		return fmt.Errorf("updating company key: %v", err)
+	}
+
+	return nil
+}
+
 func (s *PostgresStorage) DeleteCompany(id int) error {
 	_, err := s.db.Exec("DELETE FROM companies WHERE id = $1", id)
 
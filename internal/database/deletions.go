@@ -0,0 +1,304 @@
+package database
+
+import (
+	"auth-service/internal/entities"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrDeletionNotFound = errors.New("no deletion scheduled")
+	ErrDeletionNotDue   = errors.New("deletion is not due or is being processed")
+)
+
+const (
+	deletedUserUsername = "deleted-user"
+	deletedUserEmail    = "deleted-user@invalid"
+	deletedUserFullname = "Deleted user"
+)
+
+// ScheduleAccountDeletion plans the deletion of the account after the delay.
+// Scheduling again replaces the earlier plan.
+func (s *PostgresStorage) ScheduleAccountDeletion(deletion entities.AccountDeletion, delay time.Duration) (entities.AccountDeletion, error) {
+	err := s.db.QueryRow(`INSERT INTO account_deletions(user_id, strategy, reassign_to, requested_by, scheduled_at) VALUES ($1, $2, $3, $4, LOCALTIMESTAMP + $5 * INTERVAL '1 second')
+		ON CONFLICT (user_id) DO UPDATE SET strategy = EXCLUDED.strategy, reassign_to = EXCLUDED.reassign_to, requested_by = EXCLUDED.requested_by, scheduled_at = EXCLUDED.scheduled_at
+		RETURNING scheduled_at, created_at`,
+		deletion.UserId, deletion.Strategy, deletion.ReassignTo, deletion.RequestedBy, delay.Seconds()).Scan(&deletion.ScheduledAt, &deletion.CreatedAt)
+
+	if err != nil {
+		var pqErr *pq.Error
+
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			return entities.AccountDeletion{}, ErrUserNotFound
+		}
+
+		return entities.AccountDeletion{}, fmt.Errorf("scheduling account deletion: %v", err)
+	}
+
+	return deletion, nil
+}
+
+const deletionColumns = "user_id, strategy, reassign_to, requested_by, scheduled_at, created_at"
+
+func scanDeletion(row interface{ Scan(...any) error }) (entities.AccountDeletion, error) {
+	var deletion entities.AccountDeletion
+	var reassignTo, requestedBy sql.NullInt64
+
+	err := row.Scan(&deletion.UserId, &deletion.Strategy, &reassignTo, &requestedBy, &deletion.ScheduledAt, &deletion.CreatedAt)
+
+	if err != nil {
+		return entities.AccountDeletion{}, err
+	}
+
+	if reassignTo.Valid {
+		id := int(reassignTo.Int64)
+		deletion.ReassignTo = &id
+	}
+
+	if requestedBy.Valid {
+		id := int(requestedBy.Int64)
+		deletion.RequestedBy = &id
+	}
+
+	return deletion, nil
+}
+
+func (s *PostgresStorage) GetAccountDeletion(userId int) (entities.AccountDeletion, error) {
+	deletion, err := scanDeletion(s.db.QueryRow("SELECT "+deletionColumns+" FROM account_deletions WHERE user_id = $1", userId))
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entities.AccountDeletion{}, ErrDeletionNotFound
+		}
+
+		return entities.AccountDeletion{}, fmt.Errorf("getting account deletion: %v", err)
+	}
+
+	return deletion, nil
+}
+
+func (s *PostgresStorage) CancelAccountDeletion(userId int) error {
+	result, err := s.db.Exec("DELETE FROM account_deletions WHERE user_id = $1", userId)
+
+	if err != nil {
+		return fmt.Errorf("cancelling account deletion: %v", err)
+	}
+
+	return expectUpdated(result, ErrDeletionNotFound)
+}
+
+// GetDueAccountDeletions lists deletions whose grace period is over.
+func (s *PostgresStorage) GetDueAccountDeletions(limit int) ([]entities.AccountDeletion, error) {
+	rows, err := s.db.Query("SELECT "+deletionColumns+" FROM account_deletions WHERE scheduled_at <= LOCALTIMESTAMP ORDER BY scheduled_at LIMIT $1", limit)
+
+	if err != nil {
+		return nil, fmt.Errorf("getting due account deletions: %v", err)
+	}
+
+	defer rows.Close()
+
+	var deletions []entities.AccountDeletion
+
+	for rows.Next() {
+		deletion, err := scanDeletion(rows)
+
+		if err != nil {
+			return nil, fmt.Errorf("scanning rows: %v", err)
+		}
+
+		deletions = append(deletions, deletion)
+	}
+
+	return deletions, rows.Err()
+}
+
+// DeleteAccount carries out a due deletion: the articles are deleted,
+// reassigned or anonymized as planned, company ownership passes to another
+// member and the user row goes with everything that cascades from it. It
+// returns the URLs of the files the account left in object storage.
+//
+// The deletion row is locked first, so concurrent workers skip it and a
+// cancellation in the meantime wins.
+func (s *PostgresStorage) DeleteAccount(userId int) ([]string, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("beginning transaction: %v", err)
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var deletion entities.AccountDeletion
+
+	deletion, err = scanDeletion(tx.QueryRow("SELECT "+deletionColumns+" FROM account_deletions WHERE user_id = $1 AND scheduled_at <= LOCALTIMESTAMP FOR UPDATE SKIP LOCKED", userId))
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrDeletionNotDue
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("locking account deletion: %v", err)
+	}
+
+	var files []string
+	var avatarUrl sql.NullString
+
+	err = tx.QueryRow("SELECT avatar_url FROM users WHERE id = $1", userId).Scan(&avatarUrl)
+
+	if err != nil {
+		return nil, fmt.Errorf("getting avatar: %v", err)
+	}
+
+	if avatarUrl.String != "" {
+		files = append(files, avatarUrl.String)
+	}
+
+	switch {
+	case deletion.Strategy == entities.DeletionStrategyDelete:
+		var rows *sql.Rows
+
+		rows, err = tx.Query("DELETE FROM articles WHERE author_id = $1 RETURNING COALESCE(cover_url, '')", userId)
+
+		if err != nil {
+			return nil, fmt.Errorf("deleting articles: %v", err)
+		}
+
+		for rows.Next() {
+			var coverUrl string
+
+			if err = rows.Scan(&coverUrl); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("scanning rows: %v", err)
+			}
+
+			if coverUrl != "" {
+				files = append(files, coverUrl)
+			}
+		}
+
+		if err = rows.Err(); err != nil {
+			return nil, fmt.Errorf("deleting articles: %v", err)
+		}
+
+	// a reassign target that was deleted in the meantime falls back to anonymizing
+	case deletion.Strategy == entities.DeletionStrategyReassign && deletion.ReassignTo != nil:
+		_, err = tx.Exec("UPDATE articles SET author_id = $2 WHERE author_id = $1", userId, *deletion.ReassignTo)
+
+		if err != nil {
+			return nil, fmt.Errorf("reassigning articles: %v", err)
+		}
+
+	default:
+		var placeholderId int
+
+		placeholderId, err = deletedUserId(tx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec("UPDATE articles SET author_id = $2 WHERE author_id = $1", userId, placeholderId)
+
+		if err != nil {
+			return nil, fmt.Errorf("anonymizing articles: %v", err)
+		}
+	}
+
+	// the company keeps an owner, preferably one of its admins
+	_, err = tx.Exec(`UPDATE users SET company_role = $2 WHERE id = (
+			SELECT m.id FROM users o JOIN users m ON m.company_id = o.company_id AND m.id <> o.id
+			WHERE o.id = $1 AND o.company_role = $2
+			ORDER BY m.company_role = $3 DESC, m.id
+			LIMIT 1
+		)`, userId, entities.CompanyRoleOwner, entities.CompanyRoleAdmin)
+
+	if err != nil {
+		return nil, fmt.Errorf("passing on company ownership: %v", err)
+	}
+
+	_, err = tx.Exec("DELETE FROM users WHERE id = $1", userId)
+
+	if err != nil {
+		return nil, fmt.Errorf("deleting user: %v", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("committing transaction: %v", err)
+	}
+
+	return files, nil
+}
+
+// deletedUserId returns the placeholder account anonymized articles belong
+// to, creating it on first use. It can't sign in: it has no password and is
+// suspended.
+func deletedUserId(tx *sql.Tx) (int, error) {
+	var id int
+
+	err := tx.QueryRow("SELECT id FROM users WHERE role = $1 ORDER BY id LIMIT 1", entities.RoleDeleted).Scan(&id)
+
+	if err == nil {
+		return id, nil
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("getting deleted user placeholder: %v", err)
+	}
+
+	// sign-ups can't take the name, but older or renamed accounts may hold
+	// it, so a taken name or address gets a random suffix
+	err = tx.QueryRow(`INSERT INTO users(email, username, password, fullname, role, suspended_at, suspended_reason)
+		SELECT CASE WHEN EXISTS(SELECT 1 FROM users WHERE email = $1) THEN suffix || '-' || $1 ELSE $1 END,
+			CASE WHEN EXISTS(SELECT 1 FROM users WHERE username = $2) THEN $2 || '-' || suffix ELSE $2 END,
+			'', $3, $4, LOCALTIMESTAMP, $3
+		FROM (SELECT substr(md5(random()::text), 1, 8) AS suffix) s
+		RETURNING id`,
+		deletedUserEmail, deletedUserUsername, deletedUserFullname, entities.RoleDeleted).Scan(&id)
+
+	if err != nil {
+		return 0, fmt.Errorf("creating deleted user placeholder: %v", err)
+	}
+
+	return id, nil
+}
+
+// checkReserved refuses the username and address of the placeholder account,
+// as if they were taken.
+func checkReserved(user entities.User) error {
+	if strings.EqualFold(user.Username, deletedUserUsername) {
+		return ErrUsernameExists
+	}
+
+	if strings.EqualFold(user.Email, deletedUserEmail) {
+		return ErrEmailExists
+	}
+
+	return nil
+}
+
+// IsFileReferenced reports whether an avatar, logo or cover still points at
+// the file. Uploads are stored under their original name, so accounts can
+// share one.
+func (s *PostgresStorage) IsFileReferenced(url string) (bool, error) {
+	var referenced bool
+
+	err := s.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE avatar_url = $1)
+		OR EXISTS(SELECT 1 FROM companies WHERE logo_url = $1)
+		OR EXISTS(SELECT 1 FROM articles WHERE cover_url = $1)`, url).Scan(&referenced)
+
+	if err != nil {
+		return false, fmt.Errorf("checking file references: %v", err)
+	}
+
+	return referenced, nil
+}
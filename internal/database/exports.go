@@ -0,0 +1,190 @@
+package database
+
+import (
+	"auth-service/internal/entities"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrExportNotFound   = errors.New("data export not found")
+	ErrExportInProgress = errors.New("a data export is already in progress")
+	ErrExportLeaseLost  = errors.New("data export was claimed by another worker")
+)
+
+const dataExportColumns = "id, user_id, status, object_key, error, attempts, created_at, finished_at, expires_at"
+
+func scanDataExport(row interface{ Scan(...any) error }) (entities.DataExport, error) {
+	var export entities.DataExport
+	var finishedAt, expiresAt sql.NullTime
+
+	err := row.Scan(&export.Id, &export.UserId, &export.Status, &export.ObjectKey, &export.Error, &export.Attempts, &export.CreatedAt, &finishedAt, &expiresAt)
+
+	if err != nil {
+		return entities.DataExport{}, err
+	}
+
+	if finishedAt.Valid {
+		export.FinishedAt = &finishedAt.Time
+	}
+
+	if expiresAt.Valid {
+		export.ExpiresAt = &expiresAt.Time
+	}
+
+	return export, nil
+}
+
+// InsertDataExport queues an export of the user's data. A user has at most
+// one pending or running export at a time.
+func (s *PostgresStorage) InsertDataExport(userId int) (entities.DataExport, error) {
+	export, err := scanDataExport(s.db.QueryRow("INSERT INTO data_exports(user_id, status) VALUES ($1, $2) RETURNING "+dataExportColumns, userId, entities.ExportPending))
+
+	if err != nil {
+		var pqErr *pq.Error
+
+		if errors.As(err, &pqErr) {
+			switch pqErr.Code {
+			case "23505":
+				return entities.DataExport{}, ErrExportInProgress
+			case "23503":
+				return entities.DataExport{}, ErrUserNotFound
+			}
+		}
+
+		return entities.DataExport{}, fmt.Errorf("inserting data export: %v", err)
+	}
+
+	return export, nil
+}
+
+func (s *PostgresStorage) GetLatestDataExport(userId int) (entities.DataExport, error) {
+	export, err := scanDataExport(s.db.QueryRow("SELECT "+dataExportColumns+" FROM data_exports WHERE user_id = $1 ORDER BY id DESC LIMIT 1", userId))
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entities.DataExport{}, ErrExportNotFound
+		}
+
+		return entities.DataExport{}, fmt.Errorf("getting data export: %v", err)
+	}
+
+	return export, nil
+}
+
+// ClaimDataExport picks the oldest pending export, or a running one whose
+// worker stopped renewing its lease, and leases it to the caller.
+func (s *PostgresStorage) ClaimDataExport(lease time.Duration) (entities.DataExport, error) {
+	export, err := scanDataExport(s.db.QueryRow(`UPDATE data_exports SET status = $2, attempts = attempts + 1, lease_until = LOCALTIMESTAMP + $1 * INTERVAL '1 second'
+		WHERE id = (
+			SELECT id FROM data_exports
+			WHERE user_id IS NOT NULL AND (status = $3 OR (status = $2 AND lease_until <= LOCALTIMESTAMP))
+			ORDER BY id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+dataExportColumns, lease.Seconds(), entities.ExportRunning, entities.ExportPending))
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entities.DataExport{}, ErrExportNotFound
+		}
+
+		return entities.DataExport{}, fmt.Errorf("claiming data export: %v", err)
+	}
+
+	return export, nil
+}
+
+// RenewDataExportLease extends the lease of a running export for as long as
+// the claim with the given attempt number still holds it.
+func (s *PostgresStorage) RenewDataExportLease(id int, attempt int, lease time.Duration) error {
+	result, err := s.db.Exec("UPDATE data_exports SET lease_until = LOCALTIMESTAMP + $3 * INTERVAL '1 second' WHERE id = $1 AND attempts = $2 AND status = $4",
+		id, attempt, lease.Seconds(), entities.ExportRunning)
+
+	if err != nil {
+		return fmt.Errorf("renewing data export lease: %v", err)
+	}
+
+	return expectUpdated(result, ErrExportLeaseLost)
+}
+
+// CompleteDataExport records the uploaded archive, which can be downloaded
+// until the ttl runs out. Only the claim holding the lease can complete it.
+func (s *PostgresStorage) CompleteDataExport(id int, attempt int, objectKey string, ttl time.Duration) error {
+	result, err := s.db.Exec(`UPDATE data_exports SET status = $3, object_key = $4, lease_until = NULL, finished_at = LOCALTIMESTAMP, expires_at = LOCALTIMESTAMP + $5 * INTERVAL '1 second'
+		WHERE id = $1 AND attempts = $2 AND status = $6`, id, attempt, entities.ExportDone, objectKey, ttl.Seconds(), entities.ExportRunning)
+
+	if err != nil {
+		return fmt.Errorf("completing data export: %v", err)
+	}
+
+	return expectUpdated(result, ErrExportLeaseLost)
+}
+
+// FailDataExport gives up on an export, if the claim still holds the lease.
+func (s *PostgresStorage) FailDataExport(id int, attempt int, message string) error {
+	result, err := s.db.Exec("UPDATE data_exports SET status = $3, error = $4, lease_until = NULL, finished_at = LOCALTIMESTAMP WHERE id = $1 AND attempts = $2 AND status = $5",
+		id, attempt, entities.ExportFailed, message, entities.ExportRunning)
+
+	if err != nil {
+		return fmt.Errorf("failing data export: %v", err)
+	}
+
+	return expectUpdated(result, ErrExportLeaseLost)
+}
+
+// ExpireDataExports marks finished exports past their expiry, or whose
+// account was deleted, as expired and returns the keys of the archives to remove.
+func (s *PostgresStorage) ExpireDataExports() ([]string, error) {
+	rows, err := s.db.Query("UPDATE data_exports SET status = $1 WHERE status = $2 AND (expires_at <= LOCALTIMESTAMP OR user_id IS NULL) RETURNING object_key", entities.ExportExpired, entities.ExportDone)
+
+	if err != nil {
+		return nil, fmt.Errorf("expiring data exports: %v", err)
+	}
+
+	defer rows.Close()
+
+	var objectKeys []string
+
+	for rows.Next() {
+		var objectKey string
+
+		if err := rows.Scan(&objectKey); err != nil {
+			return nil, fmt.Errorf("scanning rows: %v", err)
+		}
+
+		objectKeys = append(objectKeys, objectKey)
+	}
+
+	return objectKeys, rows.Err()
+}
+
+// GetFollows returns the ids of the users and of the companies the user follows.
+func (s *PostgresStorage) GetFollows(userId int) ([]int, []int, error) {
+	var userIds, companyIds []int64
+
+	err := s.db.QueryRow(`SELECT
+		ARRAY(SELECT followee_id FROM user_follows WHERE follower_id = $1 ORDER BY created_at),
+		ARRAY(SELECT company_id FROM company_follows WHERE follower_id = $1 ORDER BY created_at)`, userId).Scan(pq.Array(&userIds), pq.Array(&companyIds))
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("getting follows: %v", err)
+	}
+
+	return toInts(userIds), toInts(companyIds), nil
+}
+
+func toInts(values []int64) []int {
+	ints := make([]int, len(values))
+
+	for i, value := range values {
+		ints[i] = int(value)
+	}
+
+	return ints
+}
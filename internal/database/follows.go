@@ -0,0 +1,153 @@
+package database
+
+import (
+	"auth-service/internal/entities"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const cursorTimeLayout = "2006-01-02 15:04:05.999999"
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+func (s *PostgresStorage) FollowUser(followerId int, followeeId int) error {
+	_, err := s.db.Exec("INSERT INTO user_follows(follower_id, followee_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", followerId, followeeId)
+
+	if err != nil {
+		return fmt.Errorf("following user: %v", err)
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) UnfollowUser(followerId int, followeeId int) error {
+	_, err := s.db.Exec("DELETE FROM user_follows WHERE follower_id = $1 AND followee_id = $2", followerId, followeeId)
+
+	if err != nil {
+		return fmt.Errorf("unfollowing user: %v", err)
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) FollowCompany(followerId int, companyId int) error {
+	_, err := s.db.Exec("INSERT INTO company_follows(follower_id, company_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", followerId, companyId)
+
+	if err != nil {
+		return fmt.Errorf("following company: %v", err)
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) UnfollowCompany(followerId int, companyId int) error {
+	_, err := s.db.Exec("DELETE FROM company_follows WHERE follower_id = $1 AND company_id = $2", followerId, companyId)
+
+	if err != nil {
+		return fmt.Errorf("unfollowing company: %v", err)
+	}
+
+	return nil
+}
+
+// feed cursors are opaque to clients: base64 of "<created_at>|<id>" of the last returned article
+func encodeFeedCursor(article entities.Article) string {
+	raw := article.CreatedAt.Format(cursorTimeLayout) + "|" + strconv.Itoa(article.Id)
+
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeFeedCursor(cursor string) (string, int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+
+	if err != nil {
+		return "", 0, ErrInvalidCursor
+	}
+
+	createdAt, idVal, ok := strings.Cut(string(raw), "|")
+
+	if !ok {
+		return "", 0, ErrInvalidCursor
+	}
+
+	if _, err := time.Parse(cursorTimeLayout, createdAt); err != nil {
+		return "", 0, ErrInvalidCursor
+	}
+
+	id, err := strconv.Atoi(idVal)
+
+	if err != nil {
+		return "", 0, ErrInvalidCursor
+	}
+
+	return createdAt, id, nil
+}
+
+// GetFeed merges the articles of followed users and companies, newest first.
+//
+// The feed is built on read: for every followed user and company a lateral
+// subquery walks that source's (author_id|company_id, created_at, id) index
+// and stops after a page, so the cost grows with the page size times the
+// number of follows rather than with the total number of articles.
+func (s *PostgresStorage) GetFeed(userId int, cursor string, limit int) ([]entities.Article, string, error) {
+	// the first page starts after the newest possible article
+	createdAt, lastId := "infinity", 0
+
+	if cursor != "" {
+		var err error
+
+		createdAt, lastId, err = decodeFeedCursor(cursor)
+
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	rows, err := s.db.Query(`SELECT `+articleColumns+` FROM (
+			SELECT a.* FROM user_follows f
+				CROSS JOIN LATERAL (SELECT * FROM articles
+					WHERE author_id = f.followee_id AND (created_at, id) < ($2::timestamp, $3)
+					ORDER BY created_at DESC, id DESC
+					LIMIT $4) a
+				WHERE f.follower_id = $1
+			UNION
+			SELECT a.* FROM company_follows f
+				CROSS JOIN LATERAL (SELECT * FROM articles
+					WHERE company_id = f.company_id AND (created_at, id) < ($2::timestamp, $3)
+					ORDER BY created_at DESC, id DESC
+					LIMIT $4) a
+				WHERE f.follower_id = $1
+		) a
+		ORDER BY a.created_at DESC, a.id DESC
+		LIMIT $4`, userId, createdAt, lastId, limit)
+
+	if err != nil {
+		return nil, "", fmt.Errorf("querying feed: %v", err)
+	}
+
+	defer rows.Close()
+
+	articles, err := scanArticles(rows)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	articles, err = s.attachTags(articles)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	var nextCursor string
+
+	if len(articles) == limit {
+		nextCursor = encodeFeedCursor(articles[len(articles)-1])
+	}
+
+	return articles, nextCursor, nil
+}
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"auth-service/internal/entities"
+	"auth-service/internal/events"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrInvalidLoginState = errors.New("invalid or expired login state")
+
+// login states
+
+func (s *PostgresStorage) InsertOIDCLoginState(state string, provider string, nonce string, codeVerifier string, ttl time.Duration) error {
+	// abandoned logins are cleaned up as new ones start
+	_, err := s.db.Exec("DELETE FROM oidc_login_states WHERE expires_at < LOCALTIMESTAMP")
+
+	if err != nil {
+		return fmt.Errorf("deleting expired login states: %v", err)
+	}
+
+	_, err = s.db.Exec("INSERT INTO oidc_login_states(state, provider, nonce, code_verifier, expires_at) VALUES ($1, $2, $3, $4, LOCALTIMESTAMP + $5 * INTERVAL '1 second')", state, provider, nonce, codeVerifier, ttl.Seconds())
+
+	if err != nil {
+		return fmt.Errorf("inserting login state: %v", err)
+	}
+
+	return nil
+}
+
+// ConsumeOIDCLoginState deletes the state and returns its nonce and PKCE
+// verifier. Each state can finish one login only.
+func (s *PostgresStorage) ConsumeOIDCLoginState(state string, provider string) (string, string, error) {
+	var nonce, codeVerifier string
+
+	err := s.db.QueryRow("DELETE FROM oidc_login_states WHERE state = $1 AND provider = $2 AND expires_at > LOCALTIMESTAMP RETURNING nonce, code_verifier", state, provider).Scan(&nonce, &codeVerifier)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", "", ErrInvalidLoginState
+		}
+
+		return "", "", fmt.Errorf("consuming login state: %v", err)
+	}
+
+	return nonce, codeVerifier, nil
+}
+
+// identities
+
+func (s *PostgresStorage) GetUserIdByIdentity(provider string, subject string) (int, error) {
+	var userId int
+
+	err := s.db.QueryRow("SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2", provider, subject).Scan(&userId)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrUserNotFound
+		}
+
+		return 0, fmt.Errorf("getting identity: %v", err)
+	}
+
+	return userId, nil
+}
+
+func (s *PostgresStorage) LinkIdentity(userId int, provider string, subject string, email string) error {
+	_, err := s.db.Exec("INSERT INTO user_identities(provider, subject, user_id, email) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING", provider, subject, userId, email)
+
+	if err != nil {
+		return fmt.Errorf("linking identity: %v", err)
+	}
+
+	return nil
+}
+
+// InsertExternalUser creates a user without a password, signed up through an
+// identity provider, and links the identity to it.
+func (s *PostgresStorage) InsertExternalUser(user entities.User, provider string, subject string) (int, error) {
+	if err := checkReserved(user); err != nil {
+		return 0, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("beginning transaction: %v", err)
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var userId int
+
+	err = tx.QueryRow("INSERT INTO users(email, username, password, fullname, email_verified_at) VALUES ($1, $2, '', $3, CASE WHEN $4 THEN LOCALTIMESTAMP END) RETURNING id",
+		user.Email, user.Username, user.Fullname, user.EmailVerified).Scan(&userId)
+
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			if pqErr.Constraint == "users_email_key" {
+				return 0, ErrEmailExists
+			} else if pqErr.Constraint == "users_username_key" {
+				return 0, ErrUsernameExists
+			}
+		}
+
+		return 0, fmt.Errorf("inserting user: %v", err)
+	}
+
+	_, err = tx.Exec("INSERT INTO user_identities(provider, subject, user_id, email) VALUES ($1, $2, $3, $4)", provider, subject, userId, user.Email)
+
+	if err != nil {
+		return 0, fmt.Errorf("linking identity: %v", err)
+	}
+
+	err = insertOutboxEvent(tx, events.AggregateUser, userId, events.UserCreated, events.UserCreatedPayload{
+		Id:       userId,
+		Email:    user.Email,
+		Username: user.Username,
+		Fullname: user.Fullname,
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("committing transaction: %v", err)
+	}
+
+	return userId, nil
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+func (s *PostgresStorage) RecordLoginAttempt(username string, ip string, success bool) error {
+	_, err := s.db.Exec("INSERT INTO login_attempts(username, ip, success) VALUES ($1, $2, $3)", username, ip, success)
+
+	if err != nil {
+		return fmt.Errorf("recording login attempt: %v", err)
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) CountLoginFailures(username string, ip string, window time.Duration) (int, int, error) {
+	var accountFailures, ipFailures int
+
+	// GREATEST skips NULLs, so accounts without successes or lockouts fall back to the window
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM login_attempts
+		WHERE username = $1 AND NOT success AND created_at > GREATEST(
+			LOCALTIMESTAMP - $2 * INTERVAL '1 second',
+			(SELECT MAX(created_at) FROM login_attempts WHERE username = $1 AND success),
+			(SELECT MAX(created_at) FROM account_lockouts WHERE username = $1)
+		)`, username, window.Seconds()).Scan(&accountFailures)
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("counting account login failures: %v", err)
+	}
+
+	err = s.db.QueryRow("SELECT COUNT(*) FROM login_attempts WHERE ip = $1 AND NOT success AND created_at > LOCALTIMESTAMP - $2 * INTERVAL '1 second'", ip, window.Seconds()).Scan(&ipFailures)
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("counting ip login failures: %v", err)
+	}
+
+	return accountFailures, ipFailures, nil
+}
+
+func (s *PostgresStorage) GetLockoutRemaining(username string) (time.Duration, error) {
+	var seconds float64
+
+	err := s.db.QueryRow(`SELECT COALESCE(EXTRACT(EPOCH FROM MAX(locked_until) - LOCALTIMESTAMP), 0) FROM account_lockouts
+		WHERE username = $1 AND unlocked_at IS NULL AND locked_until > LOCALTIMESTAMP`, username).Scan(&seconds)
+
+	if err != nil {
+		return 0, fmt.Errorf("getting lockout: %v", err)
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+func (s *PostgresStorage) InsertLockout(username string, ip string, failures int, duration time.Duration) error {
+	_, err := s.db.Exec("INSERT INTO account_lockouts(username, ip, failures, locked_until) VALUES ($1, $2, $3, LOCALTIMESTAMP + $4 * INTERVAL '1 second')", username, ip, failures, duration.Seconds())
+
+	if err != nil {
+		return fmt.Errorf("inserting lockout: %v", err)
+	}
+
+	return nil
+}
+
+// UnlockAccount lifts the active lockouts of the user.
+func (s *PostgresStorage) UnlockAccount(userId int, adminId int) error {
+	_, err := s.db.Exec(`UPDATE account_lockouts SET unlocked_at = LOCALTIMESTAMP, unlocked_by = $2
+		WHERE username = (SELECT username FROM users WHERE id = $1) AND unlocked_at IS NULL AND locked_until > LOCALTIMESTAMP`, userId, adminId)
+
+	if err != nil {
+		return fmt.Errorf("unlocking account: %v", err)
+	}
+
+	return nil
+}
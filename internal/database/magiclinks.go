@@ -0,0 +1,43 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidMagicLink = errors.New("invalid or expired login link")
+
+func (s *PostgresStorage) InsertMagicLinkToken(userId int, email string, tokenHash string, ttl time.Duration) error {
+	_, err := s.db.Exec("INSERT INTO magic_link_tokens(token_hash, user_id, email, expires_at) VALUES ($1, $2, $3, LOCALTIMESTAMP + $4 * INTERVAL '1 second')", tokenHash, userId, email, ttl.Seconds())
+
+	if err != nil {
+		return fmt.Errorf("inserting magic link token: %v", err)
+	}
+
+	return nil
+}
+
+// ConsumeMagicLinkToken uses up the token and returns its user. A link works
+// once, until it expires, and only while the user still has the address it
+// was sent to.
+func (s *PostgresStorage) ConsumeMagicLinkToken(tokenHash string) (int, string, error) {
+	var userId int
+	var email string
+
+	err := s.db.QueryRow(`UPDATE magic_link_tokens t SET used_at = LOCALTIMESTAMP
+		FROM users u
+		WHERE t.token_hash = $1 AND t.used_at IS NULL AND t.expires_at > LOCALTIMESTAMP AND u.id = t.user_id AND u.email = t.email
+		RETURNING t.user_id, t.email`, tokenHash).Scan(&userId, &email)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, "", ErrInvalidMagicLink
+		}
+
+		return 0, "", fmt.Errorf("consuming magic link token: %v", err)
+	}
+
+	return userId, email, nil
+}
@@ -0,0 +1,186 @@
+package database
+
+import (
+	"auth-service/internal/entities"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrOAuthClientNotFound = errors.New("oauth client not found")
+	ErrInvalidGrant        = errors.New("invalid, expired or already used grant")
+)
+
+// clients
+
+func (s *PostgresStorage) InsertOAuthClient(client entities.OAuthClient) error {
+	_, err := s.db.Exec("INSERT INTO oauth_clients(id, name, secret_hash, redirect_uris, scopes, public) VALUES ($1, $2, $3, $4, $5, $6)",
+		client.Id, client.Name, client.SecretHash, pq.Array(client.RedirectUris), pq.Array(client.Scopes), client.Public)
+
+	if err != nil {
+		return fmt.Errorf("inserting oauth client: %v", err)
+	}
+
+	return nil
+}
+
+const oauthClientColumns = "id, name, secret_hash, redirect_uris, scopes, public, created_at"
+
+func scanOAuthClient(row interface{ Scan(...any) error }) (entities.OAuthClient, error) {
+	var client entities.OAuthClient
+
+	err := row.Scan(&client.Id, &client.Name, &client.SecretHash, pq.Array(&client.RedirectUris), pq.Array(&client.Scopes), &client.Public, &client.CreatedAt)
+
+	return client, err
+}
+
+func (s *PostgresStorage) GetOAuthClients() ([]entities.OAuthClient, error) {
+	rows, err := s.db.Query("SELECT " + oauthClientColumns + " FROM oauth_clients ORDER BY created_at")
+
+	if err != nil {
+		return nil, fmt.Errorf("getting oauth clients: %v", err)
+	}
+
+	defer rows.Close()
+
+	var clients []entities.OAuthClient
+
+	for rows.Next() {
+		client, err := scanOAuthClient(rows)
+
+		if err != nil {
+			return nil, fmt.Errorf("scanning rows: %v", err)
+		}
+
+		clients = append(clients, client)
+	}
+
+	return clients, rows.Err()
+}
+
+func (s *PostgresStorage) GetOAuthClientById(id string) (entities.OAuthClient, error) {
+	client, err := scanOAuthClient(s.db.QueryRow("SELECT "+oauthClientColumns+" FROM oauth_clients WHERE id = $1", id))
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entities.OAuthClient{}, ErrOAuthClientNotFound
+		}
+
+		return entities.OAuthClient{}, fmt.Errorf("getting oauth client: %v", err)
+	}
+
+	return client, nil
+}
+
+func (s *PostgresStorage) DeleteOAuthClient(id string) error {
+	_, err := s.db.Exec("DELETE FROM oauth_clients WHERE id = $1", id)
+
+	if err != nil {
+		return fmt.Errorf("deleting oauth client: %v", err)
+	}
+
+	return nil
+}
+
+// consents
+
+// HasOAuthConsent reports whether the user already allowed the client all of the scopes.
+func (s *PostgresStorage) HasOAuthConsent(userId int, clientId string, scopes []string) (bool, error) {
+	var granted bool
+
+	err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM oauth_consents WHERE user_id = $1 AND client_id = $2 AND scopes @> $3)", userId, clientId, pq.Array(scopes)).Scan(&granted)
+
+	if err != nil {
+		return false, fmt.Errorf("checking oauth consent: %v", err)
+	}
+
+	return granted, nil
+}
+
+// SaveOAuthConsent adds the scopes to what the user allowed the client.
+func (s *PostgresStorage) SaveOAuthConsent(userId int, clientId string, scopes []string) error {
+	_, err := s.db.Exec(`INSERT INTO oauth_consents(user_id, client_id, scopes) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, client_id) DO UPDATE
+		SET scopes = ARRAY(SELECT DISTINCT unnest(oauth_consents.scopes || EXCLUDED.scopes)), updated_at = CURRENT_TIMESTAMP`,
+		userId, clientId, pq.Array(scopes))
+
+	if err != nil {
+		return fmt.Errorf("saving oauth consent: %v", err)
+	}
+
+	return nil
+}
+
+// authorization codes
+
+func (s *PostgresStorage) InsertOAuthCode(codeHash string, grant entities.OAuthGrant, ttl time.Duration) error {
+	// expired codes are cleaned up as new ones are issued
+	_, err := s.db.Exec("DELETE FROM oauth_codes WHERE expires_at < LOCALTIMESTAMP")
+
+	if err != nil {
+		return fmt.Errorf("deleting expired oauth codes: %v", err)
+	}
+
+	_, err = s.db.Exec("INSERT INTO oauth_codes(code_hash, client_id, user_id, scopes, redirect_uri, nonce, code_challenge, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, LOCALTIMESTAMP + $8 * INTERVAL '1 second')",
+		codeHash, grant.ClientId, grant.UserId, pq.Array(grant.Scopes), grant.RedirectUri, grant.Nonce, grant.CodeChallenge, ttl.Seconds())
+
+	if err != nil {
+		return fmt.Errorf("inserting oauth code: %v", err)
+	}
+
+	return nil
+}
+
+// ConsumeOAuthCode deletes the code and returns its grant. A code works once.
+func (s *PostgresStorage) ConsumeOAuthCode(codeHash string) (entities.OAuthGrant, error) {
+	var grant entities.OAuthGrant
+
+	err := s.db.QueryRow("DELETE FROM oauth_codes WHERE code_hash = $1 AND expires_at > LOCALTIMESTAMP RETURNING client_id, user_id, scopes, redirect_uri, nonce, code_challenge", codeHash).
+		Scan(&grant.ClientId, &grant.UserId, pq.Array(&grant.Scopes), &grant.RedirectUri, &grant.Nonce, &grant.CodeChallenge)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entities.OAuthGrant{}, ErrInvalidGrant
+		}
+
+		return entities.OAuthGrant{}, fmt.Errorf("consuming oauth code: %v", err)
+	}
+
+	return grant, nil
+}
+
+// refresh tokens
+
+func (s *PostgresStorage) InsertOAuthRefreshToken(tokenHash string, grant entities.OAuthGrant, ttl time.Duration) error {
+	_, err := s.db.Exec("INSERT INTO oauth_refresh_tokens(token_hash, client_id, user_id, scopes, expires_at) VALUES ($1, $2, $3, $4, LOCALTIMESTAMP + $5 * INTERVAL '1 second')",
+		tokenHash, grant.ClientId, grant.UserId, pq.Array(grant.Scopes), ttl.Seconds())
+
+	if err != nil {
+		return fmt.Errorf("inserting refresh token: %v", err)
+	}
+
+	return nil
+}
+
+// RotateOAuthRefreshToken revokes the refresh token and returns its grant, so
+// the caller can issue a new one in its place.
+func (s *PostgresStorage) RotateOAuthRefreshToken(tokenHash string) (entities.OAuthGrant, error) {
+	var grant entities.OAuthGrant
+
+	err := s.db.QueryRow("UPDATE oauth_refresh_tokens SET revoked_at = LOCALTIMESTAMP WHERE token_hash = $1 AND revoked_at IS NULL AND expires_at > LOCALTIMESTAMP RETURNING client_id, user_id, scopes", tokenHash).
+		Scan(&grant.ClientId, &grant.UserId, pq.Array(&grant.Scopes))
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entities.OAuthGrant{}, ErrInvalidGrant
+		}
+
+		return entities.OAuthGrant{}, fmt.Errorf("rotating refresh token: %v", err)
+	}
+
+	return grant, nil
+}
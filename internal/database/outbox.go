@@ -0,0 +1,107 @@
+package database
+
+import (
+	"auth-service/internal/events"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// outboxLockId is the advisory lock held while relaying, so only one relay
+// publishes at a time and events of an aggregate can't overtake each other.
+const outboxLockId = 7_318_004
+
+// insertOutboxEvent stores the event in the same transaction as the change it describes.
+func insertOutboxEvent(tx *sql.Tx, aggregateType string, aggregateId int, eventType string, payload any) error {
+	event, err := events.New(aggregateType, aggregateId, eventType, payload)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO outbox_events(aggregate_type, aggregate_id, event_type, payload) VALUES ($1, $2, $3, $4)", event.AggregateType, event.AggregateId, event.Type, []byte(event.Payload))
+
+	if err != nil {
+		return fmt.Errorf("inserting outbox event: %v", err)
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) RelayOutbox(limit int, publish func([]events.Event) error) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("beginning transaction: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	var locked bool
+
+	err = tx.QueryRow("SELECT pg_try_advisory_xact_lock($1)", outboxLockId).Scan(&locked)
+
+	if err != nil {
+		return 0, fmt.Errorf("locking outbox: %v", err)
+	}
+
+	if !locked {
+		return 0, nil
+	}
+
+	rows, err := tx.Query("SELECT id, aggregate_type, aggregate_id, event_type, payload, created_at FROM outbox_events WHERE published_at IS NULL ORDER BY id LIMIT $1", limit)
+
+	if err != nil {
+		return 0, fmt.Errorf("querying outbox: %v", err)
+	}
+
+	var batch []events.Event
+
+	for rows.Next() {
+		var event events.Event
+
+		err := rows.Scan(&event.Id, &event.AggregateType, &event.AggregateId, &event.Type, &event.Payload, &event.CreatedAt)
+
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scanning rows: %v", err)
+		}
+
+		batch = append(batch, event)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("iterating rows: %v", err)
+	}
+
+	if len(batch) == 0 {
+		return 0, nil
+	}
+
+	err = publish(batch)
+
+	if err != nil {
+		return 0, fmt.Errorf("publishing events: %v", err)
+	}
+
+	ids := make([]int64, len(batch))
+
+	for i, event := range batch {
+		ids[i] = event.Id
+	}
+
+	_, err = tx.Exec("UPDATE outbox_events SET published_at = CURRENT_TIMESTAMP WHERE id = ANY($1)", pq.Array(ids))
+
+	if err != nil {
+		return 0, fmt.Errorf("marking events as published: %v", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("committing transaction: %v", err)
+	}
+
+	return len(batch), nil
+}
@@ -0,0 +1,185 @@
+package database
+
+import (
+	"auth-service/internal/entities"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrPasskeyNotFound  = errors.New("passkey not found")
+	ErrPasskeyExists    = errors.New("passkey already registered")
+	ErrInvalidChallenge = errors.New("invalid or expired challenge")
+)
+
+// ceremony challenges
+
+// InsertWebAuthnChallenge stores a challenge handed to the browser. Login
+// challenges aren't tied to a user, userId is 0 for them.
+func (s *PostgresStorage) InsertWebAuthnChallenge(challenge string, ceremony string, userId int, ttl time.Duration) error {
+	var user sql.NullInt64
+
+	if userId != 0 {
+		user = sql.NullInt64{Int64: int64(userId), Valid: true}
+	}
+
+	_, err := s.db.Exec("DELETE FROM webauthn_challenges WHERE expires_at <= LOCALTIMESTAMP")
+
+	if err != nil {
+		return fmt.Errorf("deleting expired challenges: %v", err)
+	}
+
+	_, err = s.db.Exec("INSERT INTO webauthn_challenges(challenge, ceremony, user_id, expires_at) VALUES ($1, $2, $3, LOCALTIMESTAMP + $4 * INTERVAL '1 second')", challenge, ceremony, user, ttl.Seconds())
+
+	if err != nil {
+		return fmt.Errorf("inserting webauthn challenge: %v", err)
+	}
+
+	return nil
+}
+
+// ConsumeWebAuthnChallenge uses up a challenge of the ceremony and returns
+// the user it was issued to, 0 for login challenges.
+func (s *PostgresStorage) ConsumeWebAuthnChallenge(challenge string, ceremony string) (int, error) {
+	var userId sql.NullInt64
+
+	err := s.db.QueryRow("DELETE FROM webauthn_challenges WHERE challenge = $1 AND ceremony = $2 AND expires_at > LOCALTIMESTAMP RETURNING user_id", challenge, ceremony).Scan(&userId)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInvalidChallenge
+		}
+
+		return 0, fmt.Errorf("consuming webauthn challenge: %v", err)
+	}
+
+	return int(userId.Int64), nil
+}
+
+// passkeys
+
+func (s *PostgresStorage) InsertPasskey(passkey entities.Passkey) (int, error) {
+	var id int
+
+	err := s.db.QueryRow("INSERT INTO webauthn_credentials(user_id, credential_id, public_key, sign_count, name) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		passkey.UserId, passkey.CredentialId, passkey.PublicKey, int64(passkey.SignCount), passkey.Name).Scan(&id)
+
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return 0, ErrPasskeyExists
+		}
+
+		return 0, fmt.Errorf("inserting passkey: %v", err)
+	}
+
+	return id, nil
+}
+
+func (s *PostgresStorage) GetPasskeys(userId int) ([]entities.Passkey, error) {
+	rows, err := s.db.Query("SELECT id, user_id, name, credential_id, last_used_at, created_at FROM webauthn_credentials WHERE user_id = $1 ORDER BY created_at", userId)
+
+	if err != nil {
+		return nil, fmt.Errorf("getting passkeys: %v", err)
+	}
+
+	defer rows.Close()
+
+	var passkeys []entities.Passkey
+
+	for rows.Next() {
+		var passkey entities.Passkey
+
+		err := rows.Scan(&passkey.Id, &passkey.UserId, &passkey.Name, &passkey.CredentialId, &passkey.LastUsedAt, &passkey.CreatedAt)
+
+		if err != nil {
+			return nil, fmt.Errorf("scanning rows: %v", err)
+		}
+
+		passkeys = append(passkeys, passkey)
+	}
+
+	return passkeys, rows.Err()
+}
+
+func (s *PostgresStorage) GetPasskeyByCredentialId(credentialId []byte) (entities.Passkey, error) {
+	var passkey entities.Passkey
+	var signCount int64
+
+	err := s.db.QueryRow("SELECT id, user_id, name, credential_id, public_key, sign_count, last_used_at, created_at FROM webauthn_credentials WHERE credential_id = $1", credentialId).
+		Scan(&passkey.Id, &passkey.UserId, &passkey.Name, &passkey.CredentialId, &passkey.PublicKey, &signCount, &passkey.LastUsedAt, &passkey.CreatedAt)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entities.Passkey{}, ErrPasskeyNotFound
+		}
+
+		return entities.Passkey{}, fmt.Errorf("getting passkey: %v", err)
+	}
+
+	passkey.SignCount = uint32(signCount)
+
+	return passkey, nil
+}
+
+// UsePasskey records a login with the passkey. Like UseTOTPStep it reports
+// false when the counter was already moved to or past signCount, so two
+// logins racing with the same counter can't both succeed.
+func (s *PostgresStorage) UsePasskey(id int, signCount uint32) (bool, error) {
+	result, err := s.db.Exec("UPDATE webauthn_credentials SET sign_count = $2, last_used_at = LOCALTIMESTAMP WHERE id = $1 AND (sign_count < $2 OR ($2 = 0 AND sign_count = 0))", id, int64(signCount))
+
+	if err != nil {
+		return false, fmt.Errorf("using passkey: %v", err)
+	}
+
+	updated, err := result.RowsAffected()
+
+	if err != nil {
+		return false, fmt.Errorf("using passkey: %v", err)
+	}
+
+	return updated == 1, nil
+}
+
+func (s *PostgresStorage) RenamePasskey(userId int, id int, name string) error {
+	result, err := s.db.Exec("UPDATE webauthn_credentials SET name = $3 WHERE id = $1 AND user_id = $2", id, userId, name)
+
+	if err != nil {
+		return fmt.Errorf("renaming passkey: %v", err)
+	}
+
+	updated, err := result.RowsAffected()
+
+	if err != nil {
+		return fmt.Errorf("renaming passkey: %v", err)
+	}
+
+	if updated == 0 {
+		return ErrPasskeyNotFound
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) DeletePasskey(userId int, id int) error {
+	result, err := s.db.Exec("DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2", id, userId)
+
+	if err != nil {
+		return fmt.Errorf("deleting passkey: %v", err)
+	}
+
+	deleted, err := result.RowsAffected()
+
+	if err != nil {
+		return fmt.Errorf("deleting passkey: %v", err)
+	}
+
+	if deleted == 0 {
+		return ErrPasskeyNotFound
+	}
+
+	return nil
+}
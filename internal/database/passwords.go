@@ -0,0 +1,179 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+func (s *PostgresStorage) GetUserIdByEmail(email string) (int, error) {
+	var id int
+
+	err := s.db.QueryRow("SELECT id FROM users WHERE email = $1", email).Scan(&id)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrUserNotFound
+		}
+
+		return 0, fmt.Errorf("getting user by email: %v", err)
+	}
+
+	return id, nil
+}
+
+func (s *PostgresStorage) GetUserPassword(id int) (string, error) {
+	var password string
+
+	err := s.db.QueryRow("SELECT password FROM users WHERE id = $1", id).Scan(&password)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrUserNotFound
+		}
+
+		return "", fmt.Errorf("getting user password: %v", err)
+	}
+
+	return password, nil
+}
+
+// setPassword stores the new hash and revokes the user's sign-ins, except
+// keepSession, which is 0 to sign out all of them.
+func setPassword(tx *sql.Tx, userId int, password string, keepSession int) error {
+	result, err := tx.Exec("UPDATE users SET password = $1 WHERE id = $2", password, userId)
+
+	if err != nil {
+		return fmt.Errorf("updating password: %v", err)
+	}
+
+	updated, err := result.RowsAffected()
+
+	if err != nil {
+		return fmt.Errorf("updating password: %v", err)
+	}
+
+	if updated == 0 {
+		return ErrUserNotFound
+	}
+
+	// outstanding reset links must not outlive a password change
+	_, err = tx.Exec("DELETE FROM password_reset_tokens WHERE user_id = $1", userId)
+
+	if err != nil {
+		return fmt.Errorf("deleting reset tokens: %v", err)
+	}
+
+	return revokeSignIns(tx, userId, keepSession)
+}
+
+// UpdatePassword changes the user's password. Sessions other than keepSession
+// are signed out, and personal access tokens and OAuth refresh tokens revoked.
+func (s *PostgresStorage) UpdatePassword(userId int, password string, keepSession int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %v", err)
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = setPassword(tx, userId, password, keepSession)
+
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("committing transaction: %v", err)
+	}
+
+	return nil
+}
+
+// ReplacePasswordHash swaps the stored hash for an upgraded hash of the same
+// password. Nothing changes when the password was changed in the meantime.
+func (s *PostgresStorage) ReplacePasswordHash(userId int, oldHash string, newHash string) error {
+	_, err := s.db.Exec("UPDATE users SET password = $3 WHERE id = $1 AND password = $2", userId, oldHash, newHash)
+
+	if err != nil {
+		return fmt.Errorf("replacing password hash: %v", err)
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) InsertPasswordResetToken(userId int, tokenHash string, ttl time.Duration) error {
+	_, err := s.db.Exec("INSERT INTO password_reset_tokens(token_hash, user_id, expires_at) VALUES ($1, $2, LOCALTIMESTAMP + $3 * INTERVAL '1 second')", tokenHash, userId, ttl.Seconds())
+
+	if err != nil {
+		return fmt.Errorf("inserting password reset token: %v", err)
+	}
+
+	return nil
+}
+
+// GetPasswordResetUserId returns the user of a reset token that can still be used.
+func (s *PostgresStorage) GetPasswordResetUserId(tokenHash string) (int, error) {
+	var userId int
+
+	err := s.db.QueryRow("SELECT user_id FROM password_reset_tokens WHERE token_hash = $1 AND used_at IS NULL AND expires_at > LOCALTIMESTAMP", tokenHash).Scan(&userId)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInvalidResetToken
+		}
+
+		return 0, fmt.Errorf("getting password reset token: %v", err)
+	}
+
+	return userId, nil
+}
+
+// ResetPassword consumes the reset token and sets the new password. A token
+// works once and only until it expires.
+func (s *PostgresStorage) ResetPassword(tokenHash string, password string) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("beginning transaction: %v", err)
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var userId int
+
+	err = tx.QueryRow("UPDATE password_reset_tokens SET used_at = LOCALTIMESTAMP WHERE token_hash = $1 AND used_at IS NULL AND expires_at > LOCALTIMESTAMP RETURNING user_id", tokenHash).Scan(&userId)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrInvalidResetToken
+			return 0, err
+		}
+
+		return 0, fmt.Errorf("consuming reset token: %v", err)
+	}
+
+	err = setPassword(tx, userId, password, 0)
+
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("committing transaction: %v", err)
+	}
+
+	return userId, nil
+}
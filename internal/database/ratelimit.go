@@ -0,0 +1,38 @@
+package database
+
+import "fmt"
+
+// TakeRateLimitToken refills and takes from a token bucket in a single
+// statement, so concurrent requests from several instances can't overdraw it.
+func (s *PostgresStorage) TakeRateLimitToken(key string, rate float64, burst int) (float64, bool, error) {
+	var tokens float64
+	var allowed bool
+
+	// the refill is computed from the row the conflict locked, not from the
+	// statement's snapshot, so a concurrent take is always seen. LOCALTIMESTAMP
+	// is the start of our transaction and can be older than the last update.
+	err := s.db.QueryRow(`INSERT INTO rate_limit_buckets AS b (key, tokens, allowed, updated_at) VALUES ($1, $3 - 1, TRUE, LOCALTIMESTAMP)
+		ON CONFLICT (key) DO UPDATE SET
+			tokens = LEAST($3::float8, b.tokens + GREATEST(EXTRACT(EPOCH FROM LOCALTIMESTAMP - b.updated_at), 0) * $2)
+				- CASE WHEN LEAST($3::float8, b.tokens + GREATEST(EXTRACT(EPOCH FROM LOCALTIMESTAMP - b.updated_at), 0) * $2) >= 1 THEN 1 ELSE 0 END,
+			allowed = LEAST($3::float8, b.tokens + GREATEST(EXTRACT(EPOCH FROM LOCALTIMESTAMP - b.updated_at), 0) * $2) >= 1,
+			updated_at = GREATEST(LOCALTIMESTAMP, b.updated_at)
+		RETURNING tokens, allowed`, key, rate, burst).Scan(&tokens, &allowed)
+
+	if err != nil {
+		return 0, false, fmt.Errorf("taking rate limit token: %v", err)
+	}
+
+	return tokens, allowed, nil
+}
+
+// PruneRateLimitBuckets removes buckets that have been idle long enough to be full again.
+func (s *PostgresStorage) PruneRateLimitBuckets() error {
+	_, err := s.db.Exec("DELETE FROM rate_limit_buckets WHERE updated_at < LOCALTIMESTAMP - INTERVAL '1 day'")
+
+	if err != nil {
+		return fmt.Errorf("pruning rate limit buckets: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"auth-service/internal/entities"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// InsertSession records a sign-in. Expired sessions of the user are cleared
+// on the way, so the table doesn't grow with every login. Suspended users
+// can't sign in.
+func (s *PostgresStorage) InsertSession(session entities.Session, ttl time.Duration) (int, error) {
+	_, err := s.db.Exec("DELETE FROM user_sessions WHERE user_id = $1 AND expires_at <= LOCALTIMESTAMP", session.UserId)
+
+	if err != nil {
+		return 0, fmt.Errorf("deleting expired sessions: %v", err)
+	}
+
+	var id int
+
+	err = s.db.QueryRow("INSERT INTO user_sessions(user_id, user_agent, ip, expires_at) SELECT id, $2, $3, LOCALTIMESTAMP + $4 * INTERVAL '1 second' FROM users WHERE id = $1 AND suspended_at IS NULL RETURNING id",
+		session.UserId, session.UserAgent, session.Ip, ttl.Seconds()).Scan(&id)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrAccountSuspended
+		}
+
+		return 0, fmt.Errorf("inserting session: %v", err)
+	}
+
+	return id, nil
+}
+
+// TouchSession checks the session is still active, records the activity and
+// returns the session's user.
+func (s *PostgresStorage) TouchSession(id int) (int, error) {
+	var userId int
+
+	err := s.db.QueryRow("UPDATE user_sessions SET last_seen_at = LOCALTIMESTAMP WHERE id = $1 AND expires_at > LOCALTIMESTAMP RETURNING user_id", id).Scan(&userId)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrSessionNotFound
+		}
+
+		return 0, fmt.Errorf("touching session: %v", err)
+	}
+
+	return userId, nil
+}
+
+func (s *PostgresStorage) GetSessions(userId int) ([]entities.Session, error) {
+	rows, err := s.db.Query("SELECT id, user_id, user_agent, ip, expires_at, last_seen_at, created_at FROM user_sessions WHERE user_id = $1 AND expires_at > LOCALTIMESTAMP ORDER BY last_seen_at DESC", userId)
+
+	if err != nil {
+		return nil, fmt.Errorf("getting sessions: %v", err)
+	}
+
+	defer rows.Close()
+
+	var sessions []entities.Session
+
+	for rows.Next() {
+		var session entities.Session
+
+		err := rows.Scan(&session.Id, &session.UserId, &session.UserAgent, &session.Ip, &session.ExpiresAt, &session.LastSeenAt, &session.CreatedAt)
+
+		if err != nil {
+			return nil, fmt.Errorf("scanning rows: %v", err)
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// DeleteSession signs out one of the user's sessions.
+func (s *PostgresStorage) DeleteSession(userId int, id int) error {
+	result, err := s.db.Exec("DELETE FROM user_sessions WHERE id = $1 AND user_id = $2", id, userId)
+
+	if err != nil {
+		return fmt.Errorf("deleting session: %v", err)
+	}
+
+	deleted, err := result.RowsAffected()
+
+	if err != nil {
+		return fmt.Errorf("deleting session: %v", err)
+	}
+
+	if deleted == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// DeleteOtherSessions signs out every session of the user except keep, and
+// every OAuth client, whose refresh tokens would otherwise keep working.
+func (s *PostgresStorage) DeleteOtherSessions(userId int, keep int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %v", err)
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.Exec("DELETE FROM user_sessions WHERE user_id = $1 AND id <> $2", userId, keep)
+
+	if err != nil {
+		return fmt.Errorf("deleting sessions: %v", err)
+	}
+
+	_, err = tx.Exec("UPDATE oauth_refresh_tokens SET revoked_at = LOCALTIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL", userId)
+
+	if err != nil {
+		return fmt.Errorf("revoking refresh tokens: %v", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("committing transaction: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,196 @@
+package database
+
+import (
+	"auth-service/internal/entities"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/lib/pq"
+)
+
+const (
+	maxTagsPerArticle = 10
+	maxTagLength      = 50
+)
+
+var (
+	ErrTooManyTags = errors.New("too many tags")
+	ErrInvalidTag  = errors.New("invalid tag")
+)
+
+// slugify lowercases a tag name and replaces every run of non-alphanumeric
+// characters with a single dash, so "Go Lang" and "go-lang" end up as one tag.
+func slugify(name string) string {
+	var b strings.Builder
+
+	dash := false
+
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+
+		if !dash && b.Len() > 0 {
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// filterSlugs turns the tags of a filter into distinct slugs, so "Go" and
+// "go" count once when every tag has to match. A tag that can't be a slug
+// could never match and is rejected.
+func filterSlugs(tags []string) ([]string, error) {
+	slugs := make([]string, 0, len(tags))
+
+	for _, tag := range tags {
+		slug := slugify(tag)
+
+		if slug == "" {
+			return nil, ErrInvalidTag
+		}
+
+		if !slices.Contains(slugs, slug) {
+			slugs = append(slugs, slug)
+		}
+	}
+
+	return slugs, nil
+}
+
+func setArticleTags(tx *sql.Tx, articleId int, tags []entities.Tag) error {
+	if len(tags) > maxTagsPerArticle {
+		return ErrTooManyTags
+	}
+
+	_, err := tx.Exec("DELETE FROM article_tags WHERE article_id = $1", articleId)
+
+	if err != nil {
+		return fmt.Errorf("clearing article tags: %v", err)
+	}
+
+	for _, tag := range tags {
+		name := strings.Join(strings.Fields(tag.Name), " ")
+		slug := slugify(name)
+
+		if slug == "" || len(name) > maxTagLength {
+			return ErrInvalidTag
+		}
+
+		var tagId int
+
+		// DO UPDATE instead of DO NOTHING so RETURNING yields the id of an existing tag too
+		err = tx.QueryRow("INSERT INTO tags(name, slug) VALUES ($1, $2) ON CONFLICT (slug) DO UPDATE SET slug = EXCLUDED.slug RETURNING id", name, slug).Scan(&tagId)
+
+		if err != nil {
+			return fmt.Errorf("upserting tag: %v", err)
+		}
+
+		_, err = tx.Exec("INSERT INTO article_tags(article_id, tag_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", articleId, tagId)
+
+		if err != nil {
+			return fmt.Errorf("linking tag: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// attachTags loads the tags of all given articles with a single query.
+func (s *PostgresStorage) attachTags(articles []entities.Article) ([]entities.Article, error) {
+	if len(articles) == 0 {
+		return articles, nil
+	}
+
+	ids := make([]int64, len(articles))
+	index := make(map[int]int, len(articles))
+
+	for i, article := range articles {
+		ids[i] = int64(article.Id)
+		index[article.Id] = i
+	}
+
+	rows, err := s.db.Query("SELECT at.article_id, t.id, t.name, t.slug FROM article_tags at JOIN tags t ON t.id = at.tag_id WHERE at.article_id = ANY($1) ORDER BY t.name", pq.Array(ids))
+
+	if err != nil {
+		return nil, fmt.Errorf("querying article tags: %v", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var articleId int
+		var tag entities.Tag
+
+		err := rows.Scan(&articleId, &tag.Id, &tag.Name, &tag.Slug)
+
+		if err != nil {
+			return nil, fmt.Errorf("scanning rows: %v", err)
+		}
+
+		i := index[articleId]
+		articles[i].Tags = append(articles[i].Tags, tag)
+	}
+
+	return articles, rows.Err()
+}
+
+func (s *PostgresStorage) GetTags() ([]entities.Tag, error) {
+	rows, err := s.db.Query(`SELECT t.id, t.name, t.slug, COUNT(at.article_id) AS articles_count
+		FROM tags t
+		LEFT JOIN article_tags at ON at.tag_id = t.id
+		GROUP BY t.id
+		ORDER BY articles_count DESC, t.name`)
+
+	if err != nil {
+		return nil, fmt.Errorf("querying tags: %v", err)
+	}
+
+	defer rows.Close()
+
+	var tags []entities.Tag
+
+	for rows.Next() {
+		var tag entities.Tag
+
+		err := rows.Scan(&tag.Id, &tag.Name, &tag.Slug, &tag.ArticlesCount)
+
+		if err != nil {
+			return nil, fmt.Errorf("scanning rows: %v", err)
+		}
+
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+func (s *PostgresStorage) GetArticlesByTag(slug string) ([]entities.Article, error) {
+	rows, err := s.db.Query(`SELECT `+articleColumns+` FROM articles a
+		JOIN article_tags at ON at.article_id = a.id
+		JOIN tags t ON t.id = at.tag_id
+		WHERE t.slug = $1
+		ORDER BY a.created_at DESC, a.id DESC`, slugify(slug))
+
+	if err != nil {
+		return nil, fmt.Errorf("getting articles by tag: %v", err)
+	}
+
+	defer rows.Close()
+
+	articles, err := scanArticles(rows)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.attachTags(articles)
+}
@@ -0,0 +1,46 @@
+package database
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := map[string]string{
+		"Go":             "go",
+		"  Go Lang ":     "go-lang",
+		"go-lang":        "go-lang",
+		"C++ / Rust!":    "c-rust",
+		"Ünïcode Straße": "ünïcode-straße",
+		"---":            "",
+		"":               "",
+	}
+
+	for name, want := range tests {
+		if got := slugify(name); got != want {
+			t.Errorf("slugify(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestFilterSlugs(t *testing.T) {
+	tests := []struct {
+		tags []string
+		want []string
+		err  error
+	}{
+		{tags: []string{"Go", "go", "GO "}, want: []string{"go"}},
+		{tags: []string{"Go Lang", "go-lang", "rust"}, want: []string{"go-lang", "rust"}},
+		{tags: []string{"!!!"}, err: ErrInvalidTag},
+		{tags: []string{"go", ""}, err: ErrInvalidTag},
+	}
+
+	for _, tt := range tests {
+		got, err := filterSlugs(tt.tags)
+
+		if !errors.Is(err, tt.err) || !slices.Equal(got, tt.want) {
+			t.Errorf("filterSlugs(%q) = %q, %v; want %q, %v", tt.tags, got, err, tt.want, tt.err)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"auth-service/internal/entities"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+var ErrTokenNotFound = errors.New("token not found")
+
+func (s *PostgresStorage) InsertPersonalAccessToken(token entities.PersonalAccessToken, tokenHash string) (int, error) {
+	var id int
+
+	err := s.db.QueryRow("INSERT INTO personal_access_tokens(user_id, name, token_hash, scopes, expires_at) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		token.UserId, token.Name, tokenHash, pq.Array(token.Scopes), token.ExpiresAt).Scan(&id)
+
+	if err != nil {
+		return 0, fmt.Errorf("inserting personal access token: %v", err)
+	}
+
+	return id, nil
+}
+
+func (s *PostgresStorage) GetPersonalAccessTokens(userId int) ([]entities.PersonalAccessToken, error) {
+	rows, err := s.db.Query("SELECT id, user_id, name, scopes, expires_at, last_used_at, created_at FROM personal_access_tokens WHERE user_id = $1 ORDER BY created_at DESC", userId)
+
+	if err != nil {
+		return nil, fmt.Errorf("getting personal access tokens: %v", err)
+	}
+
+	defer rows.Close()
+
+	var tokens []entities.PersonalAccessToken
+
+	for rows.Next() {
+		var token entities.PersonalAccessToken
+
+		err := rows.Scan(&token.Id, &token.UserId, &token.Name, pq.Array(&token.Scopes), &token.ExpiresAt, &token.LastUsedAt, &token.CreatedAt)
+
+		if err != nil {
+			return nil, fmt.Errorf("scanning rows: %v", err)
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// DeletePersonalAccessToken revokes one of the user's tokens.
+func (s *PostgresStorage) DeletePersonalAccessToken(userId int, id int) error {
+	result, err := s.db.Exec("DELETE FROM personal_access_tokens WHERE id = $1 AND user_id = $2", id, userId)
+
+	if err != nil {
+		return fmt.Errorf("deleting personal access token: %v", err)
+	}
+
+	deleted, err := result.RowsAffected()
+
+	if err != nil {
+		return fmt.Errorf("deleting personal access token: %v", err)
+	}
+
+	if deleted == 0 {
+		return ErrTokenNotFound
+	}
+
+	return nil
+}
+
+// UsePersonalAccessToken looks up an unexpired token of an active account and
+// records its use.
+func (s *PostgresStorage) UsePersonalAccessToken(tokenHash string) (int, string, []string, error) {
+	var userId int
+	var username string
+	var scopes []string
+
+	err := s.db.QueryRow(`UPDATE personal_access_tokens t SET last_used_at = LOCALTIMESTAMP
+		FROM users u
+		WHERE u.id = t.user_id AND t.token_hash = $1 AND (t.expires_at IS NULL OR t.expires_at > LOCALTIMESTAMP) AND u.suspended_at IS NULL
+		RETURNING t.user_id, u.username, t.scopes`, tokenHash).Scan(&userId, &username, pq.Array(&scopes))
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, "", nil, ErrTokenNotFound
+		}
+
+		return 0, "", nil, fmt.Errorf("using personal access token: %v", err)
+	}
+
+	// a token always carries a non-nil scope list, even an empty one
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	return userId, username, scopes, nil
+}
@@ -0,0 +1,264 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrTOTPNotFound = errors.New("two-factor authentication is not set up")
+	ErrTOTPEnabled  = errors.New("two-factor authentication is already enabled")
+	// ErrInvalidLoginChallenge is returned for unknown, expired and already answered challenges
+	ErrInvalidLoginChallenge = errors.New("invalid or expired login challenge")
+)
+
+// GetTOTPSecret returns the user's TOTP secret and whether enrollment was confirmed.
+func (s *PostgresStorage) GetTOTPSecret(userId int) (string, bool, error) {
+	var secret string
+	var confirmed bool
+
+	err := s.db.QueryRow("SELECT secret, confirmed_at IS NOT NULL FROM user_totp WHERE user_id = $1", userId).Scan(&secret, &confirmed)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", false, ErrTOTPNotFound
+		}
+
+		return "", false, fmt.Errorf("getting totp secret: %v", err)
+	}
+
+	return secret, confirmed, nil
+}
+
+func (s *PostgresStorage) IsTOTPEnabled(userId int) (bool, error) {
+	_, confirmed, err := s.GetTOTPSecret(userId)
+
+	if errors.Is(err, ErrTOTPNotFound) {
+		return false, nil
+	}
+
+	return confirmed, err
+}
+
+// SaveTOTPSecret starts an enrollment, replacing any unconfirmed one.
+func (s *PostgresStorage) SaveTOTPSecret(userId int, secret string) error {
+	result, err := s.db.Exec(`INSERT INTO user_totp(user_id, secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, created_at = CURRENT_TIMESTAMP
+		WHERE user_totp.confirmed_at IS NULL`, userId, secret)
+
+	if err != nil {
+		return fmt.Errorf("saving totp secret: %v", err)
+	}
+
+	updated, err := result.RowsAffected()
+
+	if err != nil {
+		return fmt.Errorf("saving totp secret: %v", err)
+	}
+
+	if updated == 0 {
+		return ErrTOTPEnabled
+	}
+
+	return nil
+}
+
+// ConfirmTOTP enables two-factor authentication and replaces the recovery codes.
+func (s *PostgresStorage) ConfirmTOTP(userId int, step int64, codeHashes []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %v", err)
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	result, err := tx.Exec("UPDATE user_totp SET confirmed_at = LOCALTIMESTAMP, last_step = $2 WHERE user_id = $1 AND confirmed_at IS NULL", userId, step)
+
+	if err != nil {
+		return fmt.Errorf("confirming totp: %v", err)
+	}
+
+	updated, err := result.RowsAffected()
+
+	if err != nil {
+		return fmt.Errorf("confirming totp: %v", err)
+	}
+
+	if updated == 0 {
+		err = ErrTOTPEnabled
+		return err
+	}
+
+	err = replaceRecoveryCodes(tx, userId, codeHashes)
+
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("committing transaction: %v", err)
+	}
+
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of a user with 2FA enabled.
+func (s *PostgresStorage) RegenerateRecoveryCodes(userId int, codeHashes []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %v", err)
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var enabled bool
+
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM user_totp WHERE user_id = $1 AND confirmed_at IS NOT NULL)", userId).Scan(&enabled)
+
+	if err != nil {
+		return fmt.Errorf("checking totp: %v", err)
+	}
+
+	if !enabled {
+		err = ErrTOTPNotFound
+		return err
+	}
+
+	err = replaceRecoveryCodes(tx, userId, codeHashes)
+
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("committing transaction: %v", err)
+	}
+
+	return nil
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userId int, codeHashes []string) error {
+	_, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = $1", userId)
+
+	if err != nil {
+		return fmt.Errorf("deleting recovery codes: %v", err)
+	}
+
+	for _, hash := range codeHashes {
+		_, err = tx.Exec("INSERT INTO recovery_codes(user_id, code_hash) VALUES ($1, $2)", userId, hash)
+
+		if err != nil {
+			return fmt.Errorf("inserting recovery code: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// UseTOTPStep records that the code of the step was used. It reports false
+// when that step or a later one was used already, which stops replays.
+func (s *PostgresStorage) UseTOTPStep(userId int, step int64) (bool, error) {
+	result, err := s.db.Exec("UPDATE user_totp SET last_step = $2 WHERE user_id = $1 AND confirmed_at IS NOT NULL AND last_step < $2", userId, step)
+
+	if err != nil {
+		return false, fmt.Errorf("using totp step: %v", err)
+	}
+
+	updated, err := result.RowsAffected()
+
+	if err != nil {
+		return false, fmt.Errorf("using totp step: %v", err)
+	}
+
+	return updated == 1, nil
+}
+
+// UseRecoveryCode spends one of the user's recovery codes.
+func (s *PostgresStorage) UseRecoveryCode(userId int, codeHash string) (bool, error) {
+	result, err := s.db.Exec("UPDATE recovery_codes SET used_at = LOCALTIMESTAMP WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL", userId, codeHash)
+
+	if err != nil {
+		return false, fmt.Errorf("using recovery code: %v", err)
+	}
+
+	updated, err := result.RowsAffected()
+
+	if err != nil {
+		return false, fmt.Errorf("using recovery code: %v", err)
+	}
+
+	return updated == 1, nil
+}
+
+func (s *PostgresStorage) DisableTOTP(userId int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %v", err)
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.Exec("DELETE FROM user_totp WHERE user_id = $1", userId)
+
+	if err != nil {
+		return fmt.Errorf("deleting totp: %v", err)
+	}
+
+	_, err = tx.Exec("DELETE FROM recovery_codes WHERE user_id = $1", userId)
+
+	if err != nil {
+		return fmt.Errorf("deleting recovery codes: %v", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("committing transaction: %v", err)
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) InsertLoginChallenge(id string, userId int, ttl time.Duration) error {
+	// unanswered challenges are cleaned up as new ones are issued
+	_, err := s.db.Exec("DELETE FROM login_challenges WHERE expires_at <= LOCALTIMESTAMP")
+
+	if err != nil {
+		return fmt.Errorf("deleting expired login challenges: %v", err)
+	}
+
+	_, err = s.db.Exec("INSERT INTO login_challenges(id, user_id, expires_at) VALUES ($1, $2, LOCALTIMESTAMP + $3 * INTERVAL '1 second')", id, userId, ttl.Seconds())
+
+	if err != nil {
+		return fmt.Errorf("inserting login challenge: %v", err)
+	}
+
+	return nil
+}
+
+// ConsumeLoginChallenge uses up the challenge, so each password step buys a
+// single attempt at the second factor.
+func (s *PostgresStorage) ConsumeLoginChallenge(id string, userId int) error {
+	result, err := s.db.Exec("DELETE FROM login_challenges WHERE id = $1 AND user_id = $2 AND expires_at > LOCALTIMESTAMP", id, userId)
+
+	if err != nil {
+		return fmt.Errorf("consuming login challenge: %v", err)
+	}
+
+	return expectUpdated(result, ErrInvalidLoginChallenge)
+}
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"fmt"
+)
+
+// MarkEmailVerified marks the user's email as verified, as long as it is
+// still the address the verification link was sent to. It returns
+// ErrUserNotFound when the user is gone or has changed their email since.
+func (s *PostgresStorage) MarkEmailVerified(userId int, email string) error {
+	result, err := s.db.Exec("UPDATE users SET email_verified_at = COALESCE(email_verified_at, LOCALTIMESTAMP) WHERE id = $1 AND email = $2", userId, email)
+
+	if err != nil {
+		return fmt.Errorf("marking email verified: %v", err)
+	}
+
+	updated, err := result.RowsAffected()
+
+	if err != nil {
+		return fmt.Errorf("marking email verified: %v", err)
+	}
+
+	if updated == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) IsEmailVerified(userId int) (bool, error) {
+	var verified bool
+
+	err := s.db.QueryRow("SELECT email_verified_at IS NOT NULL FROM users WHERE id = $1", userId).Scan(&verified)
+
+	if err != nil {
+		return false, fmt.Errorf("checking email verification: %v", err)
+	}
+
+	return verified, nil
+}
@@ -0,0 +1,288 @@
+package database
+
+import (
+	"auth-service/internal/entities"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("delivery not found")
+	ErrMemberNotFound   = errors.New("member not found")
+)
+
+// company roles
+
+// GetCompanyRole returns the user's role in the company, or "" when the user
+// is not a member of it.
+func (s *PostgresStorage) GetCompanyRole(userId int, companyId int) (string, error) {
+	var role string
+
+	err := s.db.QueryRow("SELECT company_role FROM users WHERE id = $1 AND company_id = $2", userId, companyId).Scan(&role)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+
+		return "", fmt.Errorf("getting company role: %v", err)
+	}
+
+	return role, nil
+}
+
+// GetCompanyOwnerId returns the owner of the company, ErrMemberNotFound when it has none.
+func (s *PostgresStorage) GetCompanyOwnerId(companyId int) (int, error) {
+	var id int
+
+	err := s.db.QueryRow("SELECT id FROM users WHERE company_id = $1 AND company_role = $2 ORDER BY id LIMIT 1", companyId, entities.CompanyRoleOwner).Scan(&id)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrMemberNotFound
+		}
+
+		return 0, fmt.Errorf("getting company owner: %v", err)
+	}
+
+	return id, nil
+}
+
+// UpdateCompanyRole changes the role of a company member. The owner's role can't be changed.
+func (s *PostgresStorage) UpdateCompanyRole(userId int, companyId int, role string) error {
+	result, err := s.db.Exec("UPDATE users SET company_role = $1 WHERE id = $2 AND company_id = $3 AND company_role <> $4", role, userId, companyId, entities.CompanyRoleOwner)
+
+	if err != nil {
+		return fmt.Errorf("updating company role: %v", err)
+	}
+
+	updated, err := result.RowsAffected()
+
+	if err != nil {
+		return fmt.Errorf("updating company role: %v", err)
+	}
+
+	if updated == 0 {
+		return ErrMemberNotFound
+	}
+
+	return nil
+}
+
+// webhooks
+
+func (s *PostgresStorage) InsertWebhook(webhook entities.Webhook) (int, error) {
+	var id int
+
+	err := s.db.QueryRow("INSERT INTO webhooks(company_id, url, secret, event_types) VALUES ($1, $2, $3, $4) RETURNING id", webhook.CompanyId, webhook.Url, webhook.Secret, pq.Array(webhook.EventTypes)).Scan(&id)
+
+	if err != nil {
+		return 0, fmt.Errorf("inserting webhook: %v", err)
+	}
+
+	return id, nil
+}
+
+// GetWebhooksByCompanyId lists the company's webhooks without their secrets.
+func (s *PostgresStorage) GetWebhooksByCompanyId(companyId int) ([]entities.Webhook, error) {
+	rows, err := s.db.Query("SELECT id, company_id, url, event_types, active, created_at FROM webhooks WHERE company_id = $1 ORDER BY id", companyId)
+
+	if err != nil {
+		return nil, fmt.Errorf("getting webhooks: %v", err)
+	}
+
+	defer rows.Close()
+
+	var webhooks []entities.Webhook
+
+	for rows.Next() {
+		var webhook entities.Webhook
+
+		err := rows.Scan(&webhook.Id, &webhook.CompanyId, &webhook.Url, pq.Array(&webhook.EventTypes), &webhook.Active, &webhook.CreatedAt)
+
+		if err != nil {
+			return nil, fmt.Errorf("scanning rows: %v", err)
+		}
+
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+func (s *PostgresStorage) GetWebhookById(id int) (entities.Webhook, error) {
+	var webhook entities.Webhook
+
+	err := s.db.QueryRow("SELECT id, company_id, url, event_types, active, created_at FROM webhooks WHERE id = $1", id).Scan(&webhook.Id, &webhook.CompanyId, &webhook.Url, pq.Array(&webhook.EventTypes), &webhook.Active, &webhook.CreatedAt)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entities.Webhook{}, ErrWebhookNotFound
+		}
+
+		return entities.Webhook{}, fmt.Errorf("getting webhook: %v", err)
+	}
+
+	return webhook, nil
+}
+
+func (s *PostgresStorage) DeleteWebhook(id int) error {
+	_, err := s.db.Exec("DELETE FROM webhooks WHERE id = $1", id)
+
+	if err != nil {
+		return fmt.Errorf("deleting webhook: %v", err)
+	}
+
+	return nil
+}
+
+// deliveries
+
+const deliveryColumns = "id, webhook_id, event_id, event_type, payload, status, attempts, response_code, last_error, next_attempt_at, created_at, delivered_at"
+
+func scanDelivery(row interface{ Scan(...any) error }) (entities.WebhookDelivery, error) {
+	var delivery entities.WebhookDelivery
+	var responseCode sql.NullInt64
+	var deliveredAt sql.NullTime
+
+	err := row.Scan(&delivery.Id, &delivery.WebhookId, &delivery.EventId, &delivery.EventType, &delivery.Payload, &delivery.Status, &delivery.Attempts, &responseCode, &delivery.LastError, &delivery.NextAttemptAt, &delivery.CreatedAt, &deliveredAt)
+
+	if err != nil {
+		return entities.WebhookDelivery{}, err
+	}
+
+	if responseCode.Valid {
+		code := int(responseCode.Int64)
+		delivery.ResponseCode = &code
+	}
+
+	if deliveredAt.Valid {
+		delivery.DeliveredAt = &deliveredAt.Time
+	}
+
+	return delivery, nil
+}
+
+func (s *PostgresStorage) GetWebhookDeliveries(webhookId int, limit int) ([]entities.WebhookDelivery, error) {
+	rows, err := s.db.Query("SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE webhook_id = $1 ORDER BY id DESC LIMIT $2", webhookId, limit)
+
+	if err != nil {
+		return nil, fmt.Errorf("getting webhook deliveries: %v", err)
+	}
+
+	defer rows.Close()
+
+	var deliveries []entities.WebhookDelivery
+
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+
+		if err != nil {
+			return nil, fmt.Errorf("scanning rows: %v", err)
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func (s *PostgresStorage) GetWebhookDeliveryById(id int64) (entities.WebhookDelivery, error) {
+	delivery, err := scanDelivery(s.db.QueryRow("SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE id = $1", id))
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entities.WebhookDelivery{}, ErrDeliveryNotFound
+		}
+
+		return entities.WebhookDelivery{}, fmt.Errorf("getting webhook delivery: %v", err)
+	}
+
+	return delivery, nil
+}
+
+// RedeliverWebhook queues the delivery again with a fresh retry budget.
+func (s *PostgresStorage) RedeliverWebhook(id int64) error {
+	_, err := s.db.Exec("UPDATE webhook_deliveries SET status = $1, attempts = 0, next_attempt_at = CURRENT_TIMESTAMP WHERE id = $2", entities.DeliveryPending, id)
+
+	if err != nil {
+		return fmt.Errorf("redelivering webhook: %v", err)
+	}
+
+	return nil
+}
+
+// EnqueueWebhookDeliveries creates a pending delivery for every active webhook
+// of the company subscribed to the event type. Enqueueing the same event twice
+// is a no-op, so relaying an outbox batch again doesn't duplicate deliveries.
+func (s *PostgresStorage) EnqueueWebhookDeliveries(companyId int, eventType string, eventId int64, payload []byte) error {
+	_, err := s.db.Exec(`INSERT INTO webhook_deliveries(webhook_id, event_id, event_type, payload)
+		SELECT id, $2, $3, $4 FROM webhooks WHERE company_id = $1 AND active AND $3 = ANY(event_types)
+		ON CONFLICT DO NOTHING`, companyId, eventId, eventType, payload)
+
+	if err != nil {
+		return fmt.Errorf("enqueueing webhook deliveries: %v", err)
+	}
+
+	return nil
+}
+
+// ClaimWebhookDeliveries picks due deliveries and pushes their next attempt
+// back by the lease, so concurrent dispatchers don't send them twice.
+func (s *PostgresStorage) ClaimWebhookDeliveries(limit int, lease time.Duration) ([]entities.WebhookDelivery, error) {
+	rows, err := s.db.Query(`UPDATE webhook_deliveries d SET next_attempt_at = CURRENT_TIMESTAMP + $2 * INTERVAL '1 second'
+		FROM webhooks w
+		WHERE w.id = d.webhook_id AND d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = $3 AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING d.id, d.webhook_id, d.event_id, d.event_type, d.payload, d.attempts, w.url, w.secret`, limit, lease.Seconds(), entities.DeliveryPending)
+
+	if err != nil {
+		return nil, fmt.Errorf("claiming webhook deliveries: %v", err)
+	}
+
+	defer rows.Close()
+
+	var deliveries []entities.WebhookDelivery
+
+	for rows.Next() {
+		var delivery entities.WebhookDelivery
+
+		err := rows.Scan(&delivery.Id, &delivery.WebhookId, &delivery.EventId, &delivery.EventType, &delivery.Payload, &delivery.Attempts, &delivery.Url, &delivery.Secret)
+
+		if err != nil {
+			return nil, fmt.Errorf("scanning rows: %v", err)
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func (s *PostgresStorage) RecordWebhookAttempt(delivery entities.WebhookDelivery) error {
+	// finished deliveries keep their last schedule
+	var nextAttemptAt *time.Time
+
+	if delivery.Status == entities.DeliveryPending {
+		nextAttemptAt = &delivery.NextAttemptAt
+	}
+
+	_, err := s.db.Exec("UPDATE webhook_deliveries SET status = $1, attempts = $2, response_code = $3, last_error = $4, next_attempt_at = COALESCE($5, next_attempt_at), delivered_at = $6 WHERE id = $7",
+		delivery.Status, delivery.Attempts, delivery.ResponseCode, delivery.LastError, nextAttemptAt, delivery.DeliveredAt, delivery.Id)
+
+	if err != nil {
+		return fmt.Errorf("recording webhook attempt: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,28 @@
+package entities
+
+import "time"
+
+// AdminUser is the view of an account platform admins work with.
+type AdminUser struct {
+	Id              int        `json:"id"`
+	Email           string     `json:"email"`
+	Username        string     `json:"username"`
+	Fullname        string     `json:"fullName"`
+	Role            string     `json:"role"`
+	CompanyId       *int       `json:"companyId,omitempty"`
+	CompanyRole     string     `json:"companyRole,omitempty"`
+	EmailVerified   bool       `json:"emailVerified"`
+	SuspendedAt     *time.Time `json:"suspendedAt,omitempty"`
+	SuspendedReason string     `json:"suspendedReason,omitempty"`
+}
+
+type Stats struct {
+	Users           int `json:"users"`
+	Admins          int `json:"admins"`
+	SuspendedUsers  int `json:"suspendedUsers"`
+	UnverifiedUsers int `json:"unverifiedUsers"`
+	Companies       int `json:"companies"`
+	Articles        int `json:"articles"`
+	ActiveSessions  int `json:"activeSessions"`
+	AuditEvents     int `json:"auditEvents"`
+}
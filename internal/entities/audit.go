@@ -0,0 +1,32 @@
+package entities
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type AuditEvent struct {
+	Id         int64           `json:"id"`
+	ActorId    *int            `json:"actorId"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"targetType"`
+	TargetId   string          `json:"targetId"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	Ip         string          `json:"ip"`
+	RequestId  string          `json:"requestId"`
+	CreatedAt  time.Time       `json:"createdAt"`
+}
+
+// AuditEventFilter narrows down an audit log query. Zero values match everything.
+type AuditEventFilter struct {
+	ActorId    int
+	Action     string
+	TargetType string
+	TargetId   string
+	From       time.Time
+	To         time.Time
+	// BeforeId pages backwards: only events older than this one
+	BeforeId int64
+	Limit    int
+}
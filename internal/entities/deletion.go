@@ -0,0 +1,23 @@
+package entities
+
+import "time"
+
+// what happens to the articles of a deleted account
+const (
+	DeletionStrategyDelete    = "delete"
+	DeletionStrategyReassign  = "reassign"
+	DeletionStrategyAnonymize = "anonymize"
+)
+
+// RoleDeleted marks the placeholder account anonymized articles are moved to.
+const RoleDeleted = "deleted"
+
+type AccountDeletion struct {
+	UserId   int    `json:"userId"`
+	Strategy string `json:"strategy"`
+	// ReassignTo is the new author for the reassign strategy
+	ReassignTo  *int      `json:"reassignTo,omitempty"`
+	RequestedBy *int      `json:"requestedBy,omitempty"`
+	ScheduledAt time.Time `json:"scheduledAt"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
@@ -0,0 +1,26 @@
+package entities
+
+import "time"
+
+// states of a personal data export
+const (
+	ExportPending = "pending"
+	ExportRunning = "running"
+	ExportDone    = "done"
+	ExportFailed  = "failed"
+	ExportExpired = "expired"
+)
+
+type DataExport struct {
+	Id         int        `json:"id"`
+	UserId     int        `json:"userId"`
+	Status     string     `json:"status"`
+	ObjectKey  string     `json:"-"`
+	Error      string     `json:"error,omitempty"`
+	Attempts   int        `json:"-"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	// DownloadUrl is a short-lived link to the archive, only set on a finished export
+	DownloadUrl string `json:"downloadUrl,omitempty"`
+}
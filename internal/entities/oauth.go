@@ -0,0 +1,26 @@
+package entities
+
+import "time"
+
+// OAuthClient is an application that delegates sign in to this service.
+// Public clients (single page and mobile apps) have no secret and must use PKCE.
+type OAuthClient struct {
+	Id           string    `json:"id"`
+	Name         string    `json:"name"`
+	Secret       string    `json:"secret,omitempty"`
+	SecretHash   string    `json:"-"`
+	RedirectUris []string  `json:"redirectUris"`
+	Scopes       []string  `json:"scopes"`
+	Public       bool      `json:"public"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// OAuthGrant is what an authorization code or refresh token stands for.
+type OAuthGrant struct {
+	ClientId      string
+	UserId        int
+	Scopes        []string
+	RedirectUri   string
+	Nonce         string
+	CodeChallenge string
+}
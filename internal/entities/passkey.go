@@ -0,0 +1,14 @@
+package entities
+
+import "time"
+
+type Passkey struct {
+	Id           int        `json:"id"`
+	UserId       int        `json:"userId"`
+	Name         string     `json:"name"`
+	CredentialId []byte     `json:"-"`
+	PublicKey    []byte     `json:"-"`
+	SignCount    uint32     `json:"-"`
+	LastUsedAt   *time.Time `json:"lastUsedAt"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
@@ -0,0 +1,12 @@
+package entities
+
+import "time"
+
+type ReadingList struct {
+	Id        int       `json:"id"`
+	UserId    int       `json:"userId"`
+	Name      string    `json:"name"`
+	IsPublic  bool      `json:"isPublic"`
+	CreatedAt time.Time `json:"createdAt"`
+	Articles  []Article `json:"articles,omitempty"`
+}
@@ -0,0 +1,14 @@
+package entities
+
+import "time"
+
+type Session struct {
+	Id         int       `json:"id"`
+	UserId     int       `json:"userId"`
+	UserAgent  string    `json:"userAgent"`
+	Ip         string    `json:"ip"`
+	Current    bool      `json:"current"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
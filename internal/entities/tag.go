@@ -0,0 +1,8 @@
+package entities
+
+type Tag struct {
+	Id            int    `json:"id"`
+	Name          string `json:"name"`
+	Slug          string `json:"slug"`
+	ArticlesCount int    `json:"articlesCount,omitempty"`
+}
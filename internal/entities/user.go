@@ -1,12 +1,27 @@
 package entities
 
 type User struct {
-	Id        int    `json:"id"`
-	Email     string `json:"email"`
-	Username  string `json:"username"`
-	Password  string `json:"password"`
-	Fullname  string `json:"fullName"`
-	CompanyId *int   `json:"companyId,omitempty"`
-	Position  string `json:"position"`
-	AvatarUrl string `json:"avatarURL"`
+	Id            int    `json:"id"`
+	Email         string `json:"email"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	Fullname      string `json:"fullName"`
+	CompanyId     *int   `json:"companyId,omitempty"`
+	Position      string `json:"position"`
+	CompanyRole   string `json:"companyRole,omitempty"`
+	AvatarUrl     string `json:"avatarURL"`
+	EmailVerified bool   `json:"emailVerified"`
 }
+
+// roles of a user inside their company
+const (
+	CompanyRoleOwner  = "owner"
+	CompanyRoleAdmin  = "admin"
+	CompanyRoleMember = "member"
+)
+
+// platform roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
@@ -0,0 +1,42 @@
+package entities
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type Webhook struct {
+	Id         int       `json:"id"`
+	CompanyId  int       `json:"companyId"`
+	Url        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"`
+	EventTypes []string  `json:"eventTypes"`
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// webhook delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+type WebhookDelivery struct {
+	Id            int64           `json:"id"`
+	WebhookId     int             `json:"webhookId"`
+	EventId       int64           `json:"eventId"`
+	EventType     string          `json:"eventType"`
+	Payload       json.RawMessage `json:"payload"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	ResponseCode  *int            `json:"responseCode"`
+	LastError     string          `json:"lastError,omitempty"`
+	NextAttemptAt time.Time       `json:"nextAttemptAt"`
+	CreatedAt     time.Time       `json:"createdAt"`
+	DeliveredAt   *time.Time      `json:"deliveredAt"`
+
+	// target of the delivery, filled when it is claimed for sending
+	Url    string `json:"-"`
+	Secret string `json:"-"`
+}
@@ -0,0 +1,92 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// event types
+const (
+	UserCreated      = "UserCreated"
+	ArticlePublished = "ArticlePublished"
+	ArticleUpdated   = "ArticleUpdated"
+	ArticleDeleted   = "ArticleDeleted"
+	CompanyCreated   = "CompanyCreated"
+	MemberJoined     = "MemberJoined"
+)
+
+// aggregate types, events of one aggregate are delivered in order
+const (
+	AggregateUser    = "user"
+	AggregateArticle = "article"
+	AggregateCompany = "company"
+)
+
+type Event struct {
+	Id            int64           `json:"id"`
+	AggregateType string          `json:"aggregateType"`
+	AggregateId   int             `json:"aggregateId"`
+	Type          string          `json:"type"`
+	Payload       json.RawMessage `json:"payload"`
+	CreatedAt     time.Time       `json:"createdAt"`
+}
+
+func New(aggregateType string, aggregateId int, eventType string, payload any) (Event, error) {
+	data, err := json.Marshal(payload)
+
+	if err != nil {
+		return Event{}, fmt.Errorf("encoding %s payload: %v", eventType, err)
+	}
+
+	return Event{
+		AggregateType: aggregateType,
+		AggregateId:   aggregateId,
+		Type:          eventType,
+		Payload:       data,
+	}, nil
+}
+
+// Key identifies the aggregate the event belongs to. It is used as the
+// Kafka message key, so all events of one aggregate land on one partition.
+func (e Event) Key() string {
+	return e.AggregateType + ":" + strconv.Itoa(e.AggregateId)
+}
+
+// Publisher delivers a batch of events. The batch is in outbox order and
+// Publish must not return before every event has been accepted.
+type Publisher interface {
+	Publish(ctx context.Context, events []Event) error
+}
+
+// payloads
+
+type UserCreatedPayload struct {
+	Id       int    `json:"id"`
+	Email    string `json:"email"`
+	Username string `json:"username"`
+	Fullname string `json:"fullName"`
+}
+
+// ArticlePayload is shared by the article events. CompanyId is the company
+// the article belongs to, or the author's company for personal articles.
+type ArticlePayload struct {
+	Id        int    `json:"id"`
+	AuthorId  int    `json:"authorId"`
+	CompanyId int    `json:"companyId,omitempty"`
+	Title     string `json:"title"`
+}
+
+type CompanyCreatedPayload struct {
+	Id      int    `json:"id"`
+	Name    string `json:"name"`
+	OwnerId int    `json:"ownerId"`
+}
+
+type MemberJoinedPayload struct {
+	CompanyId int    `json:"companyId"`
+	UserId    int    `json:"userId"`
+	Position  string `json:"position"`
+}
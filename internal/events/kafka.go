@@ -0,0 +1,59 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type KafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+func NewKafkaPublisher(brokers []string, topic string) *KafkaPublisher {
+	return &KafkaPublisher{
+		writer: &kafka.Writer{
+			Addr:  kafka.TCP(brokers...),
+			Topic: topic,
+			// hashing the key keeps every aggregate on a single partition
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+		},
+	}
+}
+
+func (p *KafkaPublisher) Publish(ctx context.Context, events []Event) error {
+	messages := make([]kafka.Message, len(events))
+
+	for i, event := range events {
+		value, err := json.Marshal(event)
+
+		if err != nil {
+			return fmt.Errorf("encoding event %d: %v", event.Id, err)
+		}
+
+		messages[i] = kafka.Message{
+			Key:   []byte(event.Key()),
+			Value: value,
+			Headers: []kafka.Header{
+				{Key: "event-id", Value: []byte(strconv.FormatInt(event.Id, 10))},
+				{Key: "event-type", Value: []byte(event.Type)},
+			},
+		}
+	}
+
+	err := p.writer.WriteMessages(ctx, messages...)
+
+	if err != nil {
+		return fmt.Errorf("writing messages to kafka: %v", err)
+	}
+
+	return nil
+}
+
+func (p *KafkaPublisher) Close() error {
+	return p.writer.Close()
+}
@@ -0,0 +1,67 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var ErrBrokerUnavailable = errors.New("broker unavailable")
+
+// MemoryBroker is an in-process stand-in for Kafka used in tests. Events are
+// kept in one list in publish order, EventsByKey picks out one aggregate.
+type MemoryBroker struct {
+	mu     sync.Mutex
+	events []Event
+	fail   int
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{}
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, events []Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.fail > 0 {
+		b.fail--
+		return ErrBrokerUnavailable
+	}
+
+	b.events = append(b.events, events...)
+
+	return nil
+}
+
+// FailNext makes the next n calls to Publish fail, to exercise redelivery.
+func (b *MemoryBroker) FailNext(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.fail = n
+}
+
+// Events returns every published event in publish order.
+func (b *MemoryBroker) Events() []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]Event(nil), b.events...)
+}
+
+// EventsByKey returns the published events of a single aggregate.
+func (b *MemoryBroker) EventsByKey(key string) []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var events []Event
+
+	for _, event := range b.events {
+		if event.Key() == key {
+			events = append(events, event)
+		}
+	}
+
+	return events
+}
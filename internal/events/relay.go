@@ -0,0 +1,73 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Outbox hands out unpublished events in the order they were written.
+// RelayOutbox calls publish with the next batch and marks the batch as
+// published only when publish succeeds, so events are delivered at least once.
+type Outbox interface {
+	RelayOutbox(limit int, publish func([]Event) error) (int, error)
+}
+
+type Relay struct {
+	outbox    Outbox
+	publisher Publisher
+	batchSize int
+	interval  time.Duration
+}
+
+func NewRelay(outbox Outbox, publisher Publisher) *Relay {
+	return &Relay{
+		outbox:    outbox,
+		publisher: publisher,
+		batchSize: 100,
+		interval:  time.Second,
+	}
+}
+
+// Run relays events until ctx is cancelled. Full batches are followed by the
+// next one right away, otherwise the relay waits for the poll interval.
+func (r *Relay) Run(ctx context.Context) {
+	for {
+		n, err := r.outbox.RelayOutbox(r.batchSize, func(events []Event) error {
+			return r.publisher.Publish(ctx, events)
+		})
+
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to relay outbox events")
+		}
+
+		if err == nil && n == r.batchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.interval):
+		}
+	}
+}
+
+type multiPublisher []Publisher
+
+// MultiPublisher publishes every batch to all publishers in turn. A failing
+// publisher fails the batch, which is then retried for all of them.
+func MultiPublisher(publishers ...Publisher) Publisher {
+	return multiPublisher(publishers)
+}
+
+func (m multiPublisher) Publish(ctx context.Context, events []Event) error {
+	for _, publisher := range m {
+		if err := publisher.Publish(ctx, events); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,194 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryOutbox follows the contract of the Postgres outbox: a batch is only
+// marked as published when publish succeeds.
+type memoryOutbox struct {
+	mu        sync.Mutex
+	events    []Event
+	published int
+}
+
+func (o *memoryOutbox) RelayOutbox(limit int, publish func([]Event) error) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	end := min(o.published+limit, len(o.events))
+	batch := o.events[o.published:end]
+
+	if len(batch) == 0 {
+		return 0, nil
+	}
+
+	if err := publish(batch); err != nil {
+		return 0, err
+	}
+
+	o.published = end
+
+	return len(batch), nil
+}
+
+func (o *memoryOutbox) unpublished() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return len(o.events) - o.published
+}
+
+func newOutbox(t *testing.T, n int) *memoryOutbox {
+	t.Helper()
+
+	outbox := &memoryOutbox{}
+
+	for i := 1; i <= n; i++ {
+		event, err := New(AggregateArticle, i%3, ArticleUpdated, ArticlePayload{Id: i % 3, Title: "title"})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		event.Id = int64(i)
+		outbox.events = append(outbox.events, event)
+	}
+
+	return outbox
+}
+
+// runRelay runs the relay until the outbox is drained or the test times out.
+func runRelay(t *testing.T, outbox *memoryOutbox, publisher Publisher) {
+	t.Helper()
+
+	relay := NewRelay(outbox, publisher)
+	relay.batchSize = 4
+	relay.interval = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		relay.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for outbox.unpublished() > 0 {
+		if time.Now().After(deadline) {
+			cancel()
+			t.Fatalf("%d events were not relayed", outbox.unpublished())
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	<-done
+}
+
+func eventIds(events []Event) []int64 {
+	ids := make([]int64, len(events))
+
+	for i, event := range events {
+		ids[i] = event.Id
+	}
+
+	return ids
+}
+
+func TestRelayPublishesInOutboxOrder(t *testing.T) {
+	outbox := newOutbox(t, 10)
+	broker := NewMemoryBroker()
+
+	runRelay(t, outbox, broker)
+
+	got := eventIds(broker.Events())
+
+	if len(got) != 10 {
+		t.Fatalf("published %d events, want 10", len(got))
+	}
+
+	for i, id := range got {
+		if id != int64(i+1) {
+			t.Fatalf("published %v, want ids 1 to 10 in order", got)
+		}
+	}
+}
+
+func TestRelayRedeliversFailedBatches(t *testing.T) {
+	outbox := newOutbox(t, 10)
+	broker := NewMemoryBroker()
+	broker.FailNext(3)
+
+	runRelay(t, outbox, broker)
+
+	got := eventIds(broker.Events())
+
+	if len(got) != 10 {
+		t.Fatalf("published %v, want every event exactly once", got)
+	}
+
+	for i, id := range got {
+		if id != int64(i+1) {
+			t.Fatalf("published %v, want ids 1 to 10 in order", got)
+		}
+	}
+}
+
+func TestRelayKeepsAggregateOrder(t *testing.T) {
+	outbox := newOutbox(t, 12)
+	broker := NewMemoryBroker()
+	broker.FailNext(1)
+
+	runRelay(t, outbox, broker)
+
+	for aggregate := 0; aggregate < 3; aggregate++ {
+		key := Event{AggregateType: AggregateArticle, AggregateId: aggregate}.Key()
+		events := broker.EventsByKey(key)
+
+		if len(events) != 4 {
+			t.Fatalf("%s has %d events, want 4", key, len(events))
+		}
+
+		for i := 1; i < len(events); i++ {
+			if events[i].Id <= events[i-1].Id {
+				t.Fatalf("%s events out of order: %v", key, eventIds(events))
+			}
+		}
+	}
+}
+
+func TestMultiPublisherFailsTheWholeBatch(t *testing.T) {
+	first := NewMemoryBroker()
+	second := NewMemoryBroker()
+	second.FailNext(1)
+
+	publisher := MultiPublisher(first, second)
+	batch := newOutbox(t, 2).events
+
+	err := publisher.Publish(context.Background(), batch)
+
+	if !errors.Is(err, ErrBrokerUnavailable) {
+		t.Fatalf("Publish returned %v, want ErrBrokerUnavailable", err)
+	}
+
+	if err := publisher.Publish(context.Background(), batch); err != nil {
+		t.Fatalf("retry failed: %v", err)
+	}
+
+	// at least once: the first publisher sees the batch again on retry
+	if got := len(first.Events()); got != 4 {
+		t.Fatalf("first publisher got %d events, want 4", got)
+	}
+
+	if got := len(second.Events()); got != 2 {
+		t.Fatalf("second publisher got %d events, want 2", got)
+	}
+}
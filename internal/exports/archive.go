@@ -0,0 +1,293 @@
+package exports
+
+import (
+	"archive/zip"
+	"auth-service/internal/entities"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"time"
+)
+
+const formatVersion = 1
+
+type manifest struct {
+	FormatVersion int             `json:"formatVersion"`
+	UserId        int             `json:"userId"`
+	GeneratedAt   time.Time       `json:"generatedAt"`
+	Files         []manifestEntry `json:"files"`
+	// MissingImages are uploads that could not be fetched when building the archive
+	MissingImages []string `json:"missingImages,omitempty"`
+	// NotCollected names data people may expect that the service does not keep
+	NotCollected map[string]string `json:"notCollected"`
+}
+
+type manifestEntry struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type profile struct {
+	entities.AdminUser
+	Position  string `json:"position"`
+	AvatarUrl string `json:"avatarURL"`
+}
+
+type membership struct {
+	CompanyId   int    `json:"companyId"`
+	CompanyName string `json:"companyName"`
+	Role        string `json:"role"`
+	Position    string `json:"position"`
+}
+
+type follows struct {
+	UserIds    []int `json:"userIds"`
+	CompanyIds []int `json:"companyIds"`
+}
+
+// archive writes the zip entries and records them in the manifest.
+type archive struct {
+	zip      *zip.Writer
+	manifest manifest
+	images   map[string]string
+}
+
+func (a *archive) add(name, description string, data []byte) error {
+	f, err := a.zip.Create(name)
+
+	if err != nil {
+		return fmt.Errorf("adding %s: %v", name, err)
+	}
+
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("writing %s: %v", name, err)
+	}
+
+	a.manifest.Files = append(a.manifest.Files, manifestEntry{Name: name, Description: description})
+
+	return nil
+}
+
+func (a *archive) addJSON(name, description string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+
+	if err != nil {
+		return fmt.Errorf("encoding %s: %v", name, err)
+	}
+
+	return a.add(name, description, data)
+}
+
+// addImage copies an upload into images/, once per URL. Uploads that can't be
+// fetched are listed in the manifest rather than failing the export.
+func (a *archive) addImage(files Files, fileURL, prefix, description string) error {
+	if fileURL == "" || a.images[fileURL] != "" {
+		return nil
+	}
+
+	data, err := files.Get(fileURL)
+
+	if err != nil {
+		a.manifest.MissingImages = append(a.manifest.MissingImages, fileURL)
+		return nil
+	}
+
+	name := "images/" + prefix
+
+	if parsed, err := url.Parse(fileURL); err == nil {
+		name += "-" + path.Base(parsed.Path)
+	}
+
+	a.images[fileURL] = name
+
+	return a.add(name, description, data)
+}
+
+// build collects the user's data into a zip archive.
+func (w *Worker) build(userId int) ([]byte, error) {
+	user, err := w.store.GetUserById(userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	adminUser, err := w.store.GetAdminUser(userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+
+	a := &archive{
+		zip: zip.NewWriter(&buf),
+		manifest: manifest{
+			FormatVersion: formatVersion,
+			UserId:        userId,
+			GeneratedAt:   time.Now().UTC(),
+			NotCollected: map[string]string{
+				"articleRevisions": "articles are not versioned, only their current text is kept",
+				"comments":         "the service has no comments",
+				"votes":            "only the total rating of an article is kept, not who voted",
+			},
+		},
+		images: map[string]string{},
+	}
+
+	err = a.addJSON("profile.json", "Account details", profile{AdminUser: adminUser, Position: user.Position, AvatarUrl: user.AvatarUrl})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.addImage(w.files, user.AvatarUrl, "avatar", "Avatar"); err != nil {
+		return nil, err
+	}
+
+	memberships := []membership{}
+
+	if user.CompanyId != nil {
+		company, err := w.store.GetCompanyById(*user.CompanyId)
+
+		if err != nil {
+			return nil, err
+		}
+
+		memberships = append(memberships, membership{CompanyId: company.Id, CompanyName: company.Name, Role: user.CompanyRole, Position: user.Position})
+	}
+
+	if err := a.addJSON("memberships.json", "Company memberships and roles", memberships); err != nil {
+		return nil, err
+	}
+
+	articles, err := w.store.GetArticlesByAuthorId(userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.addJSON("articles.json", "Articles written by the user, as currently published", nonNil(articles)); err != nil {
+		return nil, err
+	}
+
+	for _, article := range articles {
+		if err := a.addImage(w.files, article.CoverUrl, fmt.Sprintf("article-%d", article.Id), fmt.Sprintf("Cover of article %d", article.Id)); err != nil {
+			return nil, err
+		}
+	}
+
+	bookmarks, err := w.store.GetBookmarks(userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.addJSON("bookmarks.json", "Bookmarked articles", nonNil(bookmarks)); err != nil {
+		return nil, err
+	}
+
+	summaries, err := w.store.GetReadingListsByUserId(userId, true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	lists := []entities.ReadingList{}
+
+	for _, summary := range summaries {
+		list, err := w.store.GetReadingListById(summary.Id)
+
+		if err != nil {
+			return nil, err
+		}
+
+		lists = append(lists, list)
+	}
+
+	if err := a.addJSON("reading-lists.json", "Reading lists, public and private, with their articles", lists); err != nil {
+		return nil, err
+	}
+
+	userIds, companyIds, err := w.store.GetFollows(userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.addJSON("follows.json", "Followed users and companies", follows{UserIds: userIds, CompanyIds: companyIds}); err != nil {
+		return nil, err
+	}
+
+	sessions, err := w.store.GetSessions(userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.addJSON("sessions.json", "Active sign-in sessions with their device and IP address", nonNil(sessions)); err != nil {
+		return nil, err
+	}
+
+	tokens, err := w.store.GetPersonalAccessTokens(userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.addJSON("tokens.json", "Personal access tokens, without their secrets", nonNil(tokens)); err != nil {
+		return nil, err
+	}
+
+	passkeys, err := w.store.GetPasskeys(userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.addJSON("passkeys.json", "Registered passkeys, without their key material", nonNil(passkeys)); err != nil {
+		return nil, err
+	}
+
+	events, err := w.store.GetAuditEvents(entities.AuditEventFilter{ActorId: userId})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.addJSON("security-log.json", "Sign-ins and account changes made by the user", nonNil(events)); err != nil {
+		return nil, err
+	}
+
+	manifest, err := json.MarshalIndent(a.manifest, "", "  ")
+
+	if err != nil {
+		return nil, fmt.Errorf("encoding manifest: %v", err)
+	}
+
+	f, err := a.zip.Create("manifest.json")
+
+	if err != nil {
+		return nil, fmt.Errorf("adding manifest: %v", err)
+	}
+
+	if _, err := f.Write(manifest); err != nil {
+		return nil, fmt.Errorf("writing manifest: %v", err)
+	}
+
+	if err := a.zip.Close(); err != nil {
+		return nil, fmt.Errorf("closing archive: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// nonNil makes empty lists encode as [] rather than null.
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+
+	return items
+}
@@ -0,0 +1,209 @@
+// Package exports builds the archive of everything the service holds about a
+// user, in the background, and keeps it downloadable for a limited time.
+package exports
+
+import (
+	"auth-service/internal/database"
+	"auth-service/internal/entities"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// TTL is how long a finished archive can be downloaded.
+var TTL = 7 * 24 * time.Hour
+
+const (
+	// a claimed export is picked up again after the lease if the worker dies
+	// mid-build. The worker renews it while it builds, well before it runs out.
+	claimLease  = 10 * time.Minute
+	renewEvery  = claimLease / 3
+	maxAttempts = 3
+)
+
+type Store interface {
+	ClaimDataExport(lease time.Duration) (entities.DataExport, error)
+	RenewDataExportLease(id int, attempt int, lease time.Duration) error
+	CompleteDataExport(id int, attempt int, objectKey string, ttl time.Duration) error
+	FailDataExport(id int, attempt int, message string) error
+	ExpireDataExports() ([]string, error)
+
+	GetAdminUser(id int) (entities.AdminUser, error)
+	GetUserById(id int) (entities.User, error)
+	GetCompanyById(id int) (entities.Company, error)
+	GetArticlesByAuthorId(authorId int) ([]entities.Article, error)
+	GetBookmarks(userId int) ([]entities.Article, error)
+	GetReadingListsByUserId(userId int, includePrivate bool) ([]entities.ReadingList, error)
+	GetReadingListById(id int) (entities.ReadingList, error)
+	GetFollows(userId int) ([]int, []int, error)
+	GetSessions(userId int) ([]entities.Session, error)
+	GetPersonalAccessTokens(userId int) ([]entities.PersonalAccessToken, error)
+	GetPasskeys(userId int) ([]entities.Passkey, error)
+	GetAuditEvents(filter entities.AuditEventFilter) ([]entities.AuditEvent, error)
+}
+
+// Files reads the user's uploads and stores the archives.
+type Files interface {
+	Get(url string) ([]byte, error)
+	Put(key string, data []byte) error
+	Delete(key string) error
+}
+
+type Worker struct {
+	store      Store
+	files      Files
+	interval   time.Duration
+	renewEvery time.Duration
+}
+
+func NewWorker(store Store, files Files) *Worker {
+	return &Worker{
+		store:      store,
+		files:      files,
+		interval:   10 * time.Second,
+		renewEvery: renewEvery,
+	}
+}
+
+func (w *Worker) Run(ctx context.Context) {
+	for {
+		w.expire()
+
+		export, err := w.store.ClaimDataExport(claimLease)
+
+		switch {
+		case err == nil:
+			w.Export(export)
+			continue
+		case !errors.Is(err, database.ErrExportNotFound):
+			log.Error().Err(err).Msg("Failed to claim data export")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(w.interval):
+		}
+	}
+}
+
+// Export builds and uploads the archive of a claimed export. An export that
+// keeps failing, or keeps killing the worker, is given up after maxAttempts.
+// If another worker took the export over meanwhile, its result is kept.
+func (w *Worker) Export(export entities.DataExport) {
+	if export.Attempts > maxAttempts {
+		w.fail(export, "gave up after repeated attempts")
+		return
+	}
+
+	stop := w.renewLease(export)
+	defer stop()
+
+	archive, err := w.build(export.UserId)
+
+	if err != nil {
+		log.Error().Err(err).Int("export", export.Id).Msg("Failed to build data export")
+		w.fail(export, "could not collect the data")
+		return
+	}
+
+	objectKey := fmt.Sprintf("exports/%d/%s.zip", export.UserId, randomName())
+
+	if err := w.files.Put(objectKey, archive); err != nil {
+		log.Error().Err(err).Int("export", export.Id).Msg("Failed to upload data export")
+		w.fail(export, "could not store the archive")
+		return
+	}
+
+	err = w.store.CompleteDataExport(export.Id, export.Attempts, objectKey, TTL)
+
+	if err == nil {
+		return
+	}
+
+	if errors.Is(err, database.ErrExportLeaseLost) {
+		log.Warn().Int("export", export.Id).Msg("Data export was taken over by another worker")
+	} else {
+		log.Error().Err(err).Int("export", export.Id).Msg("Failed to complete data export")
+	}
+
+	// nothing points at the archive, so it would never expire
+	if err := w.files.Delete(objectKey); err != nil {
+		log.Error().Err(err).Str("key", objectKey).Msg("Failed to remove unused data export")
+	}
+}
+
+// renewLease keeps the export leased to this worker until stop is called.
+func (w *Worker) renewLease(export entities.DataExport) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(w.renewEvery)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			err := w.store.RenewDataExportLease(export.Id, export.Attempts, claimLease)
+
+			if errors.Is(err, database.ErrExportLeaseLost) {
+				log.Warn().Int("export", export.Id).Msg("Data export was taken over by another worker")
+				return
+			}
+
+			if err != nil {
+				log.Error().Err(err).Int("export", export.Id).Msg("Failed to renew data export lease")
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func (w *Worker) fail(export entities.DataExport, message string) {
+	err := w.store.FailDataExport(export.Id, export.Attempts, message)
+
+	if err != nil && !errors.Is(err, database.ErrExportLeaseLost) {
+		log.Error().Err(err).Int("export", export.Id).Msg("Failed to mark data export as failed")
+	}
+}
+
+// expire removes the archives whose download window is over.
+func (w *Worker) expire() {
+	objectKeys, err := w.store.ExpireDataExports()
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to expire data exports")
+		return
+	}
+
+	for _, objectKey := range objectKeys {
+		if err := w.files.Delete(objectKey); err != nil {
+			log.Error().Err(err).Str("key", objectKey).Msg("Failed to remove expired data export")
+		}
+	}
+}
+
+// randomName keeps archive keys unguessable, they are only handed out as
+// presigned links.
+func randomName() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,158 @@
+package exports
+
+import (
+	"auth-service/internal/database"
+	"auth-service/internal/entities"
+	"sync"
+	"testing"
+	"time"
+)
+
+// leaseStore has a user with no data, whose export takes a while to collect.
+type leaseStore struct {
+	Store
+
+	buildTime   time.Duration
+	completeErr error
+
+	mu        sync.Mutex
+	renewals  []int
+	completed []int
+}
+
+func (s *leaseStore) RenewDataExportLease(id int, attempt int, lease time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.renewals = append(s.renewals, attempt)
+
+	return nil
+}
+
+func (s *leaseStore) CompleteDataExport(id int, attempt int, objectKey string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.completed = append(s.completed, attempt)
+
+	return s.completeErr
+}
+
+func (s *leaseStore) FailDataExport(id int, attempt int, message string) error {
+	return nil
+}
+
+func (s *leaseStore) GetUserById(id int) (entities.User, error) {
+	time.Sleep(s.buildTime)
+
+	return entities.User{Id: id}, nil
+}
+
+func (s *leaseStore) GetAdminUser(id int) (entities.AdminUser, error) {
+	return entities.AdminUser{}, nil
+}
+
+func (s *leaseStore) GetArticlesByAuthorId(authorId int) ([]entities.Article, error) {
+	return nil, nil
+}
+
+func (s *leaseStore) GetBookmarks(userId int) ([]entities.Article, error) {
+	return nil, nil
+}
+
+func (s *leaseStore) GetReadingListsByUserId(userId int, includePrivate bool) ([]entities.ReadingList, error) {
+	return nil, nil
+}
+
+func (s *leaseStore) GetFollows(userId int) ([]int, []int, error) {
+	return nil, nil, nil
+}
+
+func (s *leaseStore) GetSessions(userId int) ([]entities.Session, error) {
+	return nil, nil
+}
+
+func (s *leaseStore) GetPersonalAccessTokens(userId int) ([]entities.PersonalAccessToken, error) {
+	return nil, nil
+}
+
+func (s *leaseStore) GetPasskeys(userId int) ([]entities.Passkey, error) {
+	return nil, nil
+}
+
+func (s *leaseStore) GetAuditEvents(filter entities.AuditEventFilter) ([]entities.AuditEvent, error) {
+	return nil, nil
+}
+
+type memoryFiles struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *memoryFiles) Get(url string) ([]byte, error) {
+	return nil, nil
+}
+
+func (f *memoryFiles) Put(key string, data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.objects[key] = data
+
+	return nil
+}
+
+func (f *memoryFiles) Delete(key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.objects, key)
+
+	return nil
+}
+
+func TestExportRenewsItsLease(t *testing.T) {
+	store := &leaseStore{buildTime: 100 * time.Millisecond}
+	files := &memoryFiles{objects: map[string][]byte{}}
+
+	worker := NewWorker(store, files)
+	worker.renewEvery = 10 * time.Millisecond
+
+	worker.Export(entities.DataExport{Id: 1, UserId: 1, Attempts: 2})
+
+	if len(store.renewals) == 0 {
+		t.Fatal("lease was never renewed during the build")
+	}
+
+	for _, attempt := range append(store.renewals, store.completed...) {
+		if attempt != 2 {
+			t.Fatalf("lease used with attempt %d, want the claim's 2", attempt)
+		}
+	}
+
+	if len(store.completed) != 1 || len(files.objects) != 1 {
+		t.Fatalf("completed %d times with %d archives, want one", len(store.completed), len(files.objects))
+	}
+
+	renewals := len(store.renewals)
+	time.Sleep(30 * time.Millisecond)
+
+	if len(store.renewals) != renewals {
+		t.Fatal("lease still renewed after the export finished")
+	}
+}
+
+func TestExportDropsTheArchiveOfALostLease(t *testing.T) {
+	store := &leaseStore{completeErr: database.ErrExportLeaseLost}
+	files := &memoryFiles{objects: map[string][]byte{}}
+
+	NewWorker(store, files).Export(entities.DataExport{Id: 1, UserId: 1, Attempts: 1})
+
+	if len(store.completed) != 1 {
+		t.Fatalf("completed %d times, want one", len(store.completed))
+	}
+
+	if len(files.objects) != 0 {
+		t.Fatalf("%d archives left behind by a lost lease", len(files.objects))
+	}
+}
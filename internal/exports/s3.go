@@ -0,0 +1,25 @@
+package exports
+
+import "auth-service/internal/storage"
+
+// S3Files reads the user's uploads from the public uploads bucket and keeps
+// archives in Bucket, which must not be readable without a presigned link.
+type S3Files struct {
+	Bucket        string
+	UploadsBucket string
+	Region        string
+	AccessKey     string
+	SecretKey     string
+}
+
+func (f S3Files) Get(url string) ([]byte, error) {
+	return storage.GetFileFromS3(url, f.UploadsBucket, f.Region, f.AccessKey, f.SecretKey)
+}
+
+func (f S3Files) Put(key string, data []byte) error {
+	return storage.PutObjectToS3(key, data, "application/zip", f.Bucket, f.Region, f.AccessKey, f.SecretKey)
+}
+
+func (f S3Files) Delete(key string) error {
+	return storage.DeleteObjectFromS3(key, f.Bucket, f.Region, f.AccessKey, f.SecretKey)
+}
@@ -3,7 +3,40 @@ package keys
 import "os"
 
 var JWT_SECRET_KEY = []byte(os.Getenv("JWT_SECRET_KEY"))
+var JWT_PREVIOUS_SECRET_KEY = []byte(os.Getenv("JWT_PREVIOUS_SECRET_KEY"))
 var BUCKET_NAME = os.Getenv("BUCKET_NAME")
 var AWS_REGION = os.Getenv("AWS_REGION")
 var AWS_ACCESS_KEY = os.Getenv("AWS_ACCESS_KEY")
 var AWS_SECRET_KEY = os.Getenv("AWS_SECRET_KEY")
+var KAFKA_BROKERS = os.Getenv("KAFKA_BROKERS")
+var KAFKA_TOPIC = os.Getenv("KAFKA_TOPIC")
+var TRUST_PROXY = os.Getenv("TRUST_PROXY") == "true"
+var RATE_LIMITS = os.Getenv("RATE_LIMITS")
+var RATE_LIMIT_BACKEND = os.Getenv("RATE_LIMIT_BACKEND")
+var APP_BASE_URL = os.Getenv("APP_BASE_URL")
+var FRONTEND_URL = os.Getenv("FRONTEND_URL")
+var MAIL_DRIVER = os.Getenv("MAIL_DRIVER")
+var MAIL_FROM = os.Getenv("MAIL_FROM")
+var MAIL_DIR = os.Getenv("MAIL_DIR")
+var SMTP_ADDR = os.Getenv("SMTP_ADDR")
+var SMTP_USERNAME = os.Getenv("SMTP_USERNAME")
+var SMTP_PASSWORD = os.Getenv("SMTP_PASSWORD")
+var OIDC_PROVIDERS = os.Getenv("OIDC_PROVIDERS")
+var OAUTH_LOGIN_URL = os.Getenv("OAUTH_LOGIN_URL")
+var OAUTH_SIGNING_KEY = os.Getenv("OAUTH_SIGNING_KEY")
+var OAUTH_PREVIOUS_SIGNING_KEY = os.Getenv("OAUTH_PREVIOUS_SIGNING_KEY")
+var COOKIE_SECURE = os.Getenv("COOKIE_SECURE") != "false"
+var COOKIE_HTTP_ONLY = os.Getenv("COOKIE_HTTP_ONLY") != "false"
+var COOKIE_SAMESITE = os.Getenv("COOKIE_SAMESITE")
+var COOKIE_DOMAIN = os.Getenv("COOKIE_DOMAIN")
+var COOKIE_HOST_PREFIX = os.Getenv("COOKIE_HOST_PREFIX") == "true"
+var COOKIE_KEYS = os.Getenv("COOKIE_KEYS")
+var WEBAUTHN_RP_ID = os.Getenv("WEBAUTHN_RP_ID")
+var WEBAUTHN_RP_NAME = os.Getenv("WEBAUTHN_RP_NAME")
+var WEBAUTHN_ORIGINS = os.Getenv("WEBAUTHN_ORIGINS")
+var PASSWORD_HASH = os.Getenv("PASSWORD_HASH")
+var PASSWORD_MIN_LENGTH = os.Getenv("PASSWORD_MIN_LENGTH")
+var COMMON_PASSWORDS_FILE = os.Getenv("COMMON_PASSWORDS_FILE")
+var ACCOUNT_DELETION_GRACE_PERIOD = os.Getenv("ACCOUNT_DELETION_GRACE_PERIOD")
+var DATA_EXPORT_TTL = os.Getenv("DATA_EXPORT_TTL")
+var EXPORT_BUCKET_NAME = os.Getenv("EXPORT_BUCKET_NAME")
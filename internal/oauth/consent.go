@@ -0,0 +1,35 @@
+package oauth
+
+import "html/template"
+
+type ConsentData struct {
+	ClientName   string
+	Username     string
+	Scopes       []string
+	Descriptions map[string]string
+	// Params are the authorization request parameters, posted back as they came
+	Params       map[string]string
+	ConsentToken string
+}
+
+var ConsentPage = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Authorize {{.ClientName}}</title>
+</head>
+<body>
+<h1>{{.ClientName}} wants to access your account</h1>
+<p>Signed in as <strong>{{.Username}}</strong>. {{.ClientName}} will be able to:</p>
+<ul>
+{{range .Scopes}}<li>{{index $.Descriptions .}}</li>
+{{end}}</ul>
+<form method="post" action="/authorize">
+{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}<input type="hidden" name="consent_token" value="{{.ConsentToken}}">
+<button type="submit" name="decision" value="allow">Allow</button>
+<button type="submit" name="decision" value="deny">Deny</button>
+</form>
+</body>
+</html>
+`))
@@ -0,0 +1,61 @@
+package oauth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"slices"
+	"strings"
+)
+
+const (
+	ScopeOpenId  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// SupportedScopes are the scopes a client may be registered for.
+var SupportedScopes = []string{ScopeOpenId, ScopeProfile, ScopeEmail}
+
+// ScopeDescriptions are shown on the consent page.
+var ScopeDescriptions = map[string]string{
+	ScopeOpenId:  "Confirm who you are",
+	ScopeProfile: "See your username and full name",
+	ScopeEmail:   "See your email address",
+}
+
+// ParseScope splits a space separated scope parameter, dropping duplicates.
+func ParseScope(scope string) []string {
+	var scopes []string
+
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+
+	return scopes
+}
+
+// Subset reports whether every scope in requested is in allowed.
+func Subset(requested []string, allowed []string) bool {
+	for _, s := range requested {
+		if !slices.Contains(allowed, s) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// VerifyPKCE checks the verifier against an S256 code challenge (RFC 7636).
+func VerifyPKCE(verifier string, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
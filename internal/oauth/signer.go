@@ -0,0 +1,201 @@
+// Package oauth holds the pieces of the OAuth2/OpenID Connect provider that
+// don't touch storage: token signing, scopes, PKCE and the consent page.
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// AccessTokenClaims are the claims of the access tokens handed to clients.
+// The subject is the user id, or the client id for client_credentials.
+type AccessTokenClaims struct {
+	Scope    string `json:"scope"`
+	ClientId string `json:"client_id"`
+	jwt.RegisteredClaims
+}
+
+type IdTokenClaims struct {
+	Nonce             string `json:"nonce,omitempty"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     *bool  `json:"email_verified,omitempty"`
+	Name              string `json:"name,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Signer signs the provider's tokens with an RSA key that clients can fetch
+// from the JWKS endpoint. Keys that signed before a rotation stay published
+// and keep verifying until the tokens they signed have expired.
+type Signer struct {
+	key *rsa.PrivateKey
+	kid string
+	// verifying holds the public keys by kid, the current one included
+	verifying map[string]*rsa.PublicKey
+	kids      []string
+}
+
+// NewSigner reads a PEM encoded RSA private key (PKCS#1 or PKCS#8).
+func NewSigner(pemKey string) (*Signer, error) {
+	key, err := parseKey(pemKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newSigner(key), nil
+}
+
+// AddPreviousKey publishes and accepts a key that signed tokens before the
+// current one. It reads the same PEM formats as NewSigner.
+func (s *Signer) AddPreviousKey(pemKey string) error {
+	key, err := parseKey(pemKey)
+
+	if err != nil {
+		return err
+	}
+
+	s.addVerifying(&key.PublicKey)
+
+	return nil
+}
+
+func parseKey(pemKey string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(pemKey))
+
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block in signing key")
+	}
+
+	var key *rsa.PrivateKey
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+
+		if err != nil {
+			return nil, fmt.Errorf("parsing signing key: %v", err)
+		}
+
+		key = parsed
+	default:
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+
+		if err != nil {
+			return nil, fmt.Errorf("parsing signing key: %v", err)
+		}
+
+		rsaKey, ok := parsed.(*rsa.PrivateKey)
+
+		if !ok {
+			return nil, fmt.Errorf("signing key is not an RSA key")
+		}
+
+		key = rsaKey
+	}
+
+	return key, nil
+}
+
+// GenerateSigner creates a throwaway key. Tokens signed with it stop
+// verifying when the process restarts.
+func GenerateSigner() (*Signer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		return nil, fmt.Errorf("generating signing key: %v", err)
+	}
+
+	return newSigner(key), nil
+}
+
+func newSigner(key *rsa.PrivateKey) *Signer {
+	s := &Signer{key: key, kid: keyId(&key.PublicKey), verifying: map[string]*rsa.PublicKey{}}
+	s.addVerifying(&key.PublicKey)
+
+	return s
+}
+
+func keyId(key *rsa.PublicKey) string {
+	sum := sha256.Sum256(key.N.Bytes())
+
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+func (s *Signer) addVerifying(key *rsa.PublicKey) {
+	kid := keyId(key)
+
+	if _, ok := s.verifying[kid]; ok {
+		return
+	}
+
+	s.verifying[kid] = key
+	s.kids = append(s.kids, kid)
+}
+
+func (s *Signer) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = s.kid
+
+	signed, err := token.SignedString(s.key)
+
+	if err != nil {
+		return "", fmt.Errorf("signing token: %v", err)
+	}
+
+	return signed, nil
+}
+
+// VerifyAccessToken checks a token issued by this provider.
+func (s *Signer) VerifyAccessToken(raw string, issuer string) (*AccessTokenClaims, error) {
+	var claims AccessTokenClaims
+
+	_, err := jwt.ParseWithClaims(raw, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		if key, ok := s.verifying[kid]; ok {
+			return key, nil
+		}
+
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithIssuer(issuer), jwt.WithExpirationRequired())
+
+	if err != nil {
+		return nil, err
+	}
+
+	// ID tokens are signed with the same key but carry no client_id
+	if claims.ClientId == "" {
+		return nil, fmt.Errorf("not an access token")
+	}
+
+	return &claims, nil
+}
+
+// JWKS returns the public keys as a JSON Web Key Set, the current one first.
+func (s *Signer) JWKS() map[string]any {
+	jwks := make([]map[string]string, 0, len(s.kids))
+
+	for _, kid := range s.kids {
+		key := s.verifying[kid]
+
+		jwks = append(jwks, map[string]string{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": kid,
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+
+	return map[string]any{"keys": jwks}
+}
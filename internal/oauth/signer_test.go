@@ -0,0 +1,144 @@
+package oauth
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testIssuer = "https://auth.example.com"
+
+func newTestSigner(t *testing.T) (*Signer, string) {
+	t.Helper()
+
+	signer, err := GenerateSigner()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(signer.key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signer, string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func accessToken(t *testing.T, signer *Signer) string {
+	t.Helper()
+
+	token, err := signer.Sign(AccessTokenClaims{
+		Scope:    "openid",
+		ClientId: "client-1",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    testIssuer,
+			Subject:   "1",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+func jwksKids(signer *Signer) []string {
+	var kids []string
+
+	for _, key := range signer.JWKS()["keys"].([]map[string]string) {
+		kids = append(kids, key["kid"])
+	}
+
+	return kids
+}
+
+func TestSignerKeepsVerifyingThePreviousKey(t *testing.T) {
+	previous, previousPEM := newTestSigner(t)
+	current, currentPEM := newTestSigner(t)
+
+	old := accessToken(t, previous)
+
+	if _, err := current.VerifyAccessToken(old, testIssuer); err == nil {
+		t.Fatal("token verified with a key the signer doesn't have")
+	}
+
+	rotated, err := NewSigner(currentPEM)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rotated.AddPreviousKey(previousPEM); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := rotated.VerifyAccessToken(old, testIssuer); err != nil {
+		t.Fatalf("token signed with the previous key: %v", err)
+	}
+
+	if _, err := rotated.VerifyAccessToken(accessToken(t, rotated), testIssuer); err != nil {
+		t.Fatalf("token signed with the current key: %v", err)
+	}
+
+	kids := jwksKids(rotated)
+
+	if len(kids) != 2 || kids[0] != current.kid || kids[1] != previous.kid {
+		t.Fatalf("JWKS has kids %v, want the current %s then the previous %s", kids, current.kid, previous.kid)
+	}
+}
+
+func TestSignerAddsEachKeyOnce(t *testing.T) {
+	signer, signerPEM := newTestSigner(t)
+
+	if err := signer.AddPreviousKey(signerPEM); err != nil {
+		t.Fatal(err)
+	}
+
+	if kids := jwksKids(signer); len(kids) != 1 {
+		t.Fatalf("JWKS has kids %v, want one", kids)
+	}
+}
+
+func TestSignerRejectsForeignTokens(t *testing.T) {
+	signer, _ := newTestSigner(t)
+	other, _ := newTestSigner(t)
+
+	// another key claiming the signer's kid
+	forged := jwt.NewWithClaims(jwt.SigningMethodRS256, AccessTokenClaims{
+		ClientId: "client-1",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    testIssuer,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	forged.Header["kid"] = signer.kid
+
+	raw, err := forged.SignedString(other.key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := signer.VerifyAccessToken(raw, testIssuer); err == nil {
+		t.Fatal("forged token verified")
+	}
+
+	if _, err := signer.VerifyAccessToken(accessToken(t, signer), "https://other.example.com"); err == nil {
+		t.Fatal("token verified for another issuer")
+	}
+}
+
+func TestAddPreviousKeyRejectsGarbage(t *testing.T) {
+	signer, _ := newTestSigner(t)
+
+	if err := signer.AddPreviousKey("not a key"); err == nil {
+		t.Fatal("accepted a value without a PEM block")
+	}
+}
@@ -0,0 +1,27 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+)
+
+// RandomString returns a URL safe random string for states, nonces and verifiers.
+func RandomString() (string, error) {
+	bytes := make([]byte, 32)
+
+	_, err := rand.Read(bytes)
+
+	if err != nil {
+		return "", fmt.Errorf("reading random bytes: %v", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// CodeChallenge derives the S256 PKCE challenge from the verifier (RFC 7636).
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
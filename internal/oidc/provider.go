@@ -0,0 +1,173 @@
+// Package oidc is a small OpenID Connect client for signing users in with
+// external identity providers through the authorization code flow with PKCE.
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Metadata is the part of the discovery document the client uses.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type Provider struct {
+	config   Config
+	metadata Metadata
+	client   *http.Client
+	keys     *keySet
+}
+
+// Discover loads the provider metadata from the issuer's
+// /.well-known/openid-configuration document.
+func Discover(ctx context.Context, config Config) (*Provider, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	var metadata Metadata
+
+	err := getJSON(ctx, client, strings.TrimSuffix(config.Issuer, "/")+"/.well-known/openid-configuration", &metadata)
+
+	if err != nil {
+		return nil, fmt.Errorf("discovering %s: %v", config.Name, err)
+	}
+
+	// a document for another issuer could smuggle in foreign signing keys
+	if metadata.Issuer != config.Issuer {
+		return nil, fmt.Errorf("discovering %s: issuer %q does not match %q", config.Name, metadata.Issuer, config.Issuer)
+	}
+
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("discovering %s: incomplete provider metadata", config.Name)
+	}
+
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+
+	return &Provider{
+		config:   config,
+		metadata: metadata,
+		client:   client,
+		keys:     newKeySet(client, metadata.JWKSURI),
+	}, nil
+}
+
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+// AuthCodeURL returns the URL to send the user to for signing in.
+func (p *Provider) AuthCodeURL(state string, nonce string, codeChallenge string) string {
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("scope", strings.Join(p.config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+
+	if strings.Contains(p.metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return p.metadata.AuthorizationEndpoint + separator + query.Encode()
+}
+
+type tokenResponse struct {
+	IdToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange trades the authorization code for the ID token and verifies it.
+func (p *Provider) Exchange(ctx context.Context, code string, codeVerifier string, nonce string) (*IdTokenClaims, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("client_id", p.config.ClientID)
+	form.Set("client_secret", p.config.ClientSecret)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+
+	if err != nil {
+		return nil, fmt.Errorf("creating token request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+
+	if err != nil {
+		return nil, fmt.Errorf("exchanging code: %v", err)
+	}
+
+	defer resp.Body.Close()
+
+	var token tokenResponse
+
+	err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&token)
+
+	if err != nil {
+		return nil, fmt.Errorf("decoding token response: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("exchanging code: %s %s", token.Error, token.ErrorDescription)
+	}
+
+	if token.IdToken == "" {
+		return nil, fmt.Errorf("exchanging code: no id_token in response")
+	}
+
+	return p.VerifyIdToken(ctx, token.IdToken, nonce)
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
@@ -0,0 +1,385 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeProvider is an OpenID provider on httptest: discovery, an authorize
+// endpoint that approves right away, a token endpoint that checks PKCE and a
+// JWKS endpoint.
+type fakeProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+
+	// claims put in the next ID token on top of the defaults
+	claims jwt.MapClaims
+
+	mu    sync.Mutex
+	codes map[string]authorization
+}
+
+type authorization struct {
+	challenge   string
+	nonce       string
+	redirectURI string
+}
+
+const (
+	testClientID     = "client-1"
+	testClientSecret = "secret-1"
+	testRedirectURL  = "https://app.example/oidc/fake/callback"
+)
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeProvider{t: t, key: key, kid: "key-1", codes: map[string]authorization{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", f.discovery)
+	mux.HandleFunc("GET /authorize", f.authorize)
+	mux.HandleFunc("POST /token", f.token)
+	mux.HandleFunc("GET /jwks", f.jwks)
+
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+
+	return f
+}
+
+func (f *fakeProvider) issuer() string {
+	return f.server.URL
+}
+
+func (f *fakeProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(Metadata{
+		Issuer:                f.issuer(),
+		AuthorizationEndpoint: f.issuer() + "/authorize",
+		TokenEndpoint:         f.issuer() + "/token",
+		JWKSURI:               f.issuer() + "/jwks",
+	})
+}
+
+func (f *fakeProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if query.Get("response_type") != "code" || query.Get("client_id") != testClientID || query.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+
+	code := "code-" + query.Get("state")[:8]
+
+	f.mu.Lock()
+	f.codes[code] = authorization{challenge: query.Get("code_challenge"), nonce: query.Get("nonce"), redirectURI: query.Get("redirect_uri")}
+	f.mu.Unlock()
+
+	http.Redirect(w, r, query.Get("redirect_uri")+"?code="+code+"&state="+url.QueryEscape(query.Get("state")), http.StatusFound)
+}
+
+func (f *fakeProvider) token(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	auth, ok := f.codes[r.FormValue("code")]
+	delete(f.codes, r.FormValue("code"))
+	f.mu.Unlock()
+
+	switch {
+	case !ok, r.FormValue("grant_type") != "authorization_code", r.FormValue("redirect_uri") != auth.redirectURI:
+		tokenError(w, "invalid_grant")
+		return
+	case r.FormValue("client_id") != testClientID || r.FormValue("client_secret") != testClientSecret:
+		tokenError(w, "invalid_client")
+		return
+	case CodeChallenge(r.FormValue("code_verifier")) != auth.challenge:
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"id_token": f.idToken(auth.nonce)})
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
+
+func (f *fakeProvider) idToken(nonce string) string {
+	claims := jwt.MapClaims{
+		"iss":            f.issuer(),
+		"aud":            testClientID,
+		"sub":            "subject-1",
+		"email":          "ada@example.com",
+		"email_verified": true,
+		"name":           "Ada Lovelace",
+		"nonce":          nonce,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Minute).Unix(),
+	}
+
+	for name, value := range f.claims {
+		claims[name] = value
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = f.kid
+
+	signed, err := token.SignedString(f.key)
+
+	if err != nil {
+		f.t.Fatal(err)
+	}
+
+	return signed
+}
+
+func (f *fakeProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]any{"keys": []jwk{{
+		Kid: f.kid,
+		Kty: "RSA",
+		Use: "sig",
+		N:   base64.RawURLEncoding.EncodeToString(f.key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(f.key.E)).Bytes()),
+	}}})
+}
+
+func (f *fakeProvider) discover(t *testing.T) *Provider {
+	t.Helper()
+
+	provider, err := Discover(context.Background(), Config{
+		Name:         "fake",
+		Issuer:       f.issuer(),
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+	})
+
+	if err != nil {
+		t.Fatalf("discovery failed: %v", err)
+	}
+
+	return provider
+}
+
+// signIn runs the browser part of the flow: it opens the authorization URL and
+// returns the code and state the provider redirects back with.
+func (f *fakeProvider) signIn(t *testing.T, provider *Provider, state, nonce, verifier string) (string, string) {
+	t.Helper()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	resp, err := client.Get(provider.AuthCodeURL(state, nonce, CodeChallenge(verifier)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize answered %d", resp.StatusCode)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(location.String(), testRedirectURL+"?") {
+		t.Fatalf("redirected to %s, want the callback", location)
+	}
+
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func randomStrings(t *testing.T) (string, string, string) {
+	t.Helper()
+
+	var values [3]string
+
+	for i := range values {
+		value, err := RandomString()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		values[i] = value
+	}
+
+	return values[0], values[1], values[2]
+}
+
+func TestSignIn(t *testing.T) {
+	f := newFakeProvider(t)
+	provider := f.discover(t)
+	state, nonce, verifier := randomStrings(t)
+
+	code, returnedState := f.signIn(t, provider, state, nonce, verifier)
+
+	if returnedState != state {
+		t.Fatalf("state came back as %q, want %q", returnedState, state)
+	}
+
+	claims, err := provider.Exchange(context.Background(), code, verifier, nonce)
+
+	if err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+
+	if claims.Subject != "subject-1" || claims.Email != "ada@example.com" || !bool(claims.EmailVerified) || claims.Name != "Ada Lovelace" {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+}
+
+func TestExchangeRequiresTheCodeVerifier(t *testing.T) {
+	f := newFakeProvider(t)
+	provider := f.discover(t)
+	state, nonce, verifier := randomStrings(t)
+
+	code, _ := f.signIn(t, provider, state, nonce, verifier)
+
+	if _, err := provider.Exchange(context.Background(), code, verifier+"x", nonce); err == nil {
+		t.Fatal("exchange succeeded with the wrong PKCE verifier")
+	}
+}
+
+func TestExchangeChecksTheNonce(t *testing.T) {
+	f := newFakeProvider(t)
+	provider := f.discover(t)
+	state, nonce, verifier := randomStrings(t)
+
+	code, _ := f.signIn(t, provider, state, nonce, verifier)
+
+	_, err := provider.Exchange(context.Background(), code, verifier, "another-nonce")
+
+	if err == nil || !strings.Contains(err.Error(), "nonce") {
+		t.Fatalf("exchange returned %v, want a nonce mismatch", err)
+	}
+}
+
+func TestExchangeCodesWorkOnce(t *testing.T) {
+	f := newFakeProvider(t)
+	provider := f.discover(t)
+	state, nonce, verifier := randomStrings(t)
+
+	code, _ := f.signIn(t, provider, state, nonce, verifier)
+
+	if _, err := provider.Exchange(context.Background(), code, verifier, nonce); err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+
+	if _, err := provider.Exchange(context.Background(), code, verifier, nonce); err == nil {
+		t.Fatal("code was exchanged twice")
+	}
+}
+
+func TestVerifyIdTokenRejectsBadTokens(t *testing.T) {
+	f := newFakeProvider(t)
+	provider := f.discover(t)
+
+	tests := map[string]jwt.MapClaims{
+		"other issuer":   {"iss": "https://evil.example"},
+		"other audience": {"aud": "client-2"},
+		"expired":        {"exp": time.Now().Add(-time.Minute).Unix()},
+		"no expiry":      {"exp": nil},
+		"no subject":     {"sub": ""},
+	}
+
+	for name, claims := range tests {
+		f.claims = claims
+
+		if _, err := provider.VerifyIdToken(context.Background(), f.idToken("n"), "n"); err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+
+	f.claims = nil
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"iss": f.issuer(), "aud": testClientID, "sub": "s", "exp": time.Now().Add(time.Minute).Unix()})
+	token.Header["kid"] = f.kid
+	forged, _ := token.SignedString(other)
+
+	if _, err := provider.VerifyIdToken(context.Background(), forged, ""); err == nil {
+		t.Error("token signed with another key accepted")
+	}
+
+	none := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"iss": f.issuer(), "aud": testClientID, "sub": "s", "exp": time.Now().Add(time.Minute).Unix()})
+	unsigned, _ := none.SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	if _, err := provider.VerifyIdToken(context.Background(), unsigned, ""); err == nil {
+		t.Error("unsigned token accepted")
+	}
+}
+
+func TestEmailVerifiedAsString(t *testing.T) {
+	f := newFakeProvider(t)
+	provider := f.discover(t)
+
+	for value, want := range map[string]bool{"true": true, "false": false} {
+		f.claims = jwt.MapClaims{"email_verified": value}
+
+		claims, err := provider.VerifyIdToken(context.Background(), f.idToken("n"), "n")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if bool(claims.EmailVerified) != want {
+			t.Errorf("email_verified %q read as %v", value, claims.EmailVerified)
+		}
+	}
+}
+
+func TestDiscoverRejectsForeignIssuer(t *testing.T) {
+	f := newFakeProvider(t)
+
+	_, err := Discover(context.Background(), Config{Name: "fake", Issuer: f.issuer() + "/other", ClientID: testClientID})
+
+	if err == nil {
+		t.Fatal("discovery accepted a document for another issuer")
+	}
+}
+
+func TestDiscoverRejectsIncompleteMetadata(t *testing.T) {
+	var server *httptest.Server
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Metadata{Issuer: server.URL, AuthorizationEndpoint: server.URL + "/authorize"})
+	}))
+	defer server.Close()
+
+	if _, err := Discover(context.Background(), Config{Name: "fake", Issuer: server.URL}); err == nil {
+		t.Fatal("discovery accepted metadata without token and keys endpoints")
+	}
+}
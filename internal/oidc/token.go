@@ -0,0 +1,69 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type IdTokenClaims struct {
+	Email             string  `json:"email"`
+	EmailVerified     boolish `json:"email_verified"`
+	Name              string  `json:"name"`
+	PreferredUsername string  `json:"preferred_username"`
+	Nonce             string  `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+// boolish accepts both true and "true", some providers send the latter.
+type boolish bool
+
+func (b *boolish) UnmarshalJSON(data []byte) error {
+	var value any
+
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case bool:
+		*b = boolish(v)
+	case string:
+		*b = v == "true"
+	}
+
+	return nil
+}
+
+// VerifyIdToken checks the signature against the provider's keys and the
+// issuer, audience, expiry and nonce of the token.
+func (p *Provider) VerifyIdToken(ctx context.Context, raw string, nonce string) (*IdTokenClaims, error) {
+	var claims IdTokenClaims
+
+	_, err := jwt.ParseWithClaims(raw, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.keys.get(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384"}),
+		jwt.WithIssuer(p.config.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("verifying id token: %v", err)
+	}
+
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("verifying id token: no subject")
+	}
+
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("verifying id token: nonce mismatch")
+	}
+
+	return &claims, nil
+}
@@ -0,0 +1,54 @@
+package passwordpolicy
+
+import (
+	"auth-service/internal/keys"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// Configure replaces Default with the policy set by PASSWORD_MIN_LENGTH and
+// COMMON_PASSWORDS_FILE, whose passwords are added to the bundled list. It
+// leaves Default alone when neither is set.
+func Configure() error {
+	if keys.PASSWORD_MIN_LENGTH == "" && keys.COMMON_PASSWORDS_FILE == "" {
+		return nil
+	}
+
+	minLength := DefaultMinLength
+
+	if keys.PASSWORD_MIN_LENGTH != "" {
+		var err error
+
+		minLength, err = strconv.Atoi(keys.PASSWORD_MIN_LENGTH)
+
+		if err != nil || minLength < 1 {
+			return fmt.Errorf("invalid PASSWORD_MIN_LENGTH %q", keys.PASSWORD_MIN_LENGTH)
+		}
+	}
+
+	var lists []io.Reader
+
+	if keys.COMMON_PASSWORDS_FILE != "" {
+		file, err := os.Open(keys.COMMON_PASSWORDS_FILE)
+
+		if err != nil {
+			return err
+		}
+
+		defer file.Close()
+
+		lists = append(lists, file)
+	}
+
+	policy, err := New(minLength, lists...)
+
+	if err != nil {
+		return err
+	}
+
+	Default = policy
+
+	return nil
+}
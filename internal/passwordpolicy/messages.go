@@ -0,0 +1,70 @@
+package passwordpolicy
+
+import (
+	"fmt"
+	"strings"
+)
+
+const DefaultLanguage = "en"
+
+const messageRejected = "rejected"
+
+var messages = map[string]map[string]string{
+	"en": {
+		messageRejected:      "The password doesn't meet the requirements",
+		CodeTooShort:         "Use at least %d characters",
+		CodeTooLong:          "Use at most %d characters",
+		CodeContainsUsername: "Don't use your username in the password",
+		CodeContainsEmail:    "Don't use your email address in the password",
+		CodeCommon:           "This password is too common, choose one that is harder to guess",
+	},
+	"uk": {
+		messageRejected:      "Пароль не відповідає вимогам",
+		CodeTooShort:         "Використайте щонайменше %d символів",
+		CodeTooLong:          "Використайте не більше %d символів",
+		CodeContainsUsername: "Не використовуйте своє ім'я користувача в паролі",
+		CodeContainsEmail:    "Не використовуйте свою електронну адресу в паролі",
+		CodeCommon:           "Цей пароль надто поширений, виберіть складніший",
+	},
+}
+
+type Reason struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Language picks the first supported language from an Accept-Language
+// header. Quality values are ignored, browsers list languages in order anyway.
+func Language(acceptLanguage string) string {
+	for _, tag := range strings.Split(acceptLanguage, ",") {
+		tag, _, _ = strings.Cut(tag, ";")
+		primary, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+
+		if _, ok := messages[primary]; ok {
+			return primary
+		}
+	}
+
+	return DefaultLanguage
+}
+
+// Message returns the summary shown above the reasons.
+func Message(language string) string {
+	return messages[language][messageRejected]
+}
+
+func Localize(violations []Violation, language string) []Reason {
+	reasons := make([]Reason, 0, len(violations))
+
+	for _, violation := range violations {
+		message := messages[language][violation.Code]
+
+		if violation.Limit != 0 {
+			message = fmt.Sprintf(message, violation.Limit)
+		}
+
+		reasons = append(reasons, Reason{Code: violation.Code, Message: message})
+	}
+
+	return reasons
+}
@@ -0,0 +1,160 @@
+// Package passwordpolicy decides whether a password is good enough to be
+// set. Besides length it rejects passwords built from the user's own name or
+// address and passwords from a bundled list of the most common breached
+// ones, so the checks run without calling any outside service.
+package passwordpolicy
+
+import (
+	"auth-service/pkg/bloom"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	_ "embed"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+//go:embed common-passwords.txt.gz
+var commonPasswords []byte
+
+// violation codes, stable for clients to match on
+const (
+	CodeTooShort         = "too_short"
+	CodeTooLong          = "too_long"
+	CodeContainsUsername = "contains_username"
+	CodeContainsEmail    = "contains_email"
+	CodeCommon           = "common"
+)
+
+const (
+	DefaultMinLength = 8
+	// long enough for any passphrase, short enough to keep hashing cheap
+	DefaultMaxLength = 256
+
+	// names shorter than this show up inside too many good passwords
+	minIdentifierLength = 3
+
+	falsePositiveRate = 0.001
+)
+
+type Violation struct {
+	Code  string
+	Limit int
+}
+
+type Policy struct {
+	MinLength int
+	MaxLength int
+	common    *bloom.Filter
+}
+
+// Default is the policy applied wherever a password is set.
+var Default = mustNew(DefaultMinLength)
+
+func mustNew(minLength int) *Policy {
+	policy, err := New(minLength)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return policy
+}
+
+// New returns a policy with the bundled common password list and any extra
+// lists, one password per line, plain or gzipped.
+func New(minLength int, lists ...io.Reader) (*Policy, error) {
+	passwords, err := readList(bytes.NewReader(commonPasswords))
+
+	if err != nil {
+		return nil, fmt.Errorf("reading bundled password list: %v", err)
+	}
+
+	for _, list := range lists {
+		extra, err := readList(list)
+
+		if err != nil {
+			return nil, fmt.Errorf("reading password list: %v", err)
+		}
+
+		passwords = append(passwords, extra...)
+	}
+
+	common := bloom.New(len(passwords), falsePositiveRate)
+
+	for _, password := range passwords {
+		common.Add(password)
+	}
+
+	return &Policy{MinLength: minLength, MaxLength: DefaultMaxLength, common: common}, nil
+}
+
+func readList(r io.Reader) ([]string, error) {
+	buffered := bufio.NewReader(r)
+
+	// gzip streams start with 1f 8b
+	if magic, err := buffered.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer gz.Close()
+
+		buffered = bufio.NewReader(gz)
+	}
+
+	var passwords []string
+
+	scanner := bufio.NewScanner(buffered)
+
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			passwords = append(passwords, strings.ToLower(line))
+		}
+	}
+
+	return passwords, scanner.Err()
+}
+
+// Check returns everything wrong with the password, nothing when it may be set.
+func (p *Policy) Check(password string, username string, email string) []Violation {
+	var violations []Violation
+
+	length := utf8.RuneCountInString(password)
+
+	if length < p.MinLength {
+		violations = append(violations, Violation{Code: CodeTooShort, Limit: p.MinLength})
+	}
+
+	if length > p.MaxLength {
+		violations = append(violations, Violation{Code: CodeTooLong, Limit: p.MaxLength})
+	}
+
+	lower := strings.ToLower(password)
+
+	if contains(lower, username) {
+		violations = append(violations, Violation{Code: CodeContainsUsername})
+	}
+
+	local, _, _ := strings.Cut(email, "@")
+
+	if contains(lower, local) {
+		violations = append(violations, Violation{Code: CodeContainsEmail})
+	}
+
+	if p.common.Has(lower) {
+		violations = append(violations, Violation{Code: CodeCommon})
+	}
+
+	return violations
+}
+
+func contains(password string, identifier string) bool {
+	identifier = strings.ToLower(strings.TrimSpace(identifier))
+
+	return utf8.RuneCountInString(identifier) >= minIdentifierLength && strings.Contains(password, identifier)
+}
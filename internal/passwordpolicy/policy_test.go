@@ -0,0 +1,138 @@
+package passwordpolicy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func codes(violations []Violation) []string {
+	var codes []string
+
+	for _, violation := range violations {
+		codes = append(codes, violation.Code)
+	}
+
+	return codes
+}
+
+func TestCheck(t *testing.T) {
+	policy := mustNew(DefaultMinLength)
+
+	tests := []struct {
+		name     string
+		password string
+		username string
+		email    string
+		want     []string
+	}{
+		{name: "good", password: "violet-anchor-91", username: "ada", email: "ada@example.com"},
+		{name: "too short", password: "v-a-91", want: []string{CodeTooShort}},
+		{name: "counts runes, not bytes", password: "пароль12", username: "ada"},
+		{name: "too long", password: strings.Repeat("violet-anchor-", 20), want: []string{CodeTooLong}},
+		{name: "username", password: "lovelace-anchor-91", username: "Lovelace", want: []string{CodeContainsUsername}},
+		{name: "username in other case", password: "LOVELACE-anchor-91", username: "lovelace", want: []string{CodeContainsUsername}},
+		{name: "short username", password: "ad-violet-anchor", username: "ad"},
+		{name: "email", password: "ada.l-anchor-91", email: "ada.l@example.com", want: []string{CodeContainsEmail}},
+		{name: "email domain", password: "example-anchor-91", email: "ada@example.com"},
+		{name: "common", password: "password", want: []string{CodeCommon}},
+		{name: "common in other case", password: "PassWord", want: []string{CodeCommon}},
+		{name: "everything", password: "qwerty", username: "qwe", email: "qwerty@example.com", want: []string{CodeTooShort, CodeContainsUsername, CodeContainsEmail, CodeCommon}},
+	}
+
+	for _, tt := range tests {
+		if got := codes(policy.Check(tt.password, tt.username, tt.email)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckLimits(t *testing.T) {
+	policy := mustNew(12)
+
+	want := []Violation{{Code: CodeTooShort, Limit: 12}}
+
+	if got := policy.Check("violet-91", "", ""); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestExtraLists(t *testing.T) {
+	var gzipped bytes.Buffer
+
+	gz := gzip.NewWriter(&gzipped)
+	gz.Write([]byte("Gzipped-Anchor-91\n"))
+	gz.Close()
+
+	policy, err := New(DefaultMinLength, strings.NewReader("violet-anchor-91\n\n  plain-anchor-91  \n"), &gzipped)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, password := range []string{"violet-anchor-91", "plain-anchor-91", "gzipped-anchor-91", "password"} {
+		if got := codes(policy.Check(password, "", "")); !reflect.DeepEqual(got, []string{CodeCommon}) {
+			t.Errorf("%q: got %v, want it common", password, got)
+		}
+	}
+}
+
+func TestLanguage(t *testing.T) {
+	tests := map[string]string{
+		"":                         DefaultLanguage,
+		"uk":                       "uk",
+		"uk-UA,uk;q=0.9,en;q=0.8":  "uk",
+		"de-DE,uk;q=0.9":           "uk",
+		"EN-gb":                    "en",
+		"de-DE, fr;q=0.5":          DefaultLanguage,
+		"*":                        DefaultLanguage,
+		" uk ; q=0.9 , en ; q=0.8": "uk",
+	}
+
+	for header, want := range tests {
+		if got := Language(header); got != want {
+			t.Errorf("%q: got %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	violations := []Violation{{Code: CodeTooShort, Limit: 12}, {Code: CodeCommon}}
+
+	tests := map[string][]Reason{
+		"en": {
+			{Code: CodeTooShort, Message: "Use at least 12 characters"},
+			{Code: CodeCommon, Message: "This password is too common, choose one that is harder to guess"},
+		},
+		"uk": {
+			{Code: CodeTooShort, Message: "Використайте щонайменше 12 символів"},
+			{Code: CodeCommon, Message: "Цей пароль надто поширений, виберіть складніший"},
+		},
+	}
+
+	for language, want := range tests {
+		if got := Localize(violations, language); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %+v, want %+v", language, got, want)
+		}
+	}
+
+	if got := Localize(nil, "en"); got == nil || len(got) != 0 {
+		t.Errorf("no violations: got %#v, want an empty list", got)
+	}
+}
+
+func TestEveryLanguageHasEveryMessage(t *testing.T) {
+	for language, translated := range messages {
+		for code := range messages[DefaultLanguage] {
+			if translated[code] == "" {
+				t.Errorf("%s: no message for %s", language, code)
+			}
+		}
+
+		if Message(language) == "" {
+			t.Errorf("%s: no summary", language)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+type Result struct {
+	Allowed bool
+	// Remaining is the number of whole tokens left after this request
+	Remaining int
+	// Reset is the time until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is the time until the next token, set when Allowed is false
+	RetryAfter time.Duration
+}
+
+type Backend interface {
+	Take(key string, policy Policy) (Result, error)
+}
+
+// result derives the response fields from the tokens left in the bucket.
+func result(allowed bool, tokens float64, policy Policy) Result {
+	rate := policy.Rate()
+
+	res := Result{
+		Allowed:   allowed,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(policy.Burst) - tokens) / rate * float64(time.Second)),
+	}
+
+	if !allowed {
+		res.RetryAfter = time.Duration((1 - tokens) / rate * float64(time.Second))
+	}
+
+	return res
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// MemoryBackend keeps buckets in process. Limits are per instance.
+type MemoryBackend struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	sweep   time.Time
+	now     func() time.Time
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+func (b *MemoryBackend) Take(key string, policy Policy) (Result, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+
+	b.evict(now)
+
+	bkt, ok := b.buckets[key]
+
+	if !ok {
+		bkt = &bucket{tokens: float64(policy.Burst), updated: now}
+		b.buckets[key] = bkt
+	}
+
+	bkt.tokens = math.Min(float64(policy.Burst), bkt.tokens+now.Sub(bkt.updated).Seconds()*policy.Rate())
+	bkt.updated = now
+
+	if bkt.tokens < 1 {
+		return result(false, bkt.tokens, policy), nil
+	}
+
+	bkt.tokens--
+
+	return result(true, bkt.tokens, policy), nil
+}
+
+// evict drops buckets idle for an hour once a minute, so the map doesn't
+// grow with every IP that ever made a request. Policies longer than that
+// restart from a full bucket, which only ever errs on the lenient side.
+func (b *MemoryBackend) evict(now time.Time) {
+	if now.Sub(b.sweep) < time.Minute {
+		return
+	}
+
+	b.sweep = now
+
+	for key, bkt := range b.buckets {
+		if now.Sub(bkt.updated) > time.Hour {
+			delete(b.buckets, key)
+		}
+	}
+}
+
+type TokenStore interface {
+	// TakeRateLimitToken refills the bucket, takes a token if one is
+	// available and returns the tokens left and whether one was taken.
+	TakeRateLimitToken(key string, rate float64, burst int) (float64, bool, error)
+	PruneRateLimitBuckets() error
+}
+
+// PostgresBackend keeps buckets in the database so all instances share them.
+type PostgresBackend struct {
+	store TokenStore
+
+	mu    sync.Mutex
+	prune time.Time
+}
+
+func NewPostgresBackend(store TokenStore) *PostgresBackend {
+	return &PostgresBackend{store: store}
+}
+
+func (b *PostgresBackend) Take(key string, policy Policy) (Result, error) {
+	b.mu.Lock()
+
+	if time.Since(b.prune) > time.Hour {
+		b.prune = time.Now()
+
+		go func() {
+			if err := b.store.PruneRateLimitBuckets(); err != nil {
+				log.Error().Err(err).Msg("Failed to prune rate limit buckets")
+			}
+		}()
+	}
+
+	b.mu.Unlock()
+
+	tokens, allowed, err := b.store.TakeRateLimitToken(key, policy.Rate(), policy.Burst)
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	return result(allowed, tokens, policy), nil
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"auth-service/internal/auth"
+	"auth-service/internal/cors"
+	"auth-service/pkg/realip"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+type Limiter struct {
+	backend    Backend
+	policies   map[string]Policy
+	trustProxy bool
+}
+
+func NewLimiter(backend Backend, policies map[string]Policy, trustProxy bool) *Limiter {
+	return &Limiter{
+		backend:    backend,
+		policies:   policies,
+		trustProxy: trustProxy,
+	}
+}
+
+// Allow takes a token for the key under the named policy, for handlers that
+// limit on something other than the caller, such as an email address. It
+// returns the time to wait when the limit is hit. Unknown policies and
+// backend failures allow the request.
+func (l *Limiter) Allow(name string, key string) (bool, time.Duration) {
+	policy, ok := l.policies[name]
+
+	if !ok {
+		return true, 0
+	}
+
+	res, err := l.backend.Take(name+":"+key, policy)
+
+	if err != nil {
+		log.Error().Err(err).Str("policy", name).Msg("Failed to check rate limit")
+		return true, 0
+	}
+
+	return res.Allowed, res.RetryAfter
+}
+
+// Limit applies the named policy to the handler. Policies keyed by user need
+// the caller's claims, so they must run inside CheckAuth; anonymous
+// requests fall back to the IP.
+func (l *Limiter) Limit(name string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		policy, ok := l.policies[name]
+
+		// preflight requests don't do anything worth limiting
+		if !ok || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		principal := "ip:" + realip.FromRequest(r, l.trustProxy)
+
+		if policy.Key == KeyUser {
+			if userId, ok := auth.UserIdFromContext(r.Context()); ok {
+				principal = "user:" + strconv.Itoa(userId)
+			}
+		}
+
+		res, err := l.backend.Take(name+":"+principal, policy)
+
+		// an unavailable backend shouldn't take the endpoints down with it
+		if err != nil {
+			log.Error().Err(err).Str("policy", name).Msg("Failed to check rate limit")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(policy.Burst))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		w.Header().Set("RateLimit-Reset", seconds(res.Reset))
+		w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Burst, int(policy.Period.Seconds())))
+
+		if !res.Allowed {
+			// the handler would have set these, without them browsers hide the 429
+			cors.EnableCors(&w)
+
+			w.Header().Set("Retry-After", seconds(res.RetryAfter))
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// seconds rounds up, so clients never retry a moment too early.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
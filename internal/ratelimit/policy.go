@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// principals a policy can key its buckets by
+const (
+	KeyIP   = "ip"
+	KeyUser = "user"
+)
+
+// Policy is a token bucket: Burst requests at once, refilled at Burst per Period.
+type Policy struct {
+	Name   string
+	Burst  int
+	Period time.Duration
+	Key    string
+}
+
+// Rate is the refill rate in tokens per second.
+func (p Policy) Rate() float64 {
+	return float64(p.Burst) / p.Period.Seconds()
+}
+
+// DefaultPolicies cover the endpoints that are open to abuse. They can be
+// overridden one by one with RATE_LIMITS.
+const DefaultPolicies = "signin=10/1m:ip,signup=5/1h:ip,join-company=10/1m:user,verify-email-resend=3/1h:user,password-forgot=5/1h:ip,password-change=5/15m:user,magic-link=10/1h:ip,magic-link-address=3/15m,data-export=3/24h:user"
+
+// ParsePolicies reads a comma separated list of "name=burst/period[:key]",
+// e.g. "signin=10/1m:ip,join-company=10/1m:user,verify-email-resend=3/1h:user,password-forgot=5/1h:ip,password-change=5/15m:user". The key defaults to ip.
+func ParsePolicies(config string) (map[string]Policy, error) {
+	policies := make(map[string]Policy)
+
+	for _, entry := range strings.Split(config, ",") {
+		entry = strings.TrimSpace(entry)
+
+		if entry == "" {
+			continue
+		}
+
+		name, spec, ok := strings.Cut(entry, "=")
+
+		if !ok {
+			return nil, fmt.Errorf("rate limit %q: missing '='", entry)
+		}
+
+		spec, key, hasKey := strings.Cut(spec, ":")
+
+		if !hasKey {
+			key = KeyIP
+		}
+
+		if key != KeyIP && key != KeyUser {
+			return nil, fmt.Errorf("rate limit %q: unknown key %q", name, key)
+		}
+
+		burstVal, periodVal, ok := strings.Cut(spec, "/")
+
+		if !ok {
+			return nil, fmt.Errorf("rate limit %q: missing period", name)
+		}
+
+		burst, err := strconv.Atoi(burstVal)
+
+		if err != nil || burst < 1 {
+			return nil, fmt.Errorf("rate limit %q: invalid burst %q", name, burstVal)
+		}
+
+		period, err := time.ParseDuration(periodVal)
+
+		if err != nil || period <= 0 {
+			return nil, fmt.Errorf("rate limit %q: invalid period %q", name, periodVal)
+		}
+
+		policies[strings.TrimSpace(name)] = Policy{
+			Name:   strings.TrimSpace(name),
+			Burst:  burst,
+			Period: period,
+			Key:    key,
+		}
+	}
+
+	return policies, nil
+}
+
+// LoadPolicies returns the default policies with the overrides applied on top.
+func LoadPolicies(overrides string) (map[string]Policy, error) {
+	policies, err := ParsePolicies(DefaultPolicies)
+
+	if err != nil {
+		return nil, err
+	}
+
+	custom, err := ParsePolicies(overrides)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for name, policy := range custom {
+		policies[name] = policy
+	}
+
+	return policies, nil
+}
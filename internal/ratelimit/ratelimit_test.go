@@ -0,0 +1,195 @@
+package ratelimit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParsePolicies(t *testing.T) {
+	tests := []struct {
+		config string
+		want   map[string]Policy
+		err    bool
+	}{
+		{config: "", want: map[string]Policy{}},
+		{config: "signin=10/1m", want: map[string]Policy{"signin": {Name: "signin", Burst: 10, Period: time.Minute, Key: KeyIP}}},
+		{config: " signin =10/1m:user , ,signup=5/1h:ip", want: map[string]Policy{
+			"signin": {Name: "signin", Burst: 10, Period: time.Minute, Key: KeyUser},
+			"signup": {Name: "signup", Burst: 5, Period: time.Hour, Key: KeyIP},
+		}},
+		{config: "signin", err: true},
+		{config: "signin=10", err: true},
+		{config: "signin=0/1m", err: true},
+		{config: "signin=ten/1m", err: true},
+		{config: "signin=10/0s", err: true},
+		{config: "signin=10/minute", err: true},
+		{config: "signin=10/1m:email", err: true},
+	}
+
+	for _, tt := range tests {
+		policies, err := ParsePolicies(tt.config)
+
+		if (err != nil) != tt.err {
+			t.Errorf("%q: error %v, want error %v", tt.config, err, tt.err)
+			continue
+		}
+
+		if !tt.err && !reflect.DeepEqual(policies, tt.want) {
+			t.Errorf("%q: got %+v, want %+v", tt.config, policies, tt.want)
+		}
+	}
+}
+
+func TestLoadPoliciesOverridesDefaults(t *testing.T) {
+	policies, err := LoadPolicies("signin=3/1m:user,custom=1/1s")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := policies["signin"]; got.Burst != 3 || got.Key != KeyUser {
+		t.Errorf("signin: got %+v, want the override", got)
+	}
+
+	if _, ok := policies["signup"]; !ok {
+		t.Error("signup: default dropped")
+	}
+
+	if _, ok := policies["custom"]; !ok {
+		t.Error("custom: override dropped")
+	}
+}
+
+func TestMemoryBackendRefills(t *testing.T) {
+	// 6 tokens a minute, one every 10 seconds
+	policy := Policy{Burst: 6, Period: time.Minute}
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	backend := NewMemoryBackend()
+	backend.now = func() time.Time { return now }
+
+	for i := 0; i < policy.Burst; i++ {
+		if res, _ := backend.Take("key", policy); !res.Allowed || res.Remaining != policy.Burst-1-i {
+			t.Fatalf("request %d of the burst: %+v", i+1, res)
+		}
+	}
+
+	steps := []struct {
+		wait       time.Duration
+		key        string
+		allowed    bool
+		remaining  int
+		reset      time.Duration
+		retryAfter time.Duration
+	}{
+		{key: "key", allowed: false, reset: time.Minute, retryAfter: 10 * time.Second},
+		{wait: 4 * time.Second, key: "key", allowed: false, reset: 56 * time.Second, retryAfter: 6 * time.Second},
+		{wait: 6 * time.Second, key: "key", allowed: true, reset: time.Minute},
+		{wait: 25 * time.Second, key: "key", allowed: true, remaining: 1, reset: 45 * time.Second},
+		{key: "key", allowed: true, reset: 55 * time.Second},
+		{key: "key", allowed: false, reset: 55 * time.Second, retryAfter: 5 * time.Second},
+		{key: "other", allowed: true, remaining: 5, reset: 10 * time.Second},
+		// never more than the burst, however long the wait
+		{wait: time.Hour, key: "key", allowed: true, remaining: 5, reset: 10 * time.Second},
+	}
+
+	for i, step := range steps {
+		now = now.Add(step.wait)
+
+		res, err := backend.Take(step.key, policy)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := Result{Allowed: step.allowed, Remaining: step.remaining, Reset: step.reset, RetryAfter: step.retryAfter}
+
+		if res.Allowed != want.Allowed || res.Remaining != want.Remaining || !near(res.Reset, want.Reset) || !near(res.RetryAfter, want.RetryAfter) {
+			t.Errorf("step %d: got %+v, want %+v", i+1, res, want)
+		}
+	}
+}
+
+// near allows for the rounding of float seconds to durations.
+func near(a, b time.Duration) bool {
+	return (a - b).Abs() < time.Millisecond
+}
+
+type fakeBackend struct {
+	res Result
+	err error
+}
+
+func (b *fakeBackend) Take(key string, policy Policy) (Result, error) {
+	return b.res, b.err
+}
+
+func TestLimitHeaders(t *testing.T) {
+	policies := map[string]Policy{"signin": {Name: "signin", Burst: 10, Period: time.Minute, Key: KeyIP}}
+
+	tests := []struct {
+		name    string
+		method  string
+		backend *fakeBackend
+		status  int
+		headers map[string]string
+	}{
+		{
+			name:    "allowed",
+			backend: &fakeBackend{res: Result{Allowed: true, Remaining: 7, Reset: 18 * time.Second}},
+			status:  http.StatusOK,
+			headers: map[string]string{"RateLimit-Limit": "10", "RateLimit-Remaining": "7", "RateLimit-Reset": "18", "RateLimit-Policy": "10;w=60", "Retry-After": ""},
+		},
+		{
+			name:    "limited, rounds up",
+			backend: &fakeBackend{res: Result{Allowed: false, Reset: 60 * time.Second, RetryAfter: 5100 * time.Millisecond}},
+			status:  http.StatusTooManyRequests,
+			headers: map[string]string{"RateLimit-Remaining": "0", "RateLimit-Reset": "60", "Retry-After": "6"},
+		},
+		{
+			name:    "backend down",
+			backend: &fakeBackend{err: errors.New("connection refused")},
+			status:  http.StatusOK,
+			headers: map[string]string{"RateLimit-Limit": "", "Retry-After": ""},
+		},
+		{
+			name:    "preflight",
+			method:  http.MethodOptions,
+			backend: &fakeBackend{res: Result{Allowed: false, RetryAfter: time.Second}},
+			status:  http.StatusOK,
+			headers: map[string]string{"RateLimit-Limit": "", "Retry-After": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		limiter := NewLimiter(tt.backend, policies, false)
+
+		handler := limiter.Limit("signin", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+
+		method := tt.method
+
+		if method == "" {
+			method = http.MethodPost
+		}
+
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(method, "/signin", nil))
+
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.status)
+		}
+
+		for header, want := range tt.headers {
+			if got := w.Header().Get(header); got != want {
+				t.Errorf("%s: %s is %q, want %q", tt.name, header, got, want)
+			}
+		}
+	}
+}
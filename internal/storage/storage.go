@@ -1,8 +1,13 @@
 package storage
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"mime/multipart"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
@@ -27,7 +32,7 @@ func UploadFileToS3(file multipart.File, folder string, fileHeader *multipart.Fi
 
 	_, err = svc.PutObject(&s3.PutObjectInput{
 		Bucket: aws.String(bucketName),
-		Key:    aws.String(fileName),
+		Key:    aws.String(folder + "/" + fileName),
 		Body:   file,
 		ContentType: aws.String(fileHeader.Header.Get("Content-Type")),
 	})
@@ -38,4 +43,174 @@ func UploadFileToS3(file multipart.File, folder string, fileHeader *multipart.Fi
 
 	fileURL := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s/%s", bucketName, awsRegion, folder, fileName)
 	return fileURL, nil
-}
\ No newline at end of file
+}
+
+// DeleteFileFromS3 removes a file uploaded with UploadFileToS3, given its URL.
+// URLs outside the bucket are refused.
+func DeleteFileFromS3(fileURL string, bucketName, awsRegion, awsAccessKey, awsSecretKey string) error {
+	key, err := bucketKey(fileURL, bucketName, awsRegion)
+
+	if err != nil {
+		return err
+	}
+
+	return DeleteObjectFromS3(key, bucketName, awsRegion, awsAccessKey, awsSecretKey)
+}
+
+// GetFileFromS3 downloads a file uploaded with UploadFileToS3, given its URL.
+// URLs outside the bucket are refused.
+func GetFileFromS3(fileURL string, bucketName, awsRegion, awsAccessKey, awsSecretKey string) ([]byte, error) {
+	key, err := bucketKey(fileURL, bucketName, awsRegion)
+
+	if err != nil {
+		return nil, err
+	}
+
+	svc, err := newS3(awsRegion, awsAccessKey, awsSecretKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file from S3: %v", err)
+	}
+
+	defer output.Body.Close()
+
+	data, err := io.ReadAll(output.Body)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file from S3: %v", err)
+	}
+
+	return data, nil
+}
+
+// PutObjectToS3 stores data under the key. Unlike UploadFileToS3 the object
+// is not meant to be public, it is handed out with PresignS3Download.
+func PutObjectToS3(key string, data []byte, contentType string, bucketName, awsRegion, awsAccessKey, awsSecretKey string) error {
+	svc, err := newS3(awsRegion, awsAccessKey, awsSecretKey)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = svc.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(bucketName),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(contentType),
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to upload object to S3: %v", err)
+	}
+
+	return nil
+}
+
+// CheckBucketPrivate makes sure the bucket blocks every kind of public
+// access, so an object in it can only be read through a presigned link.
+func CheckBucketPrivate(bucketName, awsRegion, awsAccessKey, awsSecretKey string) error {
+	svc, err := newS3(awsRegion, awsAccessKey, awsSecretKey)
+
+	if err != nil {
+		return err
+	}
+
+	out, err := svc.GetPublicAccessBlock(&s3.GetPublicAccessBlockInput{
+		Bucket: aws.String(bucketName),
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to get public access block of bucket %s: %v", bucketName, err)
+	}
+
+	block := out.PublicAccessBlockConfiguration
+
+	if block == nil || !aws.BoolValue(block.BlockPublicAcls) || !aws.BoolValue(block.IgnorePublicAcls) ||
+		!aws.BoolValue(block.BlockPublicPolicy) || !aws.BoolValue(block.RestrictPublicBuckets) {
+		return fmt.Errorf("bucket %s does not block all public access", bucketName)
+	}
+
+	return nil
+}
+
+func DeleteObjectFromS3(key string, bucketName, awsRegion, awsAccessKey, awsSecretKey string) error {
+	svc, err := newS3(awsRegion, awsAccessKey, awsSecretKey)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to delete file from S3: %v", err)
+	}
+
+	return nil
+}
+
+// PresignS3Download returns a link that downloads the object as fileName
+// until the ttl runs out.
+func PresignS3Download(key, fileName string, ttl time.Duration, bucketName, awsRegion, awsAccessKey, awsSecretKey string) (string, error) {
+	svc, err := newS3(awsRegion, awsAccessKey, awsSecretKey)
+
+	if err != nil {
+		return "", err
+	}
+
+	req, _ := svc.GetObjectRequest(&s3.GetObjectInput{
+		Bucket:                     aws.String(bucketName),
+		Key:                        aws.String(key),
+		ResponseContentDisposition: aws.String(fmt.Sprintf("attachment; filename=%q", fileName)),
+	})
+
+	link, err := req.Presign(ttl)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to presign S3 download: %v", err)
+	}
+
+	return link, nil
+}
+
+func newS3(awsRegion, awsAccessKey, awsSecretKey string) (*s3.S3, error) {
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String(awsRegion),
+		Credentials: credentials.NewStaticCredentials(awsAccessKey, awsSecretKey, ""),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS session: %v", err)
+	}
+
+	return s3.New(sess), nil
+}
+
+// bucketKey returns the key of a file URL built by UploadFileToS3.
+func bucketKey(fileURL, bucketName, awsRegion string) (string, error) {
+	parsed, err := url.Parse(fileURL)
+
+	if err != nil {
+		return "", fmt.Errorf("parsing file URL: %v", err)
+	}
+
+	key := strings.TrimPrefix(parsed.Path, "/")
+
+	if parsed.Host != fmt.Sprintf("%s.s3.%s.amazonaws.com", bucketName, awsRegion) || key == "" {
+		return "", fmt.Errorf("file %s is not in bucket %s", fileURL, bucketName)
+	}
+
+	return key, nil
+}
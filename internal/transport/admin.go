@@ -0,0 +1,538 @@
+package transport
+
+import (
+	"auth-service/internal/audit"
+	"auth-service/internal/auth"
+	"auth-service/internal/cors"
+	"auth-service/internal/database"
+	"auth-service/internal/entities"
+	"auth-service/internal/keys"
+	"auth-service/internal/mail"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultAdminUsersLimit = 50
+	maxAdminUsersLimit     = 200
+
+	// forced resets aren't expected, so the link lasts longer than a requested one
+	forcedPasswordResetTTL = 72 * time.Hour
+)
+
+// adminPathId parses the id in the path, answering 400 when it isn't a number.
+func adminPathId(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to convert id to integer")
+		w.WriteHeader(http.StatusBadRequest)
+		return 0, false
+	}
+
+	return id, true
+}
+
+func (res *Resourse) UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	adminId, _ := auth.UserIdFromContext(r.Context())
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to convert id to integer")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = res.s.UnlockAccount(id, adminId)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to unlock account")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.audit.Record(r, audit.Event{
+		Action:     audit.AccountUnlocked,
+		TargetType: audit.TargetUser,
+		TargetId:   id,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// users
+
+type AdminUsersResponse struct {
+	Users []entities.AdminUser `json:"users"`
+	// NextBefore is passed back as "before" to get the next page
+	NextBefore int `json:"nextBefore,omitempty"`
+}
+
+// SearchUsers looks accounts up by username, email or full name (the "q"
+// parameter), newest first.
+func (res *Resourse) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	query := r.URL.Query()
+
+	limit := defaultAdminUsersLimit
+
+	if limitVal := query.Get("limit"); limitVal != "" {
+		var err error
+
+		limit, err = strconv.Atoi(limitVal)
+
+		if err != nil || limit < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+
+		limit = min(limit, maxAdminUsersLimit)
+	}
+
+	var beforeId int
+
+	if beforeVal := query.Get("before"); beforeVal != "" {
+		var err error
+
+		beforeId, err = strconv.Atoi(beforeVal)
+
+		if err != nil {
+			http.Error(w, "Invalid before", http.StatusBadRequest)
+			return
+		}
+	}
+
+	users, err := res.s.SearchUsers(strings.TrimSpace(query.Get("q")), beforeId, limit)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to search users")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := AdminUsersResponse{Users: users}
+
+	if users == nil {
+		response.Users = []entities.AdminUser{}
+	}
+
+	if len(users) == limit {
+		response.NextBefore = users[len(users)-1].Id
+	}
+
+	err = json.NewEncoder(w).Encode(response)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// adminUser loads the user in the path, answering 404 when there is none.
+func (res *Resourse) adminUser(w http.ResponseWriter, r *http.Request) (entities.AdminUser, bool) {
+	id, ok := adminPathId(w, r)
+
+	if !ok {
+		return entities.AdminUser{}, false
+	}
+
+	user, err := res.s.GetAdminUser(id)
+
+	if err != nil {
+		if errors.Is(err, database.ErrUserNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return entities.AdminUser{}, false
+		}
+
+		log.Error().Err(err).Msg("Failed to get user")
+		w.WriteHeader(http.StatusInternalServerError)
+		return entities.AdminUser{}, false
+	}
+
+	return user, true
+}
+
+// notSelf refuses actions an admin could lock themselves out with.
+func notSelf(w http.ResponseWriter, r *http.Request, userId int) bool {
+	adminId, _ := auth.UserIdFromContext(r.Context())
+
+	if adminId == userId {
+		http.Error(w, "Admins can't do this to their own account", http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+func (res *Resourse) GetAdminUser(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	user, ok := res.adminUser(w, r)
+
+	if !ok {
+		return
+	}
+
+	err := json.NewEncoder(w).Encode(user)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+type UpdateUserRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// UpdateUserRole grants or revokes the platform admin role.
+func (res *Resourse) UpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	user, ok := res.adminUser(w, r)
+
+	if !ok || !notSelf(w, r, user.Id) {
+		return
+	}
+
+	var reqBody UpdateUserRoleRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if reqBody.Role != entities.RoleUser && reqBody.Role != entities.RoleAdmin {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	err := res.s.UpdateUserRole(user.Id, reqBody.Role)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to update user role")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.audit.Record(r, audit.Event{
+		Action:     audit.RoleChanged,
+		TargetType: audit.TargetUser,
+		TargetId:   user.Id,
+		Before:     map[string]any{"role": user.Role},
+		After:      map[string]any{"role": reqBody.Role},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type SuspendUserRequest struct {
+	Reason string `json:"reason"`
+}
+
+// SuspendUser signs the user out everywhere and keeps them from signing in
+// until they are unsuspended.
+func (res *Resourse) SuspendUser(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	user, ok := res.adminUser(w, r)
+
+	if !ok || !notSelf(w, r, user.Id) {
+		return
+	}
+
+	var reqBody SuspendUserRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	reqBody.Reason = strings.TrimSpace(reqBody.Reason)
+
+	if reqBody.Reason == "" {
+		http.Error(w, "Reason is required", http.StatusBadRequest)
+		return
+	}
+
+	err := res.s.SuspendUser(user.Id, reqBody.Reason)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to suspend user")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.audit.Record(r, audit.Event{
+		Action:     audit.UserSuspended,
+		TargetType: audit.TargetUser,
+		TargetId:   user.Id,
+		Before:     map[string]any{"suspended": user.SuspendedAt != nil, "reason": user.SuspendedReason},
+		After:      map[string]any{"suspended": true, "reason": reqBody.Reason},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (res *Resourse) UnsuspendUser(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	user, ok := res.adminUser(w, r)
+
+	if !ok {
+		return
+	}
+
+	err := res.s.UnsuspendUser(user.Id)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to unsuspend user")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.audit.Record(r, audit.Event{
+		Action:     audit.UserUnsuspended,
+		TargetType: audit.TargetUser,
+		TargetId:   user.Id,
+		Before:     map[string]any{"suspended": user.SuspendedAt != nil, "reason": user.SuspendedReason},
+		After:      map[string]any{"suspended": false, "reason": ""},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ForcePasswordReset invalidates the user's password, signs them out and
+// mails them a link to choose a new one, e.g. after the password leaked.
+func (res *Resourse) ForcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	user, ok := res.adminUser(w, r)
+
+	if !ok {
+		return
+	}
+
+	token, hash, err := auth.NewOpaqueToken()
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create reset token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = res.s.ForcePasswordReset(user.Id, hash, forcedPasswordResetTTL)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to force password reset")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.audit.Record(r, audit.Event{
+		Action:     audit.PasswordResetForced,
+		TargetType: audit.TargetUser,
+		TargetId:   user.Id,
+	})
+
+	link := keys.FRONTEND_URL + "/password/reset?token=" + url.QueryEscape(token)
+
+	// the password is already reset, so the admin can just try again when this fails
+	err = res.mailer.Send(r.Context(), mail.Message{
+		To:      user.Email,
+		Subject: "Choose a new password",
+		Text:    fmt.Sprintf("An administrator reset the password of your account and signed you out. Open the link below to choose a new password:\n\n%s\n\nThe link expires in 3 days and works once.\n", link),
+	})
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to send password reset email")
+		http.Error(w, "Failed to send the reset email", http.StatusBadGateway)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type ReassignArticlesRequest struct {
+	ToUserId int `json:"toUserId"`
+	// ArticleIds limits the move to these articles, all are moved when empty
+	ArticleIds []int `json:"articleIds"`
+}
+
+type ReassignArticlesResponse struct {
+	Reassigned int64 `json:"reassigned"`
+}
+
+// ReassignArticles hands the articles of the user in the path to another author.
+func (res *Resourse) ReassignArticles(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	user, ok := res.adminUser(w, r)
+
+	if !ok {
+		return
+	}
+
+	var reqBody ReassignArticlesRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if reqBody.ToUserId == user.Id {
+		http.Error(w, "Articles already belong to this user", http.StatusBadRequest)
+		return
+	}
+
+	_, err := res.s.GetAdminUser(reqBody.ToUserId)
+
+	if err != nil {
+		if errors.Is(err, database.ErrUserNotFound) {
+			http.Error(w, "Target user not found", http.StatusBadRequest)
+			return
+		}
+
+		log.Error().Err(err).Msg("Failed to get user")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	reassigned, err := res.s.ReassignArticles(user.Id, reqBody.ToUserId, reqBody.ArticleIds)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to reassign articles")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.audit.Record(r, audit.Event{
+		Action:     audit.ArticlesReassigned,
+		TargetType: audit.TargetUser,
+		TargetId:   user.Id,
+		After:      map[string]any{"toUserId": reqBody.ToUserId, "articleIds": reqBody.ArticleIds, "reassigned": reassigned},
+	})
+
+	json.NewEncoder(w).Encode(ReassignArticlesResponse{Reassigned: reassigned})
+}
+
+// companies
+
+// AdminDeleteCompany deletes a company whatever its state. Members and
+// articles are kept and lose their company.
+func (res *Resourse) AdminDeleteCompany(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	id, ok := adminPathId(w, r)
+
+	if !ok {
+		return
+	}
+
+	company, err := res.s.GetCompanyById(id)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get company by id")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	err = res.s.DetachAndDeleteCompany(id)
+
+	if err != nil {
+		if errors.Is(err, database.ErrCompanyNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		log.Error().Err(err).Msg("Failed to delete company")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	company.Key = ""
+
+	res.audit.Record(r, audit.Event{
+		Action:     audit.CompanyDeleted,
+		TargetType: audit.TargetCompany,
+		TargetId:   id,
+		Before:     company,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type MergeCompanyRequest struct {
+	IntoCompanyId int `json:"intoCompanyId"`
+}
+
+// MergeCompany folds the company in the path into another one, e.g. when the
+// same organization was registered twice.
+func (res *Resourse) MergeCompany(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	id, ok := adminPathId(w, r)
+
+	if !ok {
+		return
+	}
+
+	var reqBody MergeCompanyRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if reqBody.IntoCompanyId == id {
+		http.Error(w, "A company can't be merged into itself", http.StatusBadRequest)
+		return
+	}
+
+	company, err := res.s.GetCompanyById(id)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get company by id")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	err = res.s.MergeCompanies(id, reqBody.IntoCompanyId)
+
+	if err != nil {
+		if errors.Is(err, database.ErrCompanyNotFound) {
+			http.Error(w, "Company not found", http.StatusNotFound)
+			return
+		}
+
+		log.Error().Err(err).Msg("Failed to merge companies")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	company.Key = ""
+
+	res.audit.Record(r, audit.Event{
+		Action:     audit.CompanyMerged,
+		TargetType: audit.TargetCompany,
+		TargetId:   id,
+		Before:     company,
+		After:      map[string]any{"intoCompanyId": reqBody.IntoCompanyId},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
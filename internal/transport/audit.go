@@ -0,0 +1,140 @@
+package transport
+
+import (
+	"auth-service/internal/cors"
+	"auth-service/internal/entities"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultAuditEventsLimit = 50
+	maxAuditEventsLimit     = 500
+)
+
+type AuditEventsResponse struct {
+	Events []entities.AuditEvent `json:"events"`
+	// NextBefore is passed back as "before" to get the next page
+	NextBefore int64 `json:"nextBefore,omitempty"`
+}
+
+// parseAuditEventFilter reads the filter from the query string: actorId,
+// action, targetType, targetId, from and to (RFC 3339) and before (an event id).
+func parseAuditEventFilter(query url.Values) (entities.AuditEventFilter, error) {
+	filter := entities.AuditEventFilter{
+		Action:     query.Get("action"),
+		TargetType: query.Get("targetType"),
+		TargetId:   query.Get("targetId"),
+	}
+
+	var err error
+
+	if value := query.Get("actorId"); value != "" {
+		if filter.ActorId, err = strconv.Atoi(value); err != nil {
+			return filter, fmt.Errorf("invalid actorId")
+		}
+	}
+
+	if value := query.Get("from"); value != "" {
+		if filter.From, err = time.Parse(time.RFC3339, value); err != nil {
+			return filter, fmt.Errorf("invalid from")
+		}
+	}
+
+	if value := query.Get("to"); value != "" {
+		if filter.To, err = time.Parse(time.RFC3339, value); err != nil {
+			return filter, fmt.Errorf("invalid to")
+		}
+	}
+
+	if value := query.Get("before"); value != "" {
+		if filter.BeforeId, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return filter, fmt.Errorf("invalid before")
+		}
+	}
+
+	return filter, nil
+}
+
+func (res *Resourse) GetAuditEvents(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	filter, err := parseAuditEventFilter(r.URL.Query())
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter.Limit = defaultAuditEventsLimit
+
+	if limitVal := r.URL.Query().Get("limit"); limitVal != "" {
+		filter.Limit, err = strconv.Atoi(limitVal)
+
+		if err != nil || filter.Limit < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+
+		filter.Limit = min(filter.Limit, maxAuditEventsLimit)
+	}
+
+	events, err := res.s.GetAuditEvents(filter)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get audit events")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := AuditEventsResponse{Events: events}
+
+	if events == nil {
+		response.Events = []entities.AuditEvent{}
+	}
+
+	if len(events) == filter.Limit {
+		response.NextBefore = events[len(events)-1].Id
+	}
+
+	err = json.NewEncoder(w).Encode(response)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// ExportAuditEvents streams every event matching the filter as
+// newline-delimited JSON, for handing the log to other tools.
+func (res *Resourse) ExportAuditEvents(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	filter, err := parseAuditEventFilter(r.URL.Query())
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit-events.ndjson"`)
+
+	encoder := json.NewEncoder(w)
+
+	// the status is sent with the first row, a failure after that can only cut the export short
+	err = res.s.EachAuditEvent(filter, func(event entities.AuditEvent) error {
+		return encoder.Encode(event)
+	})
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to export audit events")
+	}
+}
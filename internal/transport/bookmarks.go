@@ -0,0 +1,406 @@
+package transport
+
+import (
+	"auth-service/internal/auth"
+	"auth-service/internal/cors"
+	"auth-service/internal/database"
+	"auth-service/internal/entities"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// markBookmarked flags the caller's bookmarks among the articles. Anonymous
+// callers and lookup failures leave the articles untouched.
+func (res *Resourse) markBookmarked(r *http.Request, articles []entities.Article) []entities.Article {
+	userId, ok := auth.UserIdFromContext(r.Context())
+
+	if !ok {
+		return articles
+	}
+
+	marked, err := res.s.MarkBookmarked(userId, articles)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to mark bookmarked articles")
+		return articles
+	}
+
+	return marked
+}
+
+// bookmarks
+
+func (res *Resourse) AddBookmark(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	userId, _ := auth.UserIdFromContext(r.Context())
+
+	articleId, err := strconv.Atoi(r.PathValue("id"))
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to convert id to integer")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = res.s.AddBookmark(userId, articleId)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to add bookmark")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (res *Resourse) RemoveBookmark(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	userId, _ := auth.UserIdFromContext(r.Context())
+
+	articleId, err := strconv.Atoi(r.PathValue("id"))
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to convert id to integer")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = res.s.RemoveBookmark(userId, articleId)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to remove bookmark")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (res *Resourse) GetBookmarks(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	userId, _ := auth.UserIdFromContext(r.Context())
+
+	articles, err := res.s.GetBookmarks(userId)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get bookmarks")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(articles)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// reading lists
+
+type ReadingListRequest struct {
+	Name     string `json:"name"`
+	IsPublic bool   `json:"isPublic"`
+}
+
+type ReadingListArticleRequest struct {
+	ArticleId int `json:"articleId"`
+}
+
+type ReorderReadingListRequest struct {
+	ArticleIds []int `json:"articleIds"`
+}
+
+// ownReadingList loads the list from the path and makes sure the caller owns
+// it. It writes the error response itself and reports whether to go on.
+func (res *Resourse) ownReadingList(w http.ResponseWriter, r *http.Request) (entities.ReadingList, bool) {
+	userId, _ := auth.UserIdFromContext(r.Context())
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to convert id to integer")
+		w.WriteHeader(http.StatusBadRequest)
+		return entities.ReadingList{}, false
+	}
+
+	list, err := res.s.GetReadingListById(id)
+
+	if err != nil {
+		if errors.Is(err, database.ErrReadingListNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return entities.ReadingList{}, false
+		}
+
+		log.Error().Err(err).Msg("Failed to get reading list")
+		w.WriteHeader(http.StatusInternalServerError)
+		return entities.ReadingList{}, false
+	}
+
+	if list.UserId != userId {
+		// don't reveal private lists of other users
+		w.WriteHeader(http.StatusNotFound)
+		return entities.ReadingList{}, false
+	}
+
+	return list, true
+}
+
+func (res *Resourse) CreateReadingList(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	userId, _ := auth.UserIdFromContext(r.Context())
+
+	var reqBody ReadingListRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	reqBody.Name = strings.TrimSpace(reqBody.Name)
+
+	if reqBody.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+
+	id, err := res.s.InsertReadingList(entities.ReadingList{
+		UserId:   userId,
+		Name:     reqBody.Name,
+		IsPublic: reqBody.IsPublic,
+	})
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create reading list")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]int{"id": id})
+}
+
+func (res *Resourse) GetReadingListsByUserId(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to convert id to integer")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	callerId, _ := auth.UserIdFromContext(r.Context())
+
+	lists, err := res.s.GetReadingListsByUserId(id, callerId == id)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get reading lists")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(lists)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+func (res *Resourse) GetReadingListById(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to convert id to integer")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	list, err := res.s.GetReadingListById(id)
+
+	if err != nil {
+		if errors.Is(err, database.ErrReadingListNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		log.Error().Err(err).Msg("Failed to get reading list")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	callerId, _ := auth.UserIdFromContext(r.Context())
+
+	if !list.IsPublic && list.UserId != callerId {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	list.Articles = res.markBookmarked(r, list.Articles)
+
+	err = json.NewEncoder(w).Encode(list)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+func (res *Resourse) UpdateReadingList(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	list, ok := res.ownReadingList(w, r)
+
+	if !ok {
+		return
+	}
+
+	var reqBody ReadingListRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	reqBody.Name = strings.TrimSpace(reqBody.Name)
+
+	if reqBody.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+
+	list.Name = reqBody.Name
+	list.IsPublic = reqBody.IsPublic
+
+	err := res.s.UpdateReadingList(list.Id, list)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to update reading list")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+}
+
+func (res *Resourse) DeleteReadingList(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	list, ok := res.ownReadingList(w, r)
+
+	if !ok {
+		return
+	}
+
+	err := res.s.DeleteReadingList(list.Id)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to delete reading list")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (res *Resourse) AddReadingListArticle(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	list, ok := res.ownReadingList(w, r)
+
+	if !ok {
+		return
+	}
+
+	var reqBody ReadingListArticleRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	err := res.s.AddReadingListArticle(list.Id, reqBody.ArticleId)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to add article to reading list")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (res *Resourse) RemoveReadingListArticle(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	list, ok := res.ownReadingList(w, r)
+
+	if !ok {
+		return
+	}
+
+	articleId, err := strconv.Atoi(r.PathValue("articleId"))
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to convert article id to integer")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = res.s.RemoveReadingListArticle(list.Id, articleId)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to remove article from reading list")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (res *Resourse) ReorderReadingList(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	list, ok := res.ownReadingList(w, r)
+
+	if !ok {
+		return
+	}
+
+	var reqBody ReorderReadingListRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	err := res.s.ReorderReadingList(list.Id, reqBody.ArticleIds)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to reorder reading list")
+
+		if errors.Is(err, database.ErrInvalidOrder) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
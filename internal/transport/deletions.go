@@ -0,0 +1,288 @@
+package transport
+
+import (
+	"auth-service/internal/accounts"
+	"auth-service/internal/audit"
+	"auth-service/internal/auth"
+	"auth-service/internal/cors"
+	"auth-service/internal/database"
+	"auth-service/internal/entities"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+)
+
+// accountOwnerOrAdmin parses the user id in the path and checks the caller is
+// that user or a platform admin. It reports whether the caller is an admin.
+func (res *Resourse) accountOwnerOrAdmin(w http.ResponseWriter, r *http.Request) (int, bool, bool) {
+	callerId, _ := auth.UserIdFromContext(r.Context())
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to convert id to integer")
+		w.WriteHeader(http.StatusBadRequest)
+		return 0, false, false
+	}
+
+	role, err := res.s.GetUserRole(callerId)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user role")
+		w.WriteHeader(http.StatusInternalServerError)
+		return 0, false, false
+	}
+
+	isAdmin := role == entities.RoleAdmin
+
+	if id != callerId && !isAdmin {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return 0, false, false
+	}
+
+	return id, isAdmin, true
+}
+
+// reassignTarget picks the new author for the reassign strategy: the one
+// asked for, or else the owner of the user's company. Users can only hand
+// their articles to a member of their own company, admins to anyone.
+func (res *Resourse) reassignTarget(w http.ResponseWriter, r *http.Request, userId int, isAdmin bool) (int, bool) {
+	user, err := res.s.GetUserById(userId)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user by id")
+		w.WriteHeader(http.StatusInternalServerError)
+		return 0, false
+	}
+
+	if value := r.URL.Query().Get("reassignTo"); value != "" {
+		targetId, err := strconv.Atoi(value)
+
+		if err != nil {
+			http.Error(w, "Invalid reassignTo", http.StatusBadRequest)
+			return 0, false
+		}
+
+		target, err := res.s.GetUserById(targetId)
+
+		if err != nil {
+			if errors.Is(err, database.ErrUserNotFound) {
+				http.Error(w, "User to reassign articles to not found", http.StatusBadRequest)
+				return 0, false
+			}
+
+			log.Error().Err(err).Msg("Failed to get user by id")
+			w.WriteHeader(http.StatusInternalServerError)
+			return 0, false
+		}
+
+		if targetId == userId {
+			http.Error(w, "Articles can't be reassigned to the deleted user", http.StatusBadRequest)
+			return 0, false
+		}
+
+		if !isAdmin && (user.CompanyId == nil || target.CompanyId == nil || *target.CompanyId != *user.CompanyId) {
+			http.Error(w, "Articles can only be reassigned to a member of your company", http.StatusForbidden)
+			return 0, false
+		}
+
+		return targetId, true
+	}
+
+	if user.CompanyId == nil {
+		http.Error(w, "reassignTo is required for users without a company", http.StatusBadRequest)
+		return 0, false
+	}
+
+	ownerId, err := res.s.GetCompanyOwnerId(*user.CompanyId)
+
+	if err != nil && !errors.Is(err, database.ErrMemberNotFound) {
+		log.Error().Err(err).Msg("Failed to get company owner")
+		w.WriteHeader(http.StatusInternalServerError)
+		return 0, false
+	}
+
+	if err != nil || ownerId == userId {
+		http.Error(w, "reassignTo is required, the company has no other owner", http.StatusBadRequest)
+		return 0, false
+	}
+
+	return ownerId, true
+}
+
+// DeleteUser schedules the deletion of an account, which happens once the
+// grace period is over unless it is cancelled. The strategy parameter decides
+// what becomes of the user's articles: "delete" removes them, "reassign"
+// gives them to reassignTo or the company owner, and "anonymize" (the
+// default) credits them to a "Deleted user" placeholder. Admins can pass
+// immediate=true to skip the grace period.
+func (res *Resourse) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	id, isAdmin, ok := res.accountOwnerOrAdmin(w, r)
+
+	if !ok {
+		return
+	}
+
+	user, err := res.s.GetAdminUser(id)
+
+	if err != nil {
+		if errors.Is(err, database.ErrUserNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		log.Error().Err(err).Msg("Failed to get user")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// anonymized articles need somewhere to go
+	if user.Role == entities.RoleDeleted {
+		http.Error(w, "The placeholder account can't be deleted", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+
+	deletion := entities.AccountDeletion{
+		UserId:   id,
+		Strategy: query.Get("strategy"),
+	}
+
+	if callerId, _ := auth.UserIdFromContext(r.Context()); callerId != 0 {
+		deletion.RequestedBy = &callerId
+	}
+
+	switch deletion.Strategy {
+	case "":
+		deletion.Strategy = entities.DeletionStrategyAnonymize
+	case entities.DeletionStrategyAnonymize, entities.DeletionStrategyDelete:
+	case entities.DeletionStrategyReassign:
+		targetId, ok := res.reassignTarget(w, r, id, isAdmin)
+
+		if !ok {
+			return
+		}
+
+		deletion.ReassignTo = &targetId
+	default:
+		http.Error(w, "Invalid strategy", http.StatusBadRequest)
+		return
+	}
+
+	immediate := query.Get("immediate") == "true"
+
+	if immediate && !isAdmin {
+		http.Error(w, "Only admins can delete an account immediately", http.StatusForbidden)
+		return
+	}
+
+	delay := accounts.GracePeriod
+
+	if immediate {
+		delay = 0
+	}
+
+	deletion, err = res.s.ScheduleAccountDeletion(deletion, delay)
+
+	if err != nil {
+		if errors.Is(err, database.ErrUserNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		log.Error().Err(err).Msg("Failed to schedule account deletion")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if immediate {
+		err = res.reaper.Delete(deletion)
+
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to delete account")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	res.audit.Record(r, audit.Event{
+		Action:     audit.DeletionScheduled,
+		TargetType: audit.TargetUser,
+		TargetId:   id,
+		After:      deletion,
+	})
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(deletion)
+}
+
+func (res *Resourse) GetAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	id, _, ok := res.accountOwnerOrAdmin(w, r)
+
+	if !ok {
+		return
+	}
+
+	deletion, err := res.s.GetAccountDeletion(id)
+
+	if err != nil {
+		if errors.Is(err, database.ErrDeletionNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		log.Error().Err(err).Msg("Failed to get account deletion")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(deletion)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+func (res *Resourse) CancelAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	id, _, ok := res.accountOwnerOrAdmin(w, r)
+
+	if !ok {
+		return
+	}
+
+	err := res.s.CancelAccountDeletion(id)
+
+	if err != nil {
+		if errors.Is(err, database.ErrDeletionNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		log.Error().Err(err).Msg("Failed to cancel account deletion")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.audit.Record(r, audit.Event{
+		Action:     audit.DeletionCancelled,
+		TargetType: audit.TargetUser,
+		TargetId:   id,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
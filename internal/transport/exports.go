@@ -0,0 +1,111 @@
+package transport
+
+import (
+	"auth-service/internal/audit"
+	"auth-service/internal/auth"
+	"auth-service/internal/cors"
+	"auth-service/internal/database"
+	"auth-service/internal/entities"
+	"auth-service/internal/keys"
+	"auth-service/internal/storage"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// a download link outlives the request by this much at most, the archive
+// itself stays available until it expires
+const exportLinkTTL = 15 * time.Minute
+
+// GetDataExport reports the user's latest data export, with a download link
+// once it is ready. Without a usable export it starts a new one.
+func (res *Resourse) GetDataExport(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	userId, _ := auth.UserIdFromContext(r.Context())
+
+	export, err := res.s.GetLatestDataExport(userId)
+
+	if err != nil && !errors.Is(err, database.ErrExportNotFound) {
+		log.Error().Err(err).Msg("Failed to get data export")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case err != nil, export.Status == entities.ExportFailed, export.Status == entities.ExportExpired:
+		res.startDataExport(w, r, userId)
+		return
+	case export.Status == entities.ExportDone && export.ExpiresAt != nil && !time.Now().Before(*export.ExpiresAt):
+		// the worker hasn't swept it yet
+		res.startDataExport(w, r, userId)
+		return
+	}
+
+	status := http.StatusAccepted
+
+	if export.Status == entities.ExportDone {
+		ttl := min(exportLinkTTL, time.Until(*export.ExpiresAt))
+
+		export.DownloadUrl, err = storage.PresignS3Download(export.ObjectKey, fmt.Sprintf("data-export-%d.zip", userId), ttl, keys.EXPORT_BUCKET_NAME, keys.AWS_REGION, keys.AWS_ACCESS_KEY, keys.AWS_SECRET_KEY)
+
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to presign data export download")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		status = http.StatusOK
+	}
+
+	writeDataExport(w, status, export)
+}
+
+// RequestDataExport starts a new data export even if an earlier one can
+// still be downloaded.
+func (res *Resourse) RequestDataExport(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	userId, _ := auth.UserIdFromContext(r.Context())
+
+	res.startDataExport(w, r, userId)
+}
+
+func (res *Resourse) startDataExport(w http.ResponseWriter, r *http.Request, userId int) {
+	export, err := res.s.InsertDataExport(userId)
+
+	if err != nil {
+		if errors.Is(err, database.ErrExportInProgress) {
+			http.Error(w, "A data export is already in progress", http.StatusConflict)
+			return
+		}
+
+		log.Error().Err(err).Msg("Failed to insert data export")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.audit.Record(r, audit.Event{
+		Action:     audit.DataExportRequested,
+		TargetType: audit.TargetUser,
+		TargetId:   userId,
+		After:      map[string]any{"exportId": export.Id},
+	})
+
+	writeDataExport(w, http.StatusAccepted, export)
+}
+
+func writeDataExport(w http.ResponseWriter, status int, export entities.DataExport) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(export)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode")
+	}
+}
@@ -0,0 +1,177 @@
+package transport
+
+import (
+	"auth-service/internal/auth"
+	"auth-service/internal/cors"
+	"auth-service/internal/database"
+	"auth-service/internal/entities"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultFeedLimit = 20
+	maxFeedLimit     = 100
+)
+
+type FeedResponse struct {
+	Articles   []entities.Article `json:"articles"`
+	NextCursor string             `json:"nextCursor,omitempty"`
+}
+
+func (res *Resourse) FollowUser(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	followerId, _ := auth.UserIdFromContext(r.Context())
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to convert id to integer")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if id == followerId {
+		http.Error(w, "You can't follow yourself", http.StatusBadRequest)
+		return
+	}
+
+	err = res.s.FollowUser(followerId, id)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to follow user")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (res *Resourse) UnfollowUser(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	followerId, _ := auth.UserIdFromContext(r.Context())
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to convert id to integer")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = res.s.UnfollowUser(followerId, id)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to unfollow user")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (res *Resourse) FollowCompany(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	followerId, _ := auth.UserIdFromContext(r.Context())
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to convert id to integer")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = res.s.FollowCompany(followerId, id)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to follow company")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (res *Resourse) UnfollowCompany(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	followerId, _ := auth.UserIdFromContext(r.Context())
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to convert id to integer")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = res.s.UnfollowCompany(followerId, id)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to unfollow company")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (res *Resourse) GetFeed(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	userId, _ := auth.UserIdFromContext(r.Context())
+
+	limit := defaultFeedLimit
+
+	if limitVal := r.URL.Query().Get("limit"); limitVal != "" {
+		var err error
+
+		limit, err = strconv.Atoi(limitVal)
+
+		if err != nil || limit < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+
+		limit = min(limit, maxFeedLimit)
+	}
+
+	articles, nextCursor, err := res.s.GetFeed(userId, r.URL.Query().Get("cursor"), limit)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get feed")
+
+		if errors.Is(err, database.ErrInvalidCursor) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	articles = res.markBookmarked(r, articles)
+
+	if articles == nil {
+		articles = []entities.Article{}
+	}
+
+	err = json.NewEncoder(w).Encode(FeedResponse{
+		Articles:   articles,
+		NextCursor: nextCursor,
+	})
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,161 @@
+package transport
+
+import (
+	"auth-service/internal/auth"
+	"auth-service/internal/cors"
+	"auth-service/internal/database"
+	"auth-service/internal/keys"
+	"auth-service/internal/mail"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const magicLinkTTL = 15 * time.Minute
+
+type MagicLinkRequest struct {
+	Email string `json:"email"`
+}
+
+type ConsumeMagicLinkRequest struct {
+	Token string `json:"token"`
+}
+
+// RequestMagicLink mails a one-time login link when the address belongs to
+// an account. Like ForgotPassword it answers the same either way, and an
+// address that got too many links recently is quietly skipped.
+func (res *Resourse) RequestMagicLink(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	var reqBody MagicLinkRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	email := strings.TrimSpace(reqBody.Email)
+
+	if allowed, _ := res.limiter.Allow("magic-link-address", strings.ToLower(email)); !allowed {
+		log.Info().Str("email", email).Msg("Too many login links requested")
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	userId, err := res.s.GetUserIdByEmail(email)
+
+	if err != nil && !errors.Is(err, database.ErrUserNotFound) {
+		log.Error().Err(err).Msg("Failed to get user by email")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err == nil {
+		token, hash, err := auth.NewOpaqueToken()
+
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to create login link token")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		err = res.s.InsertMagicLinkToken(userId, email, hash, magicLinkTTL)
+
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to save login link token")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		go func() {
+			// the page posts the token to /signin/magic/consume, so mail scanners
+			// prefetching the link don't use it up
+			link := keys.FRONTEND_URL + "/signin/magic?token=" + url.QueryEscape(token)
+
+			err := res.mailer.Send(context.Background(), mail.Message{
+				To:      email,
+				Subject: "Your login link",
+				Text:    fmt.Sprintf("Open the link below to sign in:\n\n%s\n\nThe link expires in 15 minutes and works once. If you didn't ask to sign in, ignore this email.\n", link),
+			})
+
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to send login link email")
+			}
+		}()
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ConsumeMagicLink signs the user in with the token from a login link. The
+// link stands in for the password only, accounts with two-factor
+// authentication still get a challenge.
+func (res *Resourse) ConsumeMagicLink(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	var reqBody ConsumeMagicLinkRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	userId, email, err := res.s.ConsumeMagicLinkToken(auth.HashOpaqueToken(reqBody.Token))
+
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidMagicLink) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		log.Error().Err(err).Msg("Failed to consume login link")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// getting the link proves the user owns the address
+	err = res.s.MarkEmailVerified(userId, email)
+
+	if err != nil && !errors.Is(err, database.ErrUserNotFound) {
+		log.Error().Err(err).Msg("Failed to mark email verified")
+	}
+
+	user, err := res.s.GetUserById(userId)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user by id")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	twoFactor, err := res.s.IsTOTPEnabled(user.Id)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to check two-factor authentication")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if twoFactor {
+		res.writeLoginChallenge(w, user.Id)
+		return
+	}
+
+	err = res.issueAccessToken(w, r, user.Id, user.Username)
+
+	if err != nil {
+		signInFailed(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(LoginRresponse{
+		UserData: user,
+	})
+}
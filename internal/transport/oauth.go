@@ -0,0 +1,735 @@
+package transport
+
+import (
+	"auth-service/internal/audit"
+	"auth-service/internal/auth"
+	"auth-service/internal/cors"
+	"auth-service/internal/database"
+	"auth-service/internal/entities"
+	"auth-service/internal/keys"
+	"auth-service/internal/oauth"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	oauthCodeTTL         = 2 * time.Minute
+	oauthAccessTokenTTL  = time.Hour
+	oauthRefreshTokenTTL = 30 * 24 * time.Hour
+	oauthConsentTTL      = 10 * time.Minute
+)
+
+// OAuthError is the error body of RFC 6749 section 5.2.
+type OAuthError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IdToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope"`
+}
+
+type CreateOAuthClientRequest struct {
+	Name         string   `json:"name"`
+	RedirectUris []string `json:"redirectUris"`
+	Scopes       []string `json:"scopes"`
+	Public       bool     `json:"public"`
+}
+
+func writeOAuthError(w http.ResponseWriter, status int, code string, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(OAuthError{Error: code, Description: description})
+}
+
+// discovery
+
+func (res *Resourse) OpenIdConfiguration(w http.ResponseWriter, r *http.Request) {
+	issuer := keys.APP_BASE_URL
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	json.NewEncoder(w).Encode(map[string]any{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/authorize",
+		"token_endpoint":                        issuer + "/oauth/token",
+		"userinfo_endpoint":                     issuer + "/oauth/userinfo",
+		"jwks_uri":                              issuer + "/oauth/jwks",
+		"scopes_supported":                      oauth.SupportedScopes,
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", "refresh_token", "client_credentials"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported":                      []string{"sub", "email", "email_verified", "name", "preferred_username"},
+	})
+}
+
+func (res *Resourse) OAuthJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	json.NewEncoder(w).Encode(res.signer.JWKS())
+}
+
+// authorization
+
+type authorizeRequest struct {
+	client        entities.OAuthClient
+	redirectUri   string
+	scopes        []string
+	state         string
+	nonce         string
+	codeChallenge string
+}
+
+// parseAuthorizeRequest validates the authorization request. Until the client
+// and redirect URI check out errors are shown to the user, after that they are
+// sent back to the client (RFC 6749 section 4.1.2.1).
+func (res *Resourse) parseAuthorizeRequest(w http.ResponseWriter, r *http.Request) (authorizeRequest, bool) {
+	var req authorizeRequest
+
+	client, err := res.s.GetOAuthClientById(r.FormValue("client_id"))
+
+	if err != nil {
+		if errors.Is(err, database.ErrOAuthClientNotFound) {
+			http.Error(w, "Unknown client", http.StatusBadRequest)
+			return req, false
+		}
+
+		log.Error().Err(err).Msg("Failed to get oauth client")
+		w.WriteHeader(http.StatusInternalServerError)
+		return req, false
+	}
+
+	req.client = client
+	req.redirectUri = r.FormValue("redirect_uri")
+
+	if req.redirectUri == "" && len(client.RedirectUris) == 1 {
+		req.redirectUri = client.RedirectUris[0]
+	}
+
+	if !slices.Contains(client.RedirectUris, req.redirectUri) {
+		http.Error(w, "Redirect URI is not registered for this client", http.StatusBadRequest)
+		return req, false
+	}
+
+	req.state = r.FormValue("state")
+	req.nonce = r.FormValue("nonce")
+	req.codeChallenge = r.FormValue("code_challenge")
+	req.scopes = oauth.ParseScope(r.FormValue("scope"))
+
+	if r.FormValue("response_type") != "code" {
+		res.redirectOAuthError(w, r, req, "unsupported_response_type", "only the code flow is supported")
+		return req, false
+	}
+
+	if len(req.scopes) == 0 || !oauth.Subset(req.scopes, client.Scopes) {
+		res.redirectOAuthError(w, r, req, "invalid_scope", "")
+		return req, false
+	}
+
+	if req.codeChallenge == "" || r.FormValue("code_challenge_method") != "S256" {
+		res.redirectOAuthError(w, r, req, "invalid_request", "PKCE with S256 is required")
+		return req, false
+	}
+
+	return req, true
+}
+
+func (res *Resourse) redirectOAuthError(w http.ResponseWriter, r *http.Request, req authorizeRequest, code string, description string) {
+	query := url.Values{}
+	query.Set("error", code)
+
+	if description != "" {
+		query.Set("error_description", description)
+	}
+
+	res.redirectToClient(w, r, req, query)
+}
+
+func (res *Resourse) redirectToClient(w http.ResponseWriter, r *http.Request, req authorizeRequest, query url.Values) {
+	target, _ := url.Parse(req.redirectUri)
+	params := target.Query()
+
+	for name, values := range query {
+		params[name] = values
+	}
+
+	if req.state != "" {
+		params.Set("state", req.state)
+	}
+
+	params.Set("iss", keys.APP_BASE_URL)
+	target.RawQuery = params.Encode()
+
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// Authorize starts the authorization code flow. Users who already allowed the
+// client the requested scopes are sent straight back with a code, the others
+// get the consent page.
+func (res *Resourse) Authorize(w http.ResponseWriter, r *http.Request) {
+	req, ok := res.parseAuthorizeRequest(w, r)
+
+	if !ok {
+		return
+	}
+
+	claims, ok := auth.ClaimsFromContext(r.Context())
+
+	if !ok {
+		if keys.OAUTH_LOGIN_URL == "" {
+			http.Error(w, "Sign in first", http.StatusUnauthorized)
+			return
+		}
+
+		// the login page sends the user back here once they are signed in
+		http.Redirect(w, r, keys.OAUTH_LOGIN_URL+"?return_to="+url.QueryEscape(keys.APP_BASE_URL+r.URL.RequestURI()), http.StatusFound)
+		return
+	}
+
+	granted, err := res.s.HasOAuthConsent(claims.UserId, req.client.Id, req.scopes)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to check oauth consent")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if granted {
+		res.issueAuthorizationCode(w, r, req, claims.UserId)
+		return
+	}
+
+	consentToken, err := auth.CreatePurposeToken(auth.PurposeOAuthConsent, claims.UserId, "", oauthConsentTTL)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create consent token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	params := make(map[string]string)
+
+	for _, name := range []string{"client_id", "redirect_uri", "response_type", "scope", "state", "nonce", "code_challenge", "code_challenge_method"} {
+		params[name] = r.FormValue(name)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// the consent page must not be framed, or a click could be hijacked
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+
+	err = oauth.ConsentPage.Execute(w, oauth.ConsentData{
+		ClientName:   req.client.Name,
+		Username:     claims.Username,
+		Scopes:       req.scopes,
+		Descriptions: oauth.ScopeDescriptions,
+		Params:       params,
+		ConsentToken: consentToken,
+	})
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to render consent page")
+	}
+}
+
+// AuthorizeDecision handles the answer from the consent page.
+func (res *Resourse) AuthorizeDecision(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+
+	if !ok {
+		http.Error(w, "Sign in first", http.StatusUnauthorized)
+		return
+	}
+
+	// only a page we rendered for this user can carry a valid token
+	consent, err := auth.VerifyPurposeToken(r.PostFormValue("consent_token"), auth.PurposeOAuthConsent)
+
+	if err != nil || consent.UserId != claims.UserId {
+		http.Error(w, "Invalid or expired consent request", http.StatusBadRequest)
+		return
+	}
+
+	req, ok := res.parseAuthorizeRequest(w, r)
+
+	if !ok {
+		return
+	}
+
+	if r.PostFormValue("decision") != "allow" {
+		res.redirectOAuthError(w, r, req, "access_denied", "")
+		return
+	}
+
+	err = res.s.SaveOAuthConsent(claims.UserId, req.client.Id, req.scopes)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to save oauth consent")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.issueAuthorizationCode(w, r, req, claims.UserId)
+}
+
+func (res *Resourse) issueAuthorizationCode(w http.ResponseWriter, r *http.Request, req authorizeRequest, userId int) {
+	code, hash, err := auth.NewOpaqueToken()
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create authorization code")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = res.s.InsertOAuthCode(hash, entities.OAuthGrant{
+		ClientId:      req.client.Id,
+		UserId:        userId,
+		Scopes:        req.scopes,
+		RedirectUri:   req.redirectUri,
+		Nonce:         req.nonce,
+		CodeChallenge: req.codeChallenge,
+	}, oauthCodeTTL)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to save authorization code")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.redirectToClient(w, r, req, url.Values{"code": {code}})
+}
+
+// token endpoint
+
+// authenticateClient checks the client credentials from the Authorization
+// header or the form. Public clients only send their id.
+func (res *Resourse) authenticateClient(r *http.Request) (entities.OAuthClient, bool) {
+	clientId, secret, basic := r.BasicAuth()
+
+	if basic {
+		clientId, _ = url.QueryUnescape(clientId)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientId = r.PostFormValue("client_id")
+		secret = r.PostFormValue("client_secret")
+	}
+
+	client, err := res.s.GetOAuthClientById(clientId)
+
+	if err != nil {
+		if !errors.Is(err, database.ErrOAuthClientNotFound) {
+			log.Error().Err(err).Msg("Failed to get oauth client")
+		}
+
+		return entities.OAuthClient{}, false
+	}
+
+	if client.Public {
+		return client, secret == ""
+	}
+
+	if secret == "" || subtle.ConstantTimeCompare([]byte(auth.HashOpaqueToken(secret)), []byte(client.SecretHash)) != 1 {
+		return entities.OAuthClient{}, false
+	}
+
+	return client, true
+}
+
+func (res *Resourse) Token(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "")
+		return
+	}
+
+	client, ok := res.authenticateClient(r)
+
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "")
+		return
+	}
+
+	switch r.PostFormValue("grant_type") {
+	case "authorization_code":
+		grant, err := res.s.ConsumeOAuthCode(auth.HashOpaqueToken(r.PostFormValue("code")))
+
+		if err != nil {
+			if errors.Is(err, database.ErrInvalidGrant) {
+				writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "")
+				return
+			}
+
+			log.Error().Err(err).Msg("Failed to consume authorization code")
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+
+		if grant.ClientId != client.Id || grant.RedirectUri != r.PostFormValue("redirect_uri") || !oauth.VerifyPKCE(r.PostFormValue("code_verifier"), grant.CodeChallenge) {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "")
+			return
+		}
+
+		res.issueOAuthTokens(w, client, grant)
+	case "refresh_token":
+		grant, err := res.s.RotateOAuthRefreshToken(auth.HashOpaqueToken(r.PostFormValue("refresh_token")))
+
+		if err != nil {
+			if errors.Is(err, database.ErrInvalidGrant) {
+				writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "")
+				return
+			}
+
+			log.Error().Err(err).Msg("Failed to rotate refresh token")
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+
+		if grant.ClientId != client.Id {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "")
+			return
+		}
+
+		// a refresh may narrow the scopes, never widen them
+		if scopes := oauth.ParseScope(r.PostFormValue("scope")); len(scopes) > 0 {
+			if !oauth.Subset(scopes, grant.Scopes) {
+				writeOAuthError(w, http.StatusBadRequest, "invalid_scope", "")
+				return
+			}
+
+			grant.Scopes = scopes
+		}
+
+		res.issueOAuthTokens(w, client, grant)
+	case "client_credentials":
+		if client.Public {
+			writeOAuthError(w, http.StatusBadRequest, "unauthorized_client", "public clients can't use client_credentials")
+			return
+		}
+
+		scopes := oauth.ParseScope(r.PostFormValue("scope"))
+
+		if len(scopes) == 0 {
+			scopes = client.Scopes
+		}
+
+		if !oauth.Subset(scopes, client.Scopes) || slices.Contains(scopes, oauth.ScopeOpenId) {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_scope", "")
+			return
+		}
+
+		res.issueOAuthTokens(w, client, entities.OAuthGrant{ClientId: client.Id, Scopes: scopes})
+	default:
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+	}
+}
+
+// issueOAuthTokens answers the token request. Grants on behalf of a user also
+// get a refresh token, and an ID token when openid was asked for.
+func (res *Resourse) issueOAuthTokens(w http.ResponseWriter, client entities.OAuthClient, grant entities.OAuthGrant) {
+	now := time.Now()
+	issuer := keys.APP_BASE_URL
+
+	subject := client.Id
+
+	if grant.UserId != 0 {
+		subject = strconv.Itoa(grant.UserId)
+	}
+
+	accessToken, err := res.signer.Sign(oauth.AccessTokenClaims{
+		Scope:    strings.Join(grant.Scopes, " "),
+		ClientId: client.Id,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   subject,
+			Audience:  jwt.ClaimStrings{client.Id},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(oauthAccessTokenTTL)),
+		},
+	})
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to sign access token")
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	response := OAuthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(oauthAccessTokenTTL.Seconds()),
+		Scope:       strings.Join(grant.Scopes, " "),
+	}
+
+	if grant.UserId != 0 {
+		refreshToken, hash, err := auth.NewOpaqueToken()
+
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to create refresh token")
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+
+		err = res.s.InsertOAuthRefreshToken(hash, grant, oauthRefreshTokenTTL)
+
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to save refresh token")
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+
+		response.RefreshToken = refreshToken
+	}
+
+	if grant.UserId != 0 && slices.Contains(grant.Scopes, oauth.ScopeOpenId) {
+		user, err := res.s.GetUserById(grant.UserId)
+
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to get user by id")
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+
+		idClaims := userClaims(user, grant.Scopes)
+		idClaims.Nonce = grant.Nonce
+		idClaims.RegisteredClaims = jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   subject,
+			Audience:  jwt.ClaimStrings{client.Id},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(oauthAccessTokenTTL)),
+		}
+
+		response.IdToken, err = res.signer.Sign(idClaims)
+
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to sign id token")
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// userClaims picks the user's claims the scopes allow.
+func userClaims(user entities.User, scopes []string) oauth.IdTokenClaims {
+	var claims oauth.IdTokenClaims
+
+	if slices.Contains(scopes, oauth.ScopeEmail) {
+		claims.Email = user.Email
+		claims.EmailVerified = &user.EmailVerified
+	}
+
+	if slices.Contains(scopes, oauth.ScopeProfile) {
+		claims.Name = user.Fullname
+		claims.PreferredUsername = user.Username
+	}
+
+	return claims
+}
+
+func (res *Resourse) UserInfo(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	raw, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := res.signer.VerifyAccessToken(raw, keys.APP_BASE_URL)
+
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	scopes := oauth.ParseScope(claims.Scope)
+	userId, err := strconv.Atoi(claims.Subject)
+
+	if err != nil || !slices.Contains(scopes, oauth.ScopeOpenId) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	user, err := res.s.GetUserById(userId)
+
+	if err != nil {
+		if errors.Is(err, database.ErrUserNotFound) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		log.Error().Err(err).Msg("Failed to get user by id")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	info := userClaims(user, scopes)
+	info.Subject = claims.Subject
+
+	json.NewEncoder(w).Encode(info)
+}
+
+// client registration
+
+func (res *Resourse) CreateOAuthClient(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	var reqBody CreateOAuthClientRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	reqBody.Name = strings.TrimSpace(reqBody.Name)
+
+	if reqBody.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+
+	if len(reqBody.RedirectUris) == 0 {
+		http.Error(w, "At least one redirect URI is required", http.StatusBadRequest)
+		return
+	}
+
+	for _, uri := range reqBody.RedirectUris {
+		target, err := url.Parse(uri)
+
+		if err != nil || target.Host == "" || target.Fragment != "" || (target.Scheme != "https" && !(target.Scheme == "http" && target.Hostname() == "localhost")) {
+			http.Error(w, "Invalid redirect URI: "+uri, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if len(reqBody.Scopes) == 0 {
+		reqBody.Scopes = oauth.SupportedScopes
+	}
+
+	if !oauth.Subset(reqBody.Scopes, oauth.SupportedScopes) {
+		http.Error(w, "Unsupported scope", http.StatusBadRequest)
+		return
+	}
+
+	bytes := make([]byte, 16)
+
+	_, err := rand.Read(bytes)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to read bytes")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	client := entities.OAuthClient{
+		Id:           hex.EncodeToString(bytes),
+		Name:         reqBody.Name,
+		RedirectUris: reqBody.RedirectUris,
+		Scopes:       reqBody.Scopes,
+		Public:       reqBody.Public,
+	}
+
+	if !client.Public {
+		client.Secret, client.SecretHash, err = auth.NewOpaqueToken()
+
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to create client secret")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	err = res.s.InsertOAuthClient(client)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create oauth client")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	res.audit.Record(r, audit.Event{
+		Action:     audit.OAuthClientCreated,
+		TargetType: audit.TargetOAuthClient,
+		TargetId:   client.Id,
+		After:      map[string]any{"name": client.Name, "redirectUris": client.RedirectUris, "scopes": client.Scopes, "public": client.Public},
+	})
+
+	// the secret is only ever shown in this response
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(client)
+}
+
+func (res *Resourse) GetOAuthClients(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	clients, err := res.s.GetOAuthClients()
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get oauth clients")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(clients)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+func (res *Resourse) DeleteOAuthClient(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	err := res.s.DeleteOAuthClient(r.PathValue("id"))
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to delete oauth client")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.audit.Record(r, audit.Event{
+		Action:     audit.OAuthClientDeleted,
+		TargetType: audit.TargetOAuthClient,
+		TargetId:   r.PathValue("id"),
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,287 @@
+package transport
+
+import (
+	"auth-service/internal/cors"
+	"auth-service/internal/database"
+	"auth-service/internal/entities"
+	"auth-service/internal/keys"
+	"auth-service/internal/oidc"
+	"auth-service/pkg/cookie"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	oidcStateCookie = "oidcState"
+	oidcStateTTL    = 10 * time.Minute
+)
+
+var errCannotLink = errors.New("an account with this email already exists, sign in with your password and verify your email to link it")
+
+// OIDCLogin sends the user to the identity provider. The state is kept in the
+// database and in a cookie, so the callback only completes in this browser.
+func (res *Resourse) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	provider, ok := res.providers[r.PathValue("provider")]
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var values [3]string
+
+	for i := range values {
+		value, err := oidc.RandomString()
+
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to create login state")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		values[i] = value
+	}
+
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	err := res.s.InsertOIDCLoginState(state, provider.Name(), nonce, verifier, oidcStateTTL)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to save login state")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = cookie.Write(w, http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/oidc/",
+		MaxAge:   int(oidcStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   res.cookies.Secure,
+		// Lax, so the cookie comes along on the provider's redirect back
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	if err != nil {
+		http.Error(w, "Failed to write cookie", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, provider.AuthCodeURL(state, nonce, oidc.CodeChallenge(verifier)), http.StatusFound)
+}
+
+// OIDCCallback completes a sign in with the identity provider. The browser
+// arrives here on a top-level redirect, so it is sent on to the frontend
+// signed in, or with a 2FA challenge in the URL fragment.
+func (res *Resourse) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	provider, ok := res.providers[r.PathValue("provider")]
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+
+	if query.Get("error") != "" {
+		http.Error(w, "Sign in was cancelled or denied: "+query.Get("error"), http.StatusBadRequest)
+		return
+	}
+
+	state := query.Get("state")
+
+	expected, err := cookie.Read(r, oidcStateCookie)
+
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(expected)) != 1 {
+		http.Error(w, "Invalid login state", http.StatusBadRequest)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/oidc/", MaxAge: -1})
+
+	nonce, verifier, err := res.s.ConsumeOIDCLoginState(state, provider.Name())
+
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidLoginState) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		log.Error().Err(err).Msg("Failed to consume login state")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	claims, err := provider.Exchange(r.Context(), query.Get("code"), verifier, nonce)
+
+	if err != nil {
+		log.Error().Err(err).Str("provider", provider.Name()).Msg("Failed to complete sign in")
+		http.Error(w, "Sign in with the provider failed", http.StatusUnauthorized)
+		return
+	}
+
+	userId, err := resolveExternalUser(res.s, provider.Name(), claims)
+
+	if err != nil {
+		if errors.Is(err, errCannotLink) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		log.Error().Err(err).Msg("Failed to resolve external user")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	user, err := res.s.GetUserById(userId)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user by id")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	twoFactor, err := res.s.IsTOTPEnabled(user.Id)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to check two-factor authentication")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if twoFactor {
+		challenge, err := res.loginChallenge(user.Id)
+
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to create login challenge")
+			http.Error(w, "Problem with generating a token", http.StatusInternalServerError)
+			return
+		}
+
+		// in the fragment, so it stays out of server logs and Referer headers
+		http.Redirect(w, r, keys.FRONTEND_URL+"/signin/two-factor#challenge="+url.QueryEscape(challenge), http.StatusFound)
+		return
+	}
+
+	err = res.issueAccessToken(w, r, user.Id, user.Username)
+
+	if err != nil {
+		signInFailed(w, err)
+		return
+	}
+
+	http.Redirect(w, r, keys.FRONTEND_URL+"/", http.StatusFound)
+}
+
+// externalUserStore is the part of the storage resolveExternalUser works with.
+type externalUserStore interface {
+	GetUserIdByIdentity(provider string, subject string) (int, error)
+	GetUserIdByEmail(email string) (int, error)
+	IsEmailVerified(userId int) (bool, error)
+	LinkIdentity(userId int, provider string, subject string, email string) error
+	InsertExternalUser(user entities.User, provider string, subject string) (int, error)
+}
+
+// resolveExternalUser finds the user behind an identity from the provider.
+// Unknown identities are linked to the account with the same email when both
+// sides verified the address, otherwise a new passwordless user is created.
+func resolveExternalUser(s externalUserStore, provider string, claims *oidc.IdTokenClaims) (int, error) {
+	userId, err := s.GetUserIdByIdentity(provider, claims.Subject)
+
+	if err == nil || !errors.Is(err, database.ErrUserNotFound) {
+		return userId, err
+	}
+
+	if claims.Email == "" {
+		return 0, fmt.Errorf("provider did not share an email address")
+	}
+
+	userId, err = s.GetUserIdByEmail(claims.Email)
+
+	if err != nil && !errors.Is(err, database.ErrUserNotFound) {
+		return 0, err
+	}
+
+	if err == nil {
+		// an unverified address on either side could belong to someone else
+		if !claims.EmailVerified {
+			return 0, errCannotLink
+		}
+
+		verified, err := s.IsEmailVerified(userId)
+
+		if err != nil {
+			return 0, err
+		}
+
+		if !verified {
+			return 0, errCannotLink
+		}
+
+		return userId, s.LinkIdentity(userId, provider, claims.Subject, claims.Email)
+	}
+
+	user := entities.User{
+		Email:         claims.Email,
+		Fullname:      claims.Name,
+		EmailVerified: bool(claims.EmailVerified),
+	}
+
+	base := usernameFromClaims(claims)
+
+	for attempt := 0; attempt < 5; attempt++ {
+		user.Username = base
+
+		if attempt > 0 {
+			suffix, err := rand.Int(rand.Reader, big.NewInt(10000))
+
+			if err != nil {
+				return 0, err
+			}
+
+			user.Username = fmt.Sprintf("%s-%04d", base, suffix)
+		}
+
+		userId, err = s.InsertExternalUser(user, provider, claims.Subject)
+
+		if !errors.Is(err, database.ErrUsernameExists) {
+			return userId, err
+		}
+	}
+
+	return 0, fmt.Errorf("no free username for %q", base)
+}
+
+func usernameFromClaims(claims *oidc.IdTokenClaims) string {
+	name := claims.PreferredUsername
+
+	if name == "" {
+		name, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	var b strings.Builder
+
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' || r == '-' || r == '.' {
+			b.WriteRune(r)
+		}
+	}
+
+	if b.Len() == 0 {
+		return "user"
+	}
+
+	return b.String()
+}
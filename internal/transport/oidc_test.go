@@ -0,0 +1,229 @@
+package transport
+
+import (
+	"auth-service/internal/database"
+	"auth-service/internal/entities"
+	"auth-service/internal/oidc"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakeIdentity struct {
+	provider string
+	subject  string
+}
+
+// fakeUserStore keeps users and linked identities in memory.
+type fakeUserStore struct {
+	emails     map[string]int
+	verified   map[int]bool
+	usernames  map[string]bool
+	identities map[fakeIdentity]int
+	nextId     int
+}
+
+func newFakeUserStore() *fakeUserStore {
+	return &fakeUserStore{
+		emails:     map[string]int{},
+		verified:   map[int]bool{},
+		usernames:  map[string]bool{},
+		identities: map[fakeIdentity]int{},
+		nextId:     1,
+	}
+}
+
+func (s *fakeUserStore) addUser(email, username string, verified bool) int {
+	id := s.nextId
+	s.nextId++
+
+	s.emails[email] = id
+	s.usernames[username] = true
+	s.verified[id] = verified
+
+	return id
+}
+
+func (s *fakeUserStore) GetUserIdByIdentity(provider string, subject string) (int, error) {
+	if id, ok := s.identities[fakeIdentity{provider, subject}]; ok {
+		return id, nil
+	}
+
+	return 0, database.ErrUserNotFound
+}
+
+func (s *fakeUserStore) GetUserIdByEmail(email string) (int, error) {
+	if id, ok := s.emails[email]; ok {
+		return id, nil
+	}
+
+	return 0, database.ErrUserNotFound
+}
+
+func (s *fakeUserStore) IsEmailVerified(userId int) (bool, error) {
+	return s.verified[userId], nil
+}
+
+func (s *fakeUserStore) LinkIdentity(userId int, provider string, subject string, email string) error {
+	s.identities[fakeIdentity{provider, subject}] = userId
+	return nil
+}
+
+func (s *fakeUserStore) InsertExternalUser(user entities.User, provider string, subject string) (int, error) {
+	if s.usernames[user.Username] {
+		return 0, database.ErrUsernameExists
+	}
+
+	id := s.addUser(user.Email, user.Username, user.EmailVerified)
+	s.identities[fakeIdentity{provider, subject}] = id
+
+	return id, nil
+}
+
+func claimsFor(subject, email string, verified bool) *oidc.IdTokenClaims {
+	claims := &oidc.IdTokenClaims{Email: email, Name: "Ada"}
+	claims.Subject = subject
+
+	// EmailVerified has an unexported type, so it is set the way a provider would
+	data, _ := json.Marshal(map[string]bool{"email_verified": verified})
+	json.Unmarshal(data, claims)
+
+	return claims
+}
+
+func TestResolveExternalUserKnownIdentity(t *testing.T) {
+	store := newFakeUserStore()
+	id := store.addUser("ada@example.com", "ada", false)
+	store.identities[fakeIdentity{"fake", "subject-1"}] = id
+
+	got, err := resolveExternalUser(store, "fake", claimsFor("subject-1", "other@example.com", false))
+
+	if err != nil || got != id {
+		t.Fatalf("resolved to %d (%v), want the linked user %d", got, err, id)
+	}
+}
+
+func TestResolveExternalUserLinksVerifiedEmail(t *testing.T) {
+	store := newFakeUserStore()
+	id := store.addUser("ada@example.com", "ada", true)
+
+	got, err := resolveExternalUser(store, "fake", claimsFor("subject-1", "ada@example.com", true))
+
+	if err != nil || got != id {
+		t.Fatalf("resolved to %d (%v), want the existing user %d", got, err, id)
+	}
+
+	if store.identities[fakeIdentity{"fake", "subject-1"}] != id {
+		t.Fatal("identity was not linked")
+	}
+}
+
+func TestResolveExternalUserRefusesUnverifiedEmail(t *testing.T) {
+	tests := map[string]struct {
+		localVerified, providerVerified bool
+	}{
+		"unverified at the provider": {localVerified: true, providerVerified: false},
+		"unverified locally":         {localVerified: false, providerVerified: true},
+	}
+
+	for name, tt := range tests {
+		store := newFakeUserStore()
+		store.addUser("ada@example.com", "ada", tt.localVerified)
+
+		_, err := resolveExternalUser(store, "fake", claimsFor("subject-1", "ada@example.com", tt.providerVerified))
+
+		if !errors.Is(err, errCannotLink) {
+			t.Errorf("%s: got %v, want errCannotLink", name, err)
+		}
+
+		if len(store.identities) != 0 {
+			t.Errorf("%s: identity was linked", name)
+		}
+	}
+}
+
+func TestResolveExternalUserCreatesUser(t *testing.T) {
+	store := newFakeUserStore()
+	store.addUser("someone@example.com", "ada", true)
+
+	id, err := resolveExternalUser(store, "fake", claimsFor("subject-1", "Ada@example.com", true))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if store.identities[fakeIdentity{"fake", "subject-1"}] != id || !store.verified[id] {
+		t.Fatal("new user was not linked or lost the verified address")
+	}
+
+	// "ada" is taken, so the new user gets a suffixed name
+	if len(store.usernames) != 2 || store.usernames["ada"] == false {
+		t.Fatalf("unexpected usernames %v", store.usernames)
+	}
+}
+
+func TestResolveExternalUserNeedsEmail(t *testing.T) {
+	if _, err := resolveExternalUser(newFakeUserStore(), "fake", claimsFor("subject-1", "", true)); err == nil {
+		t.Fatal("user created without an email address")
+	}
+}
+
+// newCallbackResourse has a provider discovered from a stub issuer. The
+// callback requests below fail before the storage is used.
+func newCallbackResourse(t *testing.T) *Resourse {
+	t.Helper()
+
+	var server *httptest.Server
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidc.Metadata{
+			Issuer:                server.URL,
+			AuthorizationEndpoint: server.URL + "/authorize",
+			TokenEndpoint:         server.URL + "/token",
+			JWKSURI:               server.URL + "/jwks",
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	provider, err := oidc.Discover(context.Background(), oidc.Config{Name: "fake", Issuer: server.URL, ClientID: "client-1"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Resourse{providers: map[string]*oidc.Provider{"fake": provider}}
+}
+
+func TestOIDCCallbackChecksState(t *testing.T) {
+	res := newCallbackResourse(t)
+
+	tests := map[string]struct {
+		query  string
+		cookie string
+	}{
+		"no cookie":      {query: "?code=c&state=abc"},
+		"other state":    {query: "?code=c&state=abc", cookie: "xyz"},
+		"no state":       {query: "?code=c", cookie: "abc"},
+		"provider error": {query: "?error=access_denied&state=abc", cookie: "abc"},
+	}
+
+	for name, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/oidc/fake/callback"+tt.query, nil)
+		r.SetPathValue("provider", "fake")
+
+		if tt.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: base64.URLEncoding.EncodeToString([]byte(tt.cookie))})
+		}
+
+		w := httptest.NewRecorder()
+		res.OIDCCallback(w, r)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", name, w.Code)
+		}
+	}
+}
@@ -0,0 +1,453 @@
+package transport
+
+import (
+	"auth-service/internal/auth"
+	"auth-service/internal/cors"
+	"auth-service/internal/database"
+	"auth-service/internal/entities"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	webauthnChallengeTTL = 5 * time.Minute
+	webauthnTimeout      = webauthnChallengeTTL / time.Millisecond
+)
+
+// the options follow the WebAuthn JSON types, so the browser side can pass
+// them to navigator.credentials after decoding the binary fields
+
+type PublicKeyCredentialParameters struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type PublicKeyCredentialDescriptor struct {
+	Type string         `json:"type"`
+	Id   auth.Base64URL `json:"id"`
+}
+
+type RelyingParty struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type WebAuthnUser struct {
+	Id          auth.Base64URL `json:"id"`
+	Name        string         `json:"name"`
+	DisplayName string         `json:"displayName"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+type CreationOptions struct {
+	Challenge              string                          `json:"challenge"`
+	RP                     RelyingParty                    `json:"rp"`
+	User                   WebAuthnUser                    `json:"user"`
+	PubKeyCredParams       []PublicKeyCredentialParameters `json:"pubKeyCredParams"`
+	Timeout                int64                           `json:"timeout"`
+	ExcludeCredentials     []PublicKeyCredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection          `json:"authenticatorSelection"`
+	Attestation            string                          `json:"attestation"`
+}
+
+type RequestOptions struct {
+	Challenge        string `json:"challenge"`
+	RPID             string `json:"rpId"`
+	Timeout          int64  `json:"timeout"`
+	UserVerification string `json:"userVerification"`
+}
+
+type RegisterPasskeyRequest struct {
+	Name       string `json:"name"`
+	Credential struct {
+		RawId    auth.Base64URL `json:"rawId"`
+		Response struct {
+			ClientDataJSON    auth.Base64URL `json:"clientDataJSON"`
+			AttestationObject auth.Base64URL `json:"attestationObject"`
+		} `json:"response"`
+	} `json:"credential"`
+}
+
+type PasskeyLoginRequest struct {
+	RawId    auth.Base64URL `json:"rawId"`
+	Response struct {
+		ClientDataJSON    auth.Base64URL `json:"clientDataJSON"`
+		AuthenticatorData auth.Base64URL `json:"authenticatorData"`
+		Signature         auth.Base64URL `json:"signature"`
+		UserHandle        auth.Base64URL `json:"userHandle"`
+	} `json:"response"`
+}
+
+type RenamePasskeyRequest struct {
+	Name string `json:"name"`
+}
+
+// PasskeyRegistrationOptions starts the registration ceremony for the caller.
+func (res *Resourse) PasskeyRegistrationOptions(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	userId, _ := auth.UserIdFromContext(r.Context())
+
+	user, err := res.s.GetUserById(userId)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user by id")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	passkeys, err := res.s.GetPasskeys(userId)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get passkeys")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	challenge, err := auth.NewWebAuthnChallenge()
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create challenge")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = res.s.InsertWebAuthnChallenge(challenge, auth.WebAuthnCreate, userId, webauthnChallengeTTL)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to save challenge")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	options := CreationOptions{
+		Challenge: challenge,
+		RP:        RelyingParty{Id: res.webauthn.RPID, Name: res.webauthn.RPName},
+		User: WebAuthnUser{
+			Id:          auth.WebAuthnUserHandle(user.Id),
+			Name:        user.Username,
+			DisplayName: user.Fullname,
+		},
+		Timeout:            int64(webauthnTimeout),
+		ExcludeCredentials: []PublicKeyCredentialDescriptor{},
+		// discoverable, so the passkey can sign in without a username
+		AuthenticatorSelection: AuthenticatorSelection{ResidentKey: "required", UserVerification: "required"},
+		Attestation:            "none",
+	}
+
+	for _, alg := range auth.WebAuthnAlgorithms {
+		options.PubKeyCredParams = append(options.PubKeyCredParams, PublicKeyCredentialParameters{Type: "public-key", Alg: alg})
+	}
+
+	// the same authenticator can't be registered twice
+	for _, passkey := range passkeys {
+		options.ExcludeCredentials = append(options.ExcludeCredentials, PublicKeyCredentialDescriptor{Type: "public-key", Id: passkey.CredentialId})
+	}
+
+	json.NewEncoder(w).Encode(options)
+}
+
+// RegisterPasskey finishes the registration ceremony and stores the passkey.
+func (res *Resourse) RegisterPasskey(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	userId, _ := auth.UserIdFromContext(r.Context())
+
+	var reqBody RegisterPasskeyRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	clientDataJSON := reqBody.Credential.Response.ClientDataJSON
+
+	challenge, err := auth.ClientDataChallenge(clientDataJSON)
+
+	if err != nil {
+		http.Error(w, "Invalid credential", http.StatusBadRequest)
+		return
+	}
+
+	challengeUserId, err := res.s.ConsumeWebAuthnChallenge(challenge, auth.WebAuthnCreate)
+
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidChallenge) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		log.Error().Err(err).Msg("Failed to consume challenge")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if challengeUserId != userId {
+		http.Error(w, database.ErrInvalidChallenge.Error(), http.StatusBadRequest)
+		return
+	}
+
+	credential, err := res.webauthn.VerifyRegistration(clientDataJSON, reqBody.Credential.Response.AttestationObject, challenge)
+
+	if err != nil {
+		log.Info().Err(err).Msg("Invalid passkey registration")
+		http.Error(w, "Invalid credential", http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimSpace(reqBody.Name)
+
+	if name == "" {
+		name = "Passkey"
+	}
+
+	passkey := entities.Passkey{
+		UserId:       userId,
+		Name:         name,
+		CredentialId: credential.Id,
+		PublicKey:    credential.PublicKey,
+		SignCount:    credential.SignCount,
+		CreatedAt:    time.Now(),
+	}
+
+	passkey.Id, err = res.s.InsertPasskey(passkey)
+
+	if err != nil {
+		if errors.Is(err, database.ErrPasskeyExists) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		log.Error().Err(err).Msg("Failed to save passkey")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(passkey)
+}
+
+func (res *Resourse) GetPasskeys(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	userId, _ := auth.UserIdFromContext(r.Context())
+
+	passkeys, err := res.s.GetPasskeys(userId)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get passkeys")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(passkeys)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+func (res *Resourse) RenamePasskey(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	userId, _ := auth.UserIdFromContext(r.Context())
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to convert id to integer")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var reqBody RenamePasskeyRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimSpace(reqBody.Name)
+
+	if name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+
+	err = res.s.RenamePasskey(userId, id, name)
+
+	if err != nil {
+		if errors.Is(err, database.ErrPasskeyNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		log.Error().Err(err).Msg("Failed to rename passkey")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (res *Resourse) DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	userId, _ := auth.UserIdFromContext(r.Context())
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to convert id to integer")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = res.s.DeletePasskey(userId, id)
+
+	if err != nil {
+		if errors.Is(err, database.ErrPasskeyNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		log.Error().Err(err).Msg("Failed to delete passkey")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PasskeyLoginOptions starts a login ceremony. No credentials are listed,
+// the browser offers the passkeys it has for the site.
+func (res *Resourse) PasskeyLoginOptions(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	challenge, err := auth.NewWebAuthnChallenge()
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create challenge")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = res.s.InsertWebAuthnChallenge(challenge, auth.WebAuthnGet, 0, webauthnChallengeTTL)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to save challenge")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(RequestOptions{
+		Challenge:        challenge,
+		RPID:             res.webauthn.RPID,
+		Timeout:          int64(webauthnTimeout),
+		UserVerification: "required",
+	})
+}
+
+// PasskeyLogin signs the user in with a passkey. The authenticator verified
+// the user itself, so no second factor is asked for.
+func (res *Resourse) PasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	var reqBody PasskeyLoginRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	challenge, err := auth.ClientDataChallenge(reqBody.Response.ClientDataJSON)
+
+	if err != nil {
+		http.Error(w, "Invalid credential", http.StatusBadRequest)
+		return
+	}
+
+	_, err = res.s.ConsumeWebAuthnChallenge(challenge, auth.WebAuthnGet)
+
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidChallenge) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		log.Error().Err(err).Msg("Failed to consume challenge")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	passkey, err := res.s.GetPasskeyByCredentialId(reqBody.RawId)
+
+	if err != nil {
+		if errors.Is(err, database.ErrPasskeyNotFound) {
+			http.Error(w, "Unknown passkey", http.StatusUnauthorized)
+			return
+		}
+
+		log.Error().Err(err).Msg("Failed to get passkey")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if reqBody.Response.UserHandle != nil && string(reqBody.Response.UserHandle) != string(auth.WebAuthnUserHandle(passkey.UserId)) {
+		http.Error(w, "Unknown passkey", http.StatusUnauthorized)
+		return
+	}
+
+	signCount, err := res.webauthn.VerifyAssertion(passkey.PublicKey, passkey.SignCount, reqBody.Response.ClientDataJSON, reqBody.Response.AuthenticatorData, reqBody.Response.Signature, challenge)
+
+	if err != nil {
+		log.Info().Err(err).Int("passkey", passkey.Id).Msg("Failed passkey login")
+		http.Error(w, "Invalid passkey", http.StatusUnauthorized)
+		return
+	}
+
+	used, err := res.s.UsePasskey(passkey.Id, signCount)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to record passkey use")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !used {
+		log.Info().Int("passkey", passkey.Id).Msg("Passkey signature counter replayed")
+		http.Error(w, "Invalid passkey", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := res.s.GetUserById(passkey.UserId)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user by id")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = res.issueAccessToken(w, r, user.Id, user.Username)
+
+	if err != nil {
+		signInFailed(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(LoginRresponse{
+		UserData: user,
+	})
+}
@@ -0,0 +1,278 @@
+package transport
+
+import (
+	"auth-service/internal/audit"
+	"auth-service/internal/auth"
+	"auth-service/internal/cors"
+	"auth-service/internal/database"
+	"auth-service/internal/keys"
+	"auth-service/internal/mail"
+	"auth-service/internal/passwordpolicy"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const passwordResetTokenTTL = time.Hour
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+type PasswordPolicyResponse struct {
+	Error   string                  `json:"error"`
+	Reasons []passwordpolicy.Reason `json:"reasons"`
+}
+
+// checkPasswordPolicy answers 400 with the reasons, in the caller's language,
+// when the password can't be used. It reports whether the password passed.
+func (res *Resourse) checkPasswordPolicy(w http.ResponseWriter, r *http.Request, password string, username string, email string) bool {
+	violations := passwordpolicy.Default.Check(password, username, email)
+
+	if len(violations) == 0 {
+		return true
+	}
+
+	language := passwordpolicy.Language(r.Header.Get("Accept-Language"))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Language", language)
+	w.WriteHeader(http.StatusBadRequest)
+
+	json.NewEncoder(w).Encode(PasswordPolicyResponse{
+		Error:   passwordpolicy.Message(language),
+		Reasons: passwordpolicy.Localize(violations, language),
+	})
+
+	return false
+}
+
+// ForgotPassword mails a reset link when the address belongs to an account.
+// The answer is the same either way, so it can't be used to probe for users.
+func (res *Resourse) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	var reqBody ForgotPasswordRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	email := strings.TrimSpace(reqBody.Email)
+
+	userId, err := res.s.GetUserIdByEmail(email)
+
+	if err != nil && !errors.Is(err, database.ErrUserNotFound) {
+		log.Error().Err(err).Msg("Failed to get user by email")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err == nil {
+		token, hash, err := auth.NewOpaqueToken()
+
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to create reset token")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		err = res.s.InsertPasswordResetToken(userId, hash, passwordResetTokenTTL)
+
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to save reset token")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		// sending in the background keeps the response time the same for unknown addresses
+		go func() {
+			// the page asks for the new password and posts it to /password/reset
+			link := keys.FRONTEND_URL + "/password/reset?token=" + url.QueryEscape(token)
+
+			err := res.mailer.Send(context.Background(), mail.Message{
+				To:      email,
+				Subject: "Reset your password",
+				Text:    fmt.Sprintf("Open the link below to choose a new password:\n\n%s\n\nThe link expires in 1 hour and works once. If you didn't ask for a reset, ignore this email.\n", link),
+			})
+
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to send password reset email")
+			}
+		}()
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (res *Resourse) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	var reqBody ResetPasswordRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if reqBody.Password == "" {
+		http.Error(w, "Password is required", http.StatusBadRequest)
+		return
+	}
+
+	tokenHash := auth.HashOpaqueToken(reqBody.Token)
+
+	// the policy needs to know whose password it is before the token is spent
+	userId, err := res.s.GetPasswordResetUserId(tokenHash)
+
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidResetToken) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		log.Error().Err(err).Msg("Failed to get password reset token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	user, err := res.s.GetUserById(userId)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user by id")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !res.checkPasswordPolicy(w, r, reqBody.Password, user.Username, user.Email) {
+		return
+	}
+
+	password, err := auth.HashPassword(reqBody.Password)
+
+	if errors.Is(err, auth.ErrPasswordTooLong) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to hash user password")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	_, err = res.s.ResetPassword(tokenHash, password)
+
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidResetToken) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		log.Error().Err(err).Msg("Failed to reset password")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.audit.Record(r, audit.Event{
+		ActorId:    userId,
+		Action:     audit.PasswordReset,
+		TargetType: audit.TargetUser,
+		TargetId:   userId,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ChangePassword sets a new password for the caller. Other sessions, personal
+// access tokens and OAuth clients are signed out, the caller's own session
+// stays.
+func (res *Resourse) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	claims, _ := auth.ClaimsFromContext(r.Context())
+
+	var reqBody ChangePasswordRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if reqBody.NewPassword == "" {
+		http.Error(w, "Password is required", http.StatusBadRequest)
+		return
+	}
+
+	valid, err := res.checkPassword(claims.UserId, reqBody.CurrentPassword)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to check password")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !valid {
+		http.Error(w, "Current password is incorrect", http.StatusForbidden)
+		return
+	}
+
+	user, err := res.s.GetUserById(claims.UserId)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user by id")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !res.checkPasswordPolicy(w, r, reqBody.NewPassword, user.Username, user.Email) {
+		return
+	}
+
+	password, err := auth.HashPassword(reqBody.NewPassword)
+
+	if errors.Is(err, auth.ErrPasswordTooLong) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to hash user password")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = res.s.UpdatePassword(claims.UserId, password, claims.SessionId)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to update password")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.audit.Record(r, audit.Event{
+		Action:     audit.PasswordChanged,
+		TargetType: audit.TargetUser,
+		TargetId:   claims.UserId,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,87 @@
+package transport
+
+import (
+	"auth-service/internal/auth"
+	"auth-service/internal/cors"
+	"auth-service/internal/database"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+)
+
+// GetSessions lists the devices the caller is signed in on.
+func (res *Resourse) GetSessions(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	claims, _ := auth.ClaimsFromContext(r.Context())
+
+	sessions, err := res.s.GetSessions(claims.UserId)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get sessions")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].Id == claims.SessionId
+	}
+
+	err = json.NewEncoder(w).Encode(sessions)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+func (res *Resourse) DeleteSession(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	claims, _ := auth.ClaimsFromContext(r.Context())
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to convert id to integer")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = res.s.DeleteSession(claims.UserId, id)
+
+	if err != nil {
+		if errors.Is(err, database.ErrSessionNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		log.Error().Err(err).Msg("Failed to delete session")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteOtherSessions signs the caller out everywhere but the current device,
+// including the OAuth clients they authorized.
+func (res *Resourse) DeleteOtherSessions(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	claims, _ := auth.ClaimsFromContext(r.Context())
+
+	err := res.s.DeleteOtherSessions(claims.UserId, claims.SessionId)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to delete sessions")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,70 @@
+package transport
+
+import (
+	"auth-service/internal/cors"
+	"auth-service/internal/entities"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// parseTags splits the comma separated "tags" form field into tags.
+func parseTags(value string) []entities.Tag {
+	var tags []entities.Tag
+
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+
+		if name != "" {
+			tags = append(tags, entities.Tag{Name: name})
+		}
+	}
+
+	return tags
+}
+
+func (res *Resourse) GetTags(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	tags, err := res.s.GetTags()
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get tags")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(tags)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+func (res *Resourse) GetArticlesByTag(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	slug := r.PathValue("slug")
+
+	articles, err := res.s.GetArticlesByTag(slug)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get articles by tag")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	articles = res.markBookmarked(r, articles)
+
+	err = json.NewEncoder(w).Encode(articles)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,150 @@
+package transport
+
+import (
+	"auth-service/internal/auth"
+	"auth-service/internal/cors"
+	"auth-service/internal/database"
+	"auth-service/internal/entities"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultTokenLifetimeDays = 90
+	maxTokenLifetimeDays     = 365
+)
+
+type CreatePersonalAccessTokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expiresInDays"`
+}
+
+func (res *Resourse) CreatePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	userId, _ := auth.UserIdFromContext(r.Context())
+
+	var reqBody CreatePersonalAccessTokenRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	reqBody.Name = strings.TrimSpace(reqBody.Name)
+
+	if reqBody.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+
+	if len(reqBody.Scopes) == 0 {
+		http.Error(w, "At least one scope is required", http.StatusBadRequest)
+		return
+	}
+
+	for _, scope := range reqBody.Scopes {
+		if !auth.IsTokenScope(scope) {
+			http.Error(w, "Unknown scope: "+scope, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if reqBody.ExpiresInDays == 0 {
+		reqBody.ExpiresInDays = defaultTokenLifetimeDays
+	}
+
+	if reqBody.ExpiresInDays < 0 || reqBody.ExpiresInDays > maxTokenLifetimeDays {
+		http.Error(w, "Expiry must be between 1 and 365 days", http.StatusBadRequest)
+		return
+	}
+
+	token, hash, err := auth.NewPersonalAccessToken()
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create personal access token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	expiresAt := time.Now().AddDate(0, 0, reqBody.ExpiresInDays)
+
+	pat := entities.PersonalAccessToken{
+		UserId:    userId,
+		Name:      reqBody.Name,
+		Token:     token,
+		Scopes:    reqBody.Scopes,
+		ExpiresAt: &expiresAt,
+		CreatedAt: time.Now(),
+	}
+
+	pat.Id, err = res.s.InsertPersonalAccessToken(pat, hash)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to save personal access token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// the token is only ever shown in this response
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(pat)
+}
+
+func (res *Resourse) GetPersonalAccessTokens(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	userId, _ := auth.UserIdFromContext(r.Context())
+
+	tokens, err := res.s.GetPersonalAccessTokens(userId)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get personal access tokens")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(tokens)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+func (res *Resourse) DeletePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	userId, _ := auth.UserIdFromContext(r.Context())
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to convert id to integer")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = res.s.DeletePersonalAccessToken(userId, id)
+
+	if err != nil {
+		if errors.Is(err, database.ErrTokenNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		log.Error().Err(err).Msg("Failed to delete personal access token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,28 +1,60 @@
 package transport
 
 import (
+	"auth-service/internal/accounts"
+	"auth-service/internal/audit"
 	"auth-service/internal/auth"
 	"auth-service/internal/cors"
 	"auth-service/internal/database"
 	"auth-service/internal/entities"
 	"auth-service/internal/keys"
+	"auth-service/internal/mail"
+	"auth-service/internal/oauth"
+	"auth-service/internal/oidc"
+	"auth-service/internal/ratelimit"
 	"auth-service/internal/storage"
 	"auth-service/pkg/cookie"
+	"auth-service/pkg/realip"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/rs/zerolog/log"
 )
 
 type Resourse struct {
-	s *database.PostgresStorage
+	s          *database.PostgresStorage
+	guard      *auth.LoginGuard
+	mailer     mail.Mailer
+	providers  map[string]*oidc.Provider
+	signer     *oauth.Signer
+	cookies    cookie.Attributes
+	cookieKeys *cookie.Keyring
+	limiter    *ratelimit.Limiter
+	webauthn   *auth.WebAuthn
+	audit      *audit.Recorder
+	reaper     *accounts.Reaper
 }
 
-func NewResourse(s *database.PostgresStorage) *Resourse {
-	return &Resourse{s: s}
+func NewResourse(s *database.PostgresStorage, mailer mail.Mailer, providers map[string]*oidc.Provider, signer *oauth.Signer, cookies cookie.Attributes, cookieKeys *cookie.Keyring, limiter *ratelimit.Limiter, webauthn *auth.WebAuthn, reaper *accounts.Reaper) *Resourse {
+	return &Resourse{
+		s:          s,
+		guard:      auth.NewLoginGuard(s, auth.DefaultLoginPolicy),
+		mailer:     mailer,
+		providers:  providers,
+		signer:     signer,
+		cookies:    cookies,
+		cookieKeys: cookieKeys,
+		limiter:    limiter,
+		webauthn:   webauthn,
+		audit:      audit.NewRecorder(s, keys.TRUST_PROXY),
+		reaper:     reaper,
+	}
 }
 
 type LoginRresponse struct {
@@ -54,36 +86,171 @@ func (res *Resourse) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userData, err := res.s.GetUserByUsername(usr.Username)
+	ip := realip.FromRequest(r, keys.TRUST_PROXY)
+
+	delay, retryAfter, err := res.guard.Check(usr.Username, ip)
 
 	if err != nil {
-		log.Error().Err(err).Msg("User not found")
-		w.WriteHeader(http.StatusBadRequest)
+		log.Error().Err(err).Msg("Failed to check login attempts")
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	if !auth.CheckPasswordHash(usr.Password, userData.Password) {
-		log.Error().Err(err).Msg("Invalid password")
-		w.WriteHeader(http.StatusBadRequest)
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		http.Error(w, "Too many login attempts", http.StatusTooManyRequests)
+		return
+	}
+
+	select {
+	case <-time.After(delay):
+	case <-r.Context().Done():
+		return
+	}
+
+	userData, err := res.s.GetUserByUsername(usr.Username)
+
+	if err != nil && !errors.Is(err, database.ErrUserNotFound) {
+		log.Error().Err(err).Msg("Failed to get user")
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	token, err := auth.CreateToken(usr.Username)
+	// unknown users and wrong passwords get the same answer after the same amount of work
+	var valid bool
+
+	if err == nil {
+		valid = auth.CheckPasswordHash(usr.Password, userData.Password)
+	} else {
+		auth.EqualizePasswordCheck(usr.Password)
+	}
+
+	if !valid {
+		log.Info().Str("username", usr.Username).Str("ip", ip).Msg("Failed login attempt")
+
+		if err := res.guard.Failed(usr.Username, ip); err != nil {
+			log.Error().Err(err).Msg("Failed to record login attempt")
+		}
+
+		// every attempt is recorded the same way, so the answer takes as long
+		// for unknown usernames as for real accounts. The caller isn't the
+		// account's owner, so there is no actor.
+		event := audit.Event{
+			Action:     audit.LoginFailed,
+			TargetType: audit.TargetUser,
+			After:      map[string]any{"username": truncate(usr.Username, maxAuditUsernameLength)},
+		}
+
+		if err == nil {
+			event.TargetId = userData.Id
+		}
+
+		res.audit.Record(r, event)
+
+		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		return
+	}
+
+	// the password is at hand only now, so hashes with outdated parameters are upgraded here
+	if auth.NeedsRehash(userData.Password) {
+		res.rehashPassword(userData.Id, usr.Password, userData.Password)
+	}
+
+	twoFactor, err := res.s.IsTOTPEnabled(userData.Id)
 
 	if err != nil {
-		http.Error(w, "Problem with generating a token", http.StatusInternalServerError)
+		log.Error().Err(err).Msg("Failed to check two-factor authentication")
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	tokenCookie := cookie.NewAccessTokenCookie(w, token)
+	// the cookie is only issued once the second factor checks out, and only
+	// then does the lockout counter start over
+	if twoFactor {
+		res.writeLoginChallenge(w, userData.Id)
+		return
+	}
+
+	if err := res.guard.Succeeded(usr.Username, ip); err != nil {
+		log.Error().Err(err).Msg("Failed to record login attempt")
+	}
+
+	userData.Password = ""
 
-	cookie.Write(w, tokenCookie)
+	err = res.issueAccessToken(w, r, userData.Id, userData.Username)
+
+	if err != nil {
+		signInFailed(w, err)
+		return
+	}
 
 	json.NewEncoder(w).Encode(LoginRresponse{
 		UserData: userData,
 	})
 }
 
+// rehashPassword replaces the stored hash with one made with the current
+// parameters. Failing isn't fatal, the old hash still works.
+func (res *Resourse) rehashPassword(userId int, password string, oldHash string) {
+	hash, err := auth.HashPassword(password)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to rehash user password")
+		return
+	}
+
+	if err := res.s.ReplacePasswordHash(userId, oldHash, hash); err != nil {
+		log.Error().Err(err).Msg("Failed to save rehashed password")
+	}
+}
+
+// signInFailed answers a failed issueAccessToken.
+func signInFailed(w http.ResponseWriter, err error) {
+	if errors.Is(err, database.ErrAccountSuspended) {
+		http.Error(w, "Account is suspended", http.StatusForbidden)
+		return
+	}
+
+	http.Error(w, "Problem with generating a token", http.StatusInternalServerError)
+}
+
+// issueAccessToken signs the user in: it records a session for the device
+// making the request and sets the access token cookie.
+func (res *Resourse) issueAccessToken(w http.ResponseWriter, r *http.Request, userId int, username string) error {
+	sessionId, err := res.s.InsertSession(entities.Session{
+		UserId:    userId,
+		UserAgent: r.UserAgent(),
+		Ip:        realip.FromRequest(r, keys.TRUST_PROXY),
+	}, auth.SessionTTL)
+
+	if err != nil {
+		return err
+	}
+
+	token, err := auth.CreateToken(userId, username, sessionId)
+
+	if err != nil {
+		return err
+	}
+
+	err = cookie.WriteEncrypted(w, cookie.NewAccessTokenCookie(res.cookies, token), res.cookieKeys)
+
+	if err != nil {
+		return err
+	}
+
+	// every way of signing in ends here, so this is where logins are audited
+	res.audit.Record(r, audit.Event{
+		ActorId:    userId,
+		Action:     audit.Login,
+		TargetType: audit.TargetUser,
+		TargetId:   userId,
+		After:      map[string]any{"sessionId": sessionId},
+	})
+
+	return nil
+}
+
 // users
 func (res *Resourse) GetUsers(w http.ResponseWriter, r *http.Request) {
 	cors.EnableCors(&w)
@@ -136,8 +303,17 @@ func (res *Resourse) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !res.checkPasswordPolicy(w, r, reqBody.Password, reqBody.Username, reqBody.Email) {
+		return
+	}
+
 	password, err := auth.HashPassword(reqBody.Password)
 
+	if errors.Is(err, auth.ErrPasswordTooLong) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to hash user password")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -160,19 +336,15 @@ func (res *Resourse) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := auth.CreateToken(reqBody.Username)
-
-	if err != nil {
-		http.Error(w, "Failed to create token", http.StatusInternalServerError)
-		return
+	// the account works without it, but some actions wait for a verified email
+	if err := res.sendVerificationEmail(r.Context(), id, reqBody.Email); err != nil {
+		log.Error().Err(err).Msg("Failed to send verification email")
 	}
 
-	tokenCookie := cookie.NewAccessTokenCookie(w, token)
-
-	err = cookie.Write(w, tokenCookie)
+	err = res.issueAccessToken(w, r, id, reqBody.Username)
 
 	if err != nil {
-		http.Error(w, "Failed to write cookie", http.StatusInternalServerError)
+		http.Error(w, "Failed to create token", http.StatusInternalServerError)
 		return
 	}
 
@@ -377,27 +549,6 @@ func (res *Resourse) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (res *Resourse) DeleteUser(w http.ResponseWriter, r *http.Request) {
-	cors.EnableCors(&w)
-
-	idVal := r.PathValue("id")
-	id, err := strconv.Atoi(idVal)
-
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to convert id to integer")
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
-
-	err = res.s.DeleteUser(id)
-
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to delete user")
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
-}
-
 //articles
 
 func (res *Resourse) GetArticles(w http.ResponseWriter, r *http.Request) {
@@ -415,13 +566,28 @@ func (res *Resourse) GetArticles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	articles, err := res.s.GetArticles("newest")
+	query := r.URL.Query()
+
+	sortBy := query.Get("sortBy")
+
+	if sortBy == "" {
+		sortBy = "newest"
+	}
+
+	articles, err := res.s.GetArticles(sortBy, query["tag"])
 
 	if err != nil {
+		if errors.Is(err, database.ErrInvalidTag) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		log.Error().Err(err).Msg("Failed to get articles")
 		return
 	}
 
+	articles = res.markBookmarked(r, articles)
+
 	err = json.NewEncoder(w).Encode(articles)
 
 	if err != nil {
@@ -455,13 +621,7 @@ func (res *Resourse) CreateArticle(w http.ResponseWriter, r *http.Request) {
 
 	title := r.FormValue("title")
 	text := r.FormValue("text")
-	userId, err := strconv.Atoi(r.FormValue("userId"))
-
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to conver string to int")
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
+	userId, _ := auth.UserIdFromContext(r.Context())
 
 	file, fileHeader, err := r.FormFile("coverUrl")
 
@@ -486,12 +646,19 @@ func (res *Resourse) CreateArticle(w http.ResponseWriter, r *http.Request) {
 		Text:     text,
 		AuthorId: userId,
 		CoverUrl: fileURL,
+		Tags:     parseTags(r.FormValue("tags")),
 	}
 
-	err = res.s.InsertArticle(article)
+	_, err = res.s.InsertArticle(article)
 
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to create article")
+
+		if errors.Is(err, database.ErrTooManyTags) || errors.Is(err, database.ErrInvalidTag) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
@@ -520,6 +687,8 @@ func (res *Resourse) GetArticleById(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	article = res.markBookmarked(r, []entities.Article{article})[0]
+
 	err = json.NewEncoder(w).Encode(article)
 
 	if err != nil {
@@ -550,6 +719,8 @@ func (res *Resourse) GetArticlesByAuthorId(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	articles = res.markBookmarked(r, articles)
+
 	err = json.NewEncoder(w).Encode(articles)
 
 	if err != nil {
@@ -578,6 +749,8 @@ func (res *Resourse) GetArticlesByCompanyId(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	articles = res.markBookmarked(r, articles)
+
 	err = json.NewEncoder(w).Encode(articles)
 
 	if err != nil {
@@ -587,21 +760,68 @@ func (res *Resourse) GetArticlesByCompanyId(w http.ResponseWriter, r *http.Reque
 	}
 }
 
-func (res *Resourse) UpdateArticle(w http.ResponseWriter, r *http.Request) {
-	cors.EnableCors(&w)
+// editableArticle loads the article in the path for a change by the caller,
+// who must be its author or an owner or admin of the company it was published
+// under. It writes the error response itself.
+func (res *Resourse) editableArticle(w http.ResponseWriter, r *http.Request) (entities.Article, bool) {
+	userId, _ := auth.UserIdFromContext(r.Context())
 
-	idVal := r.PathValue("id")
-	var reqBody entities.Article
-
-	id, err := strconv.Atoi(idVal)
+	id, err := strconv.Atoi(r.PathValue("id"))
 
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to convert id to integer")
+		w.WriteHeader(http.StatusBadRequest)
+		return entities.Article{}, false
+	}
+
+	article, err := res.s.GetArticleById(id)
+
+	if err != nil {
+		if errors.Is(err, database.ErrArticleNotFound) {
+			http.Error(w, "Article not found", http.StatusNotFound)
+			return entities.Article{}, false
+		}
+
+		log.Error().Err(err).Msg("Failed to get article")
 		w.WriteHeader(http.StatusInternalServerError)
+		return entities.Article{}, false
+	}
+
+	if article.AuthorId == userId {
+		return article, true
+	}
+
+	if article.CompanyId != 0 {
+		role, err := res.s.GetCompanyRole(userId, article.CompanyId)
+
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to get company role")
+			w.WriteHeader(http.StatusInternalServerError)
+			return entities.Article{}, false
+		}
+
+		if role == entities.CompanyRoleOwner || role == entities.CompanyRoleAdmin {
+			return article, true
+		}
+	}
+
+	http.Error(w, "Forbidden", http.StatusForbidden)
+	return entities.Article{}, false
+}
+
+func (res *Resourse) UpdateArticle(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	article, ok := res.editableArticle(w, r)
+
+	if !ok {
 		return
 	}
 
-	err = json.NewDecoder(r.Body).Decode(&reqBody)
+	id := article.Id
+	var reqBody entities.Article
+
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
 
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to decode")
@@ -609,10 +829,19 @@ func (res *Resourse) UpdateArticle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// authorship moves only through the admin API
+	reqBody.AuthorId = article.AuthorId
+
 	err = res.s.UpdateArticle(id, reqBody)
 
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to update article")
+
+		if errors.Is(err, database.ErrTooManyTags) || errors.Is(err, database.ErrInvalidTag) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
@@ -621,16 +850,13 @@ func (res *Resourse) UpdateArticle(w http.ResponseWriter, r *http.Request) {
 func (res *Resourse) DeleteArticle(w http.ResponseWriter, r *http.Request) {
 	cors.EnableCors(&w)
 
-	idVal := r.PathValue("id")
-	id, err := strconv.Atoi(idVal)
+	article, ok := res.editableArticle(w, r)
 
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to convert id to integer")
-		w.WriteHeader(http.StatusBadRequest)
+	if !ok {
 		return
 	}
 
-	err = res.s.DeleteArticle(id)
+	err := res.s.DeleteArticle(article.Id)
 
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to delete article")
@@ -684,13 +910,7 @@ func (res *Resourse) CreateCompany(w http.ResponseWriter, r *http.Request) {
 	description := r.FormValue("description")
 	position := r.FormValue("position")
 	website := r.FormValue("website")
-	userId, err := strconv.Atoi(r.FormValue("userId"))
-
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to conver string to int")
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
+	userId, _ := auth.UserIdFromContext(r.Context())
 
 	file, fileHeader, err := r.FormFile("logoUrl")
 
@@ -710,20 +930,12 @@ func (res *Resourse) CreateCompany(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	bytes := make([]byte, 20)
-
-	_, err = rand.Read(bytes)
+	secretKey, err := newCompanyKey()
 
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to read bytes")
 	}
 
-	secretKey := base64.URLEncoding.EncodeToString(bytes)
-
-	if len(secretKey) > 20 {
-		secretKey = secretKey[:20]
-	}
-
 	company := entities.Company{
 		Description: description,
 		Website:     website,
@@ -743,6 +955,55 @@ func (res *Resourse) CreateCompany(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusCreated)
 }
 
+// newCompanyKey makes the secret members use to join a company.
+func newCompanyKey() (string, error) {
+	bytes := make([]byte, 20)
+
+	_, err := rand.Read(bytes)
+
+	return base64.URLEncoding.EncodeToString(bytes)[:20], err
+}
+
+type CompanyKeyResponse struct {
+	Key string `json:"key"`
+}
+
+// RegenerateCompanyKey replaces the company's join key, so a leaked key stops
+// working. Members who already joined stay.
+func (res *Resourse) RegenerateCompanyKey(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	companyId, ok := res.requireCompanyAdmin(w, r)
+
+	if !ok {
+		return
+	}
+
+	key, err := newCompanyKey()
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to read bytes")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = res.s.UpdateCompanyKey(companyId, key)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to update company key")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.audit.Record(r, audit.Event{
+		Action:     audit.CompanyKeyRegenerated,
+		TargetType: audit.TargetCompany,
+		TargetId:   companyId,
+	})
+
+	json.NewEncoder(w).Encode(CompanyKeyResponse{Key: key})
+}
+
 func (res *Resourse) GetCompanyById(w http.ResponseWriter, r *http.Request) {
 	cors.EnableCors(&w)
 
@@ -774,7 +1035,6 @@ func (res *Resourse) GetCompanyById(w http.ResponseWriter, r *http.Request) {
 }
 
 type JoinCompanyRequest struct {
-	UserId   int    `json:"userId"`
 	Key      string `json:"key"`
 	Position string `json:"position"`
 }
@@ -794,6 +1054,9 @@ func (res *Resourse) JoinCompany(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// only the caller joins, the key doesn't let them move anyone else
+	userId, _ := auth.UserIdFromContext(r.Context())
+
 	var reqBody JoinCompanyRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
@@ -805,13 +1068,22 @@ func (res *Resourse) JoinCompany(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to get company by its key")
+		http.Error(w, "Invalid company key", http.StatusBadRequest)
+		return
 	}
 
-	if err := res.s.UpdateUserCompanyInfo(reqBody.UserId, company.Id, reqBody.Position); err != nil {
+	if err := res.s.UpdateUserCompanyInfo(userId, company.Id, reqBody.Position); err != nil {
 		http.Error(w, "Failed to update user", http.StatusInternalServerError)
 		return
 	}
 
+	res.audit.Record(r, audit.Event{
+		Action:     audit.CompanyJoined,
+		TargetType: audit.TargetCompany,
+		TargetId:   company.Id,
+		After:      map[string]any{"userId": userId, "position": reqBody.Position},
+	})
+
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -923,6 +1195,14 @@ func (res *Resourse) DeleteCompany(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	company, err := res.s.GetCompanyById(id)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get company by id")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
 	err = res.s.DeleteCompany(id)
 
 	if err != nil {
@@ -930,4 +1210,30 @@ func (res *Resourse) DeleteCompany(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+
+	// the join key is a secret, it stays out of the log
+	company.Key = ""
+
+	res.audit.Record(r, audit.Event{
+		Action:     audit.CompanyDeleted,
+		TargetType: audit.TargetCompany,
+		TargetId:   id,
+		Before:     company,
+	})
+}
+
+// the username of a failed login is whatever the caller typed
+const maxAuditUsernameLength = 64
+
+// truncate cuts s to at most n runes.
+func truncate(s string, n int) string {
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+
+		n--
+	}
+
+	return s
 }
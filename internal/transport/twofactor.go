@@ -0,0 +1,406 @@
+package transport
+
+import (
+	"auth-service/internal/audit"
+	"auth-service/internal/auth"
+	"auth-service/internal/cors"
+	"auth-service/internal/database"
+	"auth-service/internal/keys"
+	"auth-service/pkg/realip"
+	"auth-service/pkg/totp"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	loginChallengeTTL = 5 * time.Minute
+	totpIssuer        = "Auth Service"
+)
+
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	ChallengeToken    string `json:"challengeToken"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challengeToken"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recoveryCode"`
+}
+
+type TOTPEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type TOTPCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type PasswordConfirmationRequest struct {
+	Password string `json:"password"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// writeLoginChallenge answers the first step of a sign-in for a user with
+// 2FA enabled: no cookie yet, only a challenge to answer with a code.
+func (res *Resourse) writeLoginChallenge(w http.ResponseWriter, userId int) {
+	challenge, err := res.loginChallenge(userId)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create login challenge")
+		http.Error(w, "Problem with generating a token", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(TwoFactorChallengeResponse{
+		TwoFactorRequired: true,
+		ChallengeToken:    challenge,
+	})
+}
+
+// loginChallenge creates the token the second login step is made with.
+func (res *Resourse) loginChallenge(userId int) (string, error) {
+	challenge, id, err := auth.CreateLoginChallenge(userId, loginChallengeTTL)
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := res.s.InsertLoginChallenge(id, userId, loginChallengeTTL); err != nil {
+		return "", err
+	}
+
+	return challenge, nil
+}
+
+// LoginTwoFactor finishes a two-step login with a TOTP or recovery code.
+// Wrong codes count as failed logins, so the usual lockout applies, and a
+// challenge is good for a single attempt.
+func (res *Resourse) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	var reqBody TwoFactorLoginRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	challenge, err := auth.VerifyPurposeToken(reqBody.ChallengeToken, auth.PurposeLoginChallenge)
+
+	if err != nil {
+		http.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+		return
+	}
+
+	err = res.s.ConsumeLoginChallenge(challenge.ID, challenge.UserId)
+
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidLoginChallenge) {
+			http.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+			return
+		}
+
+		log.Error().Err(err).Msg("Failed to consume login challenge")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	user, err := res.s.GetUserById(challenge.UserId)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user by id")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	ip := realip.FromRequest(r, keys.TRUST_PROXY)
+
+	delay, retryAfter, err := res.guard.Check(user.Username, ip)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to check login attempts")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		http.Error(w, "Too many login attempts", http.StatusTooManyRequests)
+		return
+	}
+
+	select {
+	case <-time.After(delay):
+	case <-r.Context().Done():
+		return
+	}
+
+	valid, err := res.checkSecondFactor(user.Id, reqBody.Code, reqBody.RecoveryCode)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to check second factor")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !valid {
+		log.Info().Str("username", user.Username).Str("ip", ip).Msg("Failed two-factor attempt")
+
+		if err := res.guard.Failed(user.Username, ip); err != nil {
+			log.Error().Err(err).Msg("Failed to record login attempt")
+		}
+
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	if err := res.guard.Succeeded(user.Username, ip); err != nil {
+		log.Error().Err(err).Msg("Failed to record login attempt")
+	}
+
+	err = res.issueAccessToken(w, r, user.Id, user.Username)
+
+	if err != nil {
+		signInFailed(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(LoginRresponse{
+		UserData: user,
+	})
+}
+
+// checkSecondFactor accepts either a current TOTP code or an unused recovery code.
+func (res *Resourse) checkSecondFactor(userId int, code string, recoveryCode string) (bool, error) {
+	if recoveryCode != "" {
+		return res.s.UseRecoveryCode(userId, auth.HashRecoveryCode(recoveryCode))
+	}
+
+	secret, confirmed, err := res.s.GetTOTPSecret(userId)
+
+	if err != nil {
+		return false, err
+	}
+
+	if !confirmed {
+		return false, nil
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now())
+
+	if !ok {
+		return false, nil
+	}
+
+	return res.s.UseTOTPStep(userId, step)
+}
+
+// checkPassword compares the password with the caller's current one.
+func (res *Resourse) checkPassword(userId int, password string) (bool, error) {
+	current, err := res.s.GetUserPassword(userId)
+
+	if err != nil {
+		return false, err
+	}
+
+	return auth.CheckPasswordHash(password, current), nil
+}
+
+// EnrollTOTP starts setting up an authenticator app. 2FA stays off until the
+// first code is confirmed.
+func (res *Resourse) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	claims, _ := auth.ClaimsFromContext(r.Context())
+
+	secret, err := totp.GenerateSecret()
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to generate totp secret")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = res.s.SaveTOTPSecret(claims.UserId, secret)
+
+	if err != nil {
+		if errors.Is(err, database.ErrTOTPEnabled) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		log.Error().Err(err).Msg("Failed to save totp secret")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(TOTPEnrollmentResponse{
+		Secret: secret,
+		URI:    totp.URI(totpIssuer, claims.Username, secret),
+	})
+}
+
+// ConfirmTOTP turns 2FA on and returns the recovery codes, which are never shown again.
+func (res *Resourse) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	userId, _ := auth.UserIdFromContext(r.Context())
+
+	var reqBody TOTPCodeRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	secret, confirmed, err := res.s.GetTOTPSecret(userId)
+
+	if err != nil {
+		if errors.Is(err, database.ErrTOTPNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		log.Error().Err(err).Msg("Failed to get totp secret")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if confirmed {
+		http.Error(w, database.ErrTOTPEnabled.Error(), http.StatusConflict)
+		return
+	}
+
+	step, ok := totp.Validate(secret, reqBody.Code, time.Now())
+
+	if !ok {
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+
+	codes, hashes, err := auth.NewRecoveryCodes()
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create recovery codes")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = res.s.ConfirmTOTP(userId, step, hashes)
+
+	if err != nil {
+		if errors.Is(err, database.ErrTOTPEnabled) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		log.Error().Err(err).Msg("Failed to confirm totp")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func (res *Resourse) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	userId, _ := auth.UserIdFromContext(r.Context())
+
+	var reqBody PasswordConfirmationRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	valid, err := res.checkPassword(userId, reqBody.Password)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to check password")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !valid {
+		http.Error(w, "Password is incorrect", http.StatusForbidden)
+		return
+	}
+
+	err = res.s.DisableTOTP(userId)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to disable totp")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.audit.Record(r, audit.Event{
+		Action:     audit.TwoFactorDisabled,
+		TargetType: audit.TargetUser,
+		TargetId:   userId,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes invalidates the old recovery codes and returns new ones.
+func (res *Resourse) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	userId, _ := auth.UserIdFromContext(r.Context())
+
+	var reqBody PasswordConfirmationRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	valid, err := res.checkPassword(userId, reqBody.Password)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to check password")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !valid {
+		http.Error(w, "Password is incorrect", http.StatusForbidden)
+		return
+	}
+
+	codes, hashes, err := auth.NewRecoveryCodes()
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create recovery codes")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = res.s.RegenerateRecoveryCodes(userId, hashes)
+
+	if err != nil {
+		if errors.Is(err, database.ErrTOTPNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		log.Error().Err(err).Msg("Failed to regenerate recovery codes")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(RecoveryCodesResponse{RecoveryCodes: codes})
+}
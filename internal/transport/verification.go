@@ -0,0 +1,94 @@
+package transport
+
+import (
+	"auth-service/internal/auth"
+	"auth-service/internal/cors"
+	"auth-service/internal/database"
+	"auth-service/internal/keys"
+	"auth-service/internal/mail"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const verificationTokenTTL = 24 * time.Hour
+
+// sendVerificationEmail mails the user a signed link that confirms the address.
+func (res *Resourse) sendVerificationEmail(ctx context.Context, userId int, email string) error {
+	token, err := auth.CreatePurposeToken(auth.PurposeEmailVerification, userId, email, verificationTokenTTL)
+
+	if err != nil {
+		return err
+	}
+
+	link := keys.APP_BASE_URL + "/verify-email?token=" + url.QueryEscape(token)
+
+	return res.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Confirm your email address",
+		Text:    fmt.Sprintf("Open the link below to confirm your email address:\n\n%s\n\nThe link expires in 24 hours. If you didn't sign up, ignore this email.\n", link),
+	})
+}
+
+func (res *Resourse) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	claims, err := auth.VerifyPurposeToken(r.URL.Query().Get("token"), auth.PurposeEmailVerification)
+
+	if err != nil {
+		log.Info().Err(err).Msg("Invalid verification token")
+		http.Error(w, "Invalid or expired verification link", http.StatusBadRequest)
+		return
+	}
+
+	err = res.s.MarkEmailVerified(claims.UserId, claims.Email)
+
+	if err != nil {
+		if errors.Is(err, database.ErrUserNotFound) {
+			// the address was changed after the link was sent
+			http.Error(w, "Invalid or expired verification link", http.StatusBadRequest)
+			return
+		}
+
+		log.Error().Err(err).Msg("Failed to mark email verified")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email verified successfully"})
+}
+
+func (res *Resourse) ResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	userId, _ := auth.UserIdFromContext(r.Context())
+
+	user, err := res.s.GetUserById(userId)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user by id")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if user.EmailVerified {
+		http.Error(w, "Email is already verified", http.StatusConflict)
+		return
+	}
+
+	err = res.sendVerificationEmail(r.Context(), user.Id, user.Email)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to send verification email")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,371 @@
+package transport
+
+import (
+	"auth-service/internal/audit"
+	"auth-service/internal/auth"
+	"auth-service/internal/cors"
+	"auth-service/internal/database"
+	"auth-service/internal/entities"
+	"auth-service/internal/webhooks"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+)
+
+const webhookDeliveriesLimit = 100
+
+// requireCompanyAdmin checks that the caller is an owner or admin of the
+// company in the path. It writes the error response itself and returns the
+// company id when the caller may go on.
+func (res *Resourse) requireCompanyAdmin(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userId, _ := auth.UserIdFromContext(r.Context())
+
+	companyId, err := strconv.Atoi(r.PathValue("id"))
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to convert id to integer")
+		w.WriteHeader(http.StatusBadRequest)
+		return 0, false
+	}
+
+	role, err := res.s.GetCompanyRole(userId, companyId)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get company role")
+		w.WriteHeader(http.StatusInternalServerError)
+		return 0, false
+	}
+
+	if role != entities.CompanyRoleOwner && role != entities.CompanyRoleAdmin {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return 0, false
+	}
+
+	return companyId, true
+}
+
+type UpdateMemberRoleRequest struct {
+	Role string `json:"role"`
+}
+
+func (res *Resourse) UpdateMemberRole(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	userId, _ := auth.UserIdFromContext(r.Context())
+
+	companyId, err := strconv.Atoi(r.PathValue("id"))
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to convert id to integer")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	memberId, err := strconv.Atoi(r.PathValue("userId"))
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to convert user id to integer")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	role, err := res.s.GetCompanyRole(userId, companyId)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get company role")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// only the owner hands out admin rights
+	if role != entities.CompanyRoleOwner {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var reqBody UpdateMemberRoleRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if reqBody.Role != entities.CompanyRoleAdmin && reqBody.Role != entities.CompanyRoleMember {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	before, err := res.s.GetCompanyRole(memberId, companyId)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get company role")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = res.s.UpdateCompanyRole(memberId, companyId, reqBody.Role)
+
+	if err != nil {
+		if errors.Is(err, database.ErrMemberNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		log.Error().Err(err).Msg("Failed to update member role")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.audit.Record(r, audit.Event{
+		Action:     audit.MemberRoleChanged,
+		TargetType: audit.TargetCompany,
+		TargetId:   companyId,
+		Before:     map[string]any{"userId": memberId, "role": before},
+		After:      map[string]any{"userId": memberId, "role": reqBody.Role},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type CreateWebhookRequest struct {
+	Url        string   `json:"url"`
+	EventTypes []string `json:"eventTypes"`
+}
+
+func (res *Resourse) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	companyId, ok := res.requireCompanyAdmin(w, r)
+
+	if !ok {
+		return
+	}
+
+	var reqBody CreateWebhookRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	target, err := webhooks.ValidateURL(r.Context(), reqBody.Url)
+
+	if err != nil {
+		http.Error(w, "Invalid url: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(reqBody.EventTypes) == 0 {
+		http.Error(w, "At least one event type is required", http.StatusBadRequest)
+		return
+	}
+
+	for _, eventType := range reqBody.EventTypes {
+		if !webhooks.IsEventType(eventType) {
+			http.Error(w, "Unknown event type: "+eventType, http.StatusBadRequest)
+			return
+		}
+	}
+
+	bytes := make([]byte, 32)
+
+	_, err = rand.Read(bytes)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to read bytes")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	webhook := entities.Webhook{
+		CompanyId:  companyId,
+		Url:        target.String(),
+		Secret:     "whsec_" + hex.EncodeToString(bytes),
+		EventTypes: reqBody.EventTypes,
+		Active:     true,
+	}
+
+	webhook.Id, err = res.s.InsertWebhook(webhook)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create webhook")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// the secret is only ever shown in this response
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(webhook)
+}
+
+func (res *Resourse) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	companyId, ok := res.requireCompanyAdmin(w, r)
+
+	if !ok {
+		return
+	}
+
+	hooks, err := res.s.GetWebhooksByCompanyId(companyId)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get webhooks")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(hooks)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// companyWebhook loads the webhook in the path and checks it belongs to the company.
+func (res *Resourse) companyWebhook(w http.ResponseWriter, r *http.Request, companyId int) (entities.Webhook, bool) {
+	webhookId, err := strconv.Atoi(r.PathValue("webhookId"))
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to convert webhook id to integer")
+		w.WriteHeader(http.StatusBadRequest)
+		return entities.Webhook{}, false
+	}
+
+	webhook, err := res.s.GetWebhookById(webhookId)
+
+	if err != nil {
+		if errors.Is(err, database.ErrWebhookNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return entities.Webhook{}, false
+		}
+
+		log.Error().Err(err).Msg("Failed to get webhook")
+		w.WriteHeader(http.StatusInternalServerError)
+		return entities.Webhook{}, false
+	}
+
+	if webhook.CompanyId != companyId {
+		w.WriteHeader(http.StatusNotFound)
+		return entities.Webhook{}, false
+	}
+
+	return webhook, true
+}
+
+func (res *Resourse) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	companyId, ok := res.requireCompanyAdmin(w, r)
+
+	if !ok {
+		return
+	}
+
+	webhook, ok := res.companyWebhook(w, r, companyId)
+
+	if !ok {
+		return
+	}
+
+	err := res.s.DeleteWebhook(webhook.Id)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to delete webhook")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (res *Resourse) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	companyId, ok := res.requireCompanyAdmin(w, r)
+
+	if !ok {
+		return
+	}
+
+	webhook, ok := res.companyWebhook(w, r, companyId)
+
+	if !ok {
+		return
+	}
+
+	deliveries, err := res.s.GetWebhookDeliveries(webhook.Id, webhookDeliveriesLimit)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get webhook deliveries")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(deliveries)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+func (res *Resourse) RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	cors.EnableCors(&w)
+
+	companyId, ok := res.requireCompanyAdmin(w, r)
+
+	if !ok {
+		return
+	}
+
+	webhook, ok := res.companyWebhook(w, r, companyId)
+
+	if !ok {
+		return
+	}
+
+	deliveryId, err := strconv.ParseInt(r.PathValue("deliveryId"), 10, 64)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to convert delivery id to integer")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	delivery, err := res.s.GetWebhookDeliveryById(deliveryId)
+
+	if err != nil {
+		if errors.Is(err, database.ErrDeliveryNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		log.Error().Err(err).Msg("Failed to get webhook delivery")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if delivery.WebhookId != webhook.Id {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	err = res.s.RedeliverWebhook(delivery.Id)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to redeliver webhook")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
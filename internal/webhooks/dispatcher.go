@@ -0,0 +1,148 @@
+package webhooks
+
+import (
+	"auth-service/internal/entities"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	maxAttempts = 8
+	baseBackoff = 30 * time.Second
+	maxBackoff  = 6 * time.Hour
+
+	// a claimed delivery is retried after the lease if the worker dies mid-send
+	claimLease = 2 * time.Minute
+	batchSize  = 20
+)
+
+// Backoff returns the delay before the given retry: 30s, 1m, 2m, ... capped
+// at maxBackoff, with up to 10% jitter so failing endpoints aren't hit in lockstep.
+func Backoff(attempt int) time.Duration {
+	delay := maxBackoff
+
+	if attempt < 20 {
+		delay = min(baseBackoff<<(attempt-1), maxBackoff)
+	}
+
+	return delay + time.Duration(rand.Int64N(int64(delay/10)+1))
+}
+
+type Dispatcher struct {
+	store    Store
+	client   *http.Client
+	interval time.Duration
+}
+
+func NewDispatcher(store Store) *Dispatcher {
+	return &Dispatcher{
+		store:    store,
+		client:   newClient(),
+		interval: 5 * time.Second,
+	}
+}
+
+func (d *Dispatcher) Run(ctx context.Context) {
+	for {
+		deliveries, err := d.store.ClaimWebhookDeliveries(batchSize, claimLease)
+
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to claim webhook deliveries")
+		}
+
+		for _, delivery := range deliveries {
+			err := d.store.RecordWebhookAttempt(d.Deliver(ctx, delivery))
+
+			if err != nil {
+				log.Error().Err(err).Int64("delivery", delivery.Id).Msg("Failed to record webhook attempt")
+			}
+		}
+
+		if len(deliveries) == batchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(d.interval):
+		}
+	}
+}
+
+// Deliver sends the delivery once and returns it with the outcome of the attempt.
+func (d *Dispatcher) Deliver(ctx context.Context, delivery entities.WebhookDelivery) entities.WebhookDelivery {
+	delivery.Attempts++
+	delivery.ResponseCode = nil
+	delivery.LastError = ""
+
+	code, err := d.send(ctx, delivery)
+
+	if code != 0 {
+		delivery.ResponseCode = &code
+	}
+
+	now := time.Now().UTC()
+
+	switch {
+	case err == nil:
+		delivery.Status = entities.DeliverySucceeded
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= maxAttempts:
+		delivery.Status = entities.DeliveryFailed
+		delivery.LastError = err.Error()
+	default:
+		delivery.Status = entities.DeliveryPending
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = now.Add(Backoff(delivery.Attempts))
+	}
+
+	return delivery
+}
+
+func (d *Dispatcher) send(ctx context.Context, delivery entities.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Url, bytes.NewReader(delivery.Payload))
+
+	if err != nil {
+		return 0, fmt.Errorf("creating request: %v", err)
+	}
+
+	// webhooks registered before https was required
+	if req.URL.Scheme != "https" {
+		return 0, fmt.Errorf("webhook url must be an https url")
+	}
+
+	timestamp := time.Now().Unix()
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "auth-service-webhooks/1")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(delivery.Id, 10))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+
+	if err != nil {
+		return 0, fmt.Errorf("sending request: %v", err)
+	}
+
+	defer resp.Body.Close()
+
+	// drain a little of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,95 @@
+package webhooks
+
+import (
+	"auth-service/internal/entities"
+	"auth-service/internal/events"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// event types companies can subscribe to, keyed by the domain event behind them
+var eventTypes = map[string]string{
+	events.ArticlePublished: "article.created",
+	events.ArticleUpdated:   "article.updated",
+	events.ArticleDeleted:   "article.deleted",
+	events.MemberJoined:     "member.joined",
+}
+
+func IsEventType(eventType string) bool {
+	for _, t := range eventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+type Store interface {
+	EnqueueWebhookDeliveries(companyId int, eventType string, eventId int64, payload []byte) error
+	ClaimWebhookDeliveries(limit int, lease time.Duration) ([]entities.WebhookDelivery, error)
+	RecordWebhookAttempt(delivery entities.WebhookDelivery) error
+}
+
+// Envelope is the JSON body of every delivery.
+type Envelope struct {
+	Id        int64           `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Publisher turns domain events from the outbox into pending deliveries for
+// the webhooks of the company the event belongs to.
+type Publisher struct {
+	store Store
+}
+
+func NewPublisher(store Store) *Publisher {
+	return &Publisher{store: store}
+}
+
+func (p *Publisher) Publish(ctx context.Context, batch []events.Event) error {
+	for _, event := range batch {
+		eventType, ok := eventTypes[event.Type]
+
+		if !ok {
+			continue
+		}
+
+		var target struct {
+			CompanyId int `json:"companyId"`
+		}
+
+		err := json.Unmarshal(event.Payload, &target)
+
+		if err != nil {
+			return fmt.Errorf("decoding event %d: %v", event.Id, err)
+		}
+
+		if target.CompanyId == 0 {
+			continue
+		}
+
+		body, err := json.Marshal(Envelope{
+			Id:        event.Id,
+			Type:      eventType,
+			CreatedAt: event.CreatedAt,
+			Data:      event.Payload,
+		})
+
+		if err != nil {
+			return fmt.Errorf("encoding event %d: %v", event.Id, err)
+		}
+
+		err = p.store.EnqueueWebhookDeliveries(target.CompanyId, eventType, event.Id, body)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
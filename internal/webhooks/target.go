@@ -0,0 +1,106 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+var ErrForbiddenAddress = errors.New("webhook address is not publicly routable")
+
+// ranges IsPrivate and friends don't cover but that must not be reachable either
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// IsPublicAddr reports whether webhooks may be sent to the address: not
+// loopback, private, link-local (which covers the cloud metadata endpoint)
+// or otherwise reserved.
+func IsPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ValidateURL checks a webhook URL when it is registered: https only, and a
+// host that resolves to public addresses. The dispatcher checks the address
+// again on every connection, as DNS can change after this.
+func ValidateURL(ctx context.Context, raw string) (*url.URL, error) {
+	target, err := url.Parse(raw)
+
+	if err != nil || target.Scheme != "https" || target.Hostname() == "" || target.User != nil {
+		return nil, fmt.Errorf("webhook url must be an https url")
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", target.Hostname())
+
+	if err != nil {
+		return nil, fmt.Errorf("resolving webhook host: %v", err)
+	}
+
+	for _, addr := range addrs {
+		if !IsPublicAddr(addr) {
+			return nil, ErrForbiddenAddress
+		}
+	}
+
+	return target, nil
+}
+
+// newClient returns the client deliveries are sent with. It refuses to
+// connect to non-public addresses, ignores proxy settings, which would hide
+// the real destination, and doesn't follow redirects, which could point
+// anywhere.
+func newClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		// Control runs with the address actually dialed, after DNS resolution
+		Control: func(network, address string, c syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+
+			if err != nil {
+				return err
+			}
+
+			if !IsPublicAddr(addrPort.Addr()) {
+				return ErrForbiddenAddress
+			}
+
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConnsPerHost: 2,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
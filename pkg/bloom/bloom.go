@@ -0,0 +1,69 @@
+// Package bloom implements a bloom filter: a compact set that answers
+// "maybe present" or "definitely absent", for membership checks against
+// lists too large to keep in memory as is.
+package bloom
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+type Filter struct {
+	bits   []uint64
+	m      uint64
+	hashes uint64
+}
+
+// New sizes a filter for n items with the given false positive rate.
+func New(n int, falsePositiveRate float64) *Filter {
+	if n < 1 {
+		n = 1
+	}
+
+	m := math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	k := math.Max(1, math.Round(m/float64(n)*math.Ln2))
+
+	// the bits come in whole words, using all of them only lowers the rate,
+	// which matters for small filters where few bits collide a lot
+	words := (uint64(m) + 63) / 64
+
+	return &Filter{
+		bits:   make([]uint64, words),
+		m:      words * 64,
+		hashes: uint64(k),
+	}
+}
+
+// locations derives the item's bit positions from two halves of a single
+// hash (Kirsch and Mitzenmacher), which is as good as k independent hashes.
+func (f *Filter) locations(item string, visit func(uint64)) {
+	h := fnv.New64a()
+	h.Write([]byte(item))
+	sum := h.Sum64()
+
+	h1, h2 := sum&0xffffffff, sum>>32|1
+
+	for i := uint64(0); i < f.hashes; i++ {
+		visit((h1 + i*h2) % f.m)
+	}
+}
+
+func (f *Filter) Add(item string) {
+	f.locations(item, func(bit uint64) {
+		f.bits[bit/64] |= 1 << (bit % 64)
+	})
+}
+
+// Has reports whether the item may have been added. False positives happen
+// at about the rate the filter was sized for, false negatives never.
+func (f *Filter) Has(item string) bool {
+	found := true
+
+	f.locations(item, func(bit uint64) {
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			found = false
+		}
+	})
+
+	return found
+}
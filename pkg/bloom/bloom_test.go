@@ -0,0 +1,65 @@
+package bloom
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestFilterHasEveryAddedItem(t *testing.T) {
+	filter := New(1000, 0.01)
+
+	for i := 0; i < 1000; i++ {
+		filter.Add("added-" + strconv.Itoa(i))
+	}
+
+	for i := 0; i < 1000; i++ {
+		if item := "added-" + strconv.Itoa(i); !filter.Has(item) {
+			t.Fatalf("%q was added but is missing", item)
+		}
+	}
+}
+
+func TestFalsePositiveRate(t *testing.T) {
+	tests := []struct {
+		n    int
+		rate float64
+	}{
+		{n: 1000, rate: 0.1},
+		{n: 1000, rate: 0.01},
+		{n: 10000, rate: 0.001},
+		{n: 1, rate: 0.01},
+	}
+
+	const probes = 100000
+
+	for _, tt := range tests {
+		filter := New(tt.n, tt.rate)
+
+		for i := 0; i < tt.n; i++ {
+			filter.Add("added-" + strconv.Itoa(i))
+		}
+
+		falsePositives := 0
+
+		for i := 0; i < probes; i++ {
+			if filter.Has("absent-" + strconv.Itoa(i)) {
+				falsePositives++
+			}
+		}
+
+		// up to twice the target, to leave room for the randomness of the sample
+		if got := float64(falsePositives) / probes; got > 2*tt.rate {
+			t.Errorf("n=%d, rate %v: measured %v", tt.n, tt.rate, got)
+		}
+	}
+}
+
+func TestEmptyFilterHasNothing(t *testing.T) {
+	filter := New(0, 0.01)
+
+	for _, item := range []string{"", "a", "password"} {
+		if filter.Has(item) {
+			t.Errorf("empty filter has %q", item)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+// Package cbor decodes the subset of CBOR (RFC 8949) that WebAuthn uses for
+// attestation objects and COSE keys. Maps decode to map[any]any keyed by
+// int64 or string, integers to int64, byte strings to []byte and text to
+// string. Indefinite lengths and half precision floats are not supported.
+package cbor
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var ErrUnexpectedEnd = errors.New("cbor: unexpected end of data")
+
+// maxDepth bounds nesting, so a crafted input can't exhaust the stack
+const maxDepth = 16
+
+const (
+	majorUnsigned = iota
+	majorNegative
+	majorBytes
+	majorText
+	majorArray
+	majorMap
+	majorTag
+	majorSimple
+)
+
+// Decode decodes a single item that must span the whole input.
+func Decode(data []byte) (any, error) {
+	value, rest, err := DecodeFirst(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("cbor: %d trailing bytes", len(rest))
+	}
+
+	return value, nil
+}
+
+// DecodeFirst decodes the first item and returns the bytes after it.
+func DecodeFirst(data []byte) (any, []byte, error) {
+	d := decoder{data: data}
+
+	value, err := d.decode(0)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return value, d.data[d.pos:], nil
+}
+
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *decoder) take(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, ErrUnexpectedEnd
+	}
+
+	out := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+
+	return out, nil
+}
+
+// head reads the major type and its argument.
+func (d *decoder) head() (byte, uint64, error) {
+	b, err := d.take(1)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	major, info := b[0]>>5, b[0]&0x1f
+
+	if info < 24 {
+		return major, uint64(info), nil
+	}
+
+	var size uint64
+
+	switch info {
+	case 24:
+		size = 1
+	case 25:
+		size = 2
+	case 26:
+		size = 4
+	case 27:
+		size = 8
+	default:
+		return 0, 0, fmt.Errorf("cbor: unsupported additional info %d", info)
+	}
+
+	arg, err := d.take(size)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var value uint64
+
+	for _, b := range arg {
+		value = value<<8 | uint64(b)
+	}
+
+	return major, value, nil
+}
+
+func (d *decoder) decode(depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("cbor: nested too deep")
+	}
+
+	start := d.pos
+
+	major, arg, err := d.head()
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case majorUnsigned:
+		if arg > math.MaxInt64 {
+			return nil, fmt.Errorf("cbor: integer overflows int64")
+		}
+
+		return int64(arg), nil
+	case majorNegative:
+		if arg > math.MaxInt64 {
+			return nil, fmt.Errorf("cbor: integer overflows int64")
+		}
+
+		return -1 - int64(arg), nil
+	case majorBytes:
+		b, err := d.take(arg)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return append([]byte(nil), b...), nil
+	case majorText:
+		b, err := d.take(arg)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return string(b), nil
+	case majorArray:
+		// every item takes at least a byte, longer counts can't be valid
+		if arg > uint64(len(d.data)-d.pos) {
+			return nil, ErrUnexpectedEnd
+		}
+
+		items := make([]any, 0, arg)
+
+		for i := uint64(0); i < arg; i++ {
+			item, err := d.decode(depth + 1)
+
+			if err != nil {
+				return nil, err
+			}
+
+			items = append(items, item)
+		}
+
+		return items, nil
+	case majorMap:
+		if arg > uint64(len(d.data)-d.pos)/2 {
+			return nil, ErrUnexpectedEnd
+		}
+
+		entries := make(map[any]any, arg)
+
+		for i := uint64(0); i < arg; i++ {
+			key, err := d.decode(depth + 1)
+
+			if err != nil {
+				return nil, err
+			}
+
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, fmt.Errorf("cbor: unsupported map key type %T", key)
+			}
+
+			if _, ok := entries[key]; ok {
+				return nil, fmt.Errorf("cbor: duplicate map key %v", key)
+			}
+
+			value, err := d.decode(depth + 1)
+
+			if err != nil {
+				return nil, err
+			}
+
+			entries[key] = value
+		}
+
+		return entries, nil
+	case majorTag:
+		// tags only annotate the item, the value is all we need
+		return d.decode(depth + 1)
+	}
+
+	// major type 7, where the additional info picks the kind of value
+	switch d.data[start] & 0x1f {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 26:
+		return float64(math.Float32frombits(uint32(arg))), nil
+	case 27:
+		return math.Float64frombits(arg), nil
+	}
+
+	return nil, fmt.Errorf("cbor: unsupported simple value %d", d.data[start]&0x1f)
+}
@@ -0,0 +1,78 @@
+package cookie
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const hostPrefix = "__Host-"
+
+// Attributes are the security attributes shared by the session cookies.
+type Attributes struct {
+	HttpOnly bool
+	Secure   bool
+	SameSite http.SameSite
+	Domain   string
+	// HostPrefix adds the __Host- prefix to cookie names, which makes the
+	// browser refuse them unless they are Secure, host-only and on path "/".
+	HostPrefix bool
+}
+
+// DefaultAttributes are the attributes for production over HTTPS.
+var DefaultAttributes = Attributes{
+	HttpOnly: true,
+	Secure:   true,
+	SameSite: http.SameSiteLaxMode,
+}
+
+func (a Attributes) Validate() error {
+	if a.HostPrefix && (!a.Secure || a.Domain != "") {
+		return fmt.Errorf("the __Host- prefix needs Secure cookies without a Domain")
+	}
+
+	if a.SameSite == http.SameSiteNoneMode && !a.Secure {
+		return fmt.Errorf("SameSite=None needs Secure cookies")
+	}
+
+	return nil
+}
+
+// Name returns the name the cookie is stored under.
+func (a Attributes) Name(name string) string {
+	if a.HostPrefix {
+		return hostPrefix + name
+	}
+
+	return name
+}
+
+// New returns a cookie for the whole site with the attributes applied.
+func (a Attributes) New(name string, value string, maxAge time.Duration) http.Cookie {
+	return http.Cookie{
+		Name:     a.Name(name),
+		Value:    value,
+		Path:     "/",
+		Domain:   a.Domain,
+		Expires:  time.Now().Add(maxAge),
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: a.HttpOnly,
+		Secure:   a.Secure,
+		SameSite: a.SameSite,
+	}
+}
+
+// ParseSameSite reads "lax", "strict" or "none".
+func ParseSameSite(value string) (http.SameSite, error) {
+	switch strings.ToLower(value) {
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	}
+
+	return 0, fmt.Errorf("invalid SameSite value %q", value)
+}
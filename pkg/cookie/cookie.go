@@ -1,15 +1,10 @@
 package cookie
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
 	"encoding/base64"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
-	"strings"
 	"time"
 )
 
@@ -46,86 +41,38 @@ func Read(r *http.Request, name string) (string, error) {
 	return string(value), nil
 }
 
-func WriteEncrypted(w http.ResponseWriter, cookie http.Cookie, secretKey []byte) error {
-	block, err := aes.NewCipher(secretKey)
+// WriteEncrypted writes the cookie encrypted and authenticated with the
+// keyring's current key.
+func WriteEncrypted(w http.ResponseWriter, cookie http.Cookie, keys *Keyring) error {
+	sealed, err := keys.Seal(cookie.Name, []byte(cookie.Value))
 
 	if err != nil {
 		return err
 	}
 
-	aesGCM, err := cipher.NewGCM(block)
-
-	if err != nil {
-		return err
-	}
-
-	nonce := make([]byte, aesGCM.NonceSize())
-
-	_, err = io.ReadFull(rand.Reader, nonce)
-	if err != nil {
-		return err
-	}
-
-	plaintext := fmt.Sprintf("%s:%s", cookie.Name, cookie.Value)
-
-	encryptedValue := aesGCM.Seal(nonce, nonce, []byte(plaintext), nil)
-
-	cookie.Value = string(encryptedValue)
+	cookie.Value = string(sealed)
 
 	return Write(w, cookie)
 }
 
-func ReadEncrypted(r *http.Request, name string, secretKey []byte) (string, error) {
-	encryptedValue, err := Read(r, name)
-	if err != nil {
-		return "", err
-	}
+func ReadEncrypted(r *http.Request, name string, keys *Keyring) (string, error) {
+	sealed, err := Read(r, name)
 
-	block, err := aes.NewCipher(secretKey)
 	if err != nil {
 		return "", err
 	}
 
-	aesGCM, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", err
-	}
-
-	nonceSize := aesGCM.NonceSize()
-
-	if len(encryptedValue) < nonceSize {
-		return "", ErrInvalidValue
-	}
-
-	nonce := encryptedValue[:nonceSize]
-	ciphertext := encryptedValue[nonceSize:]
+	value, err := keys.Open(name, []byte(sealed))
 
-	plaintext, err := aesGCM.Open(nil, []byte(nonce), []byte(ciphertext), nil)
 	if err != nil {
-		return "", ErrInvalidValue
-	}
-
-	expectedName, value, ok := strings.Cut(string(plaintext), ":")
-	if !ok {
-		return "", ErrInvalidValue
-	}
-
-	if expectedName != name {
-		return "", ErrInvalidValue
+		return "", err
 	}
 
-	return value, nil
+	return string(value), nil
 }
 
-func NewAccessTokenCookie(w http.ResponseWriter, accessToken string) http.Cookie {
-	cookie := http.Cookie{
-		Name:     "accessToken",
-		Value:    accessToken,
-		Expires:  time.Now().Add(24 * time.Hour),
-		HttpOnly: false,
-		Secure:   false, //TODO - true on prod
-		Path:     "/",
-	}
+const AccessTokenName = "accessToken"
 
-	return cookie
+func NewAccessTokenCookie(attrs Attributes, accessToken string) http.Cookie {
+	return attrs.New(AccessTokenName, accessToken, 24*time.Hour)
 }
@@ -0,0 +1,140 @@
+package cookie
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// KeySize is the length of the AES-256 keys in a keyring.
+const KeySize = 32
+
+// key ids are a prefix of the key's hash, so they don't have to be configured
+const keyIdSize = 4
+
+type keyringKey struct {
+	id   []byte
+	aead cipher.AEAD
+}
+
+// Keyring encrypts cookies with its first key and decrypts them with any of
+// its keys. To rotate, put a new key first and keep the old one until the
+// cookies it encrypted have expired.
+type Keyring struct {
+	keys []keyringKey
+}
+
+func NewKeyring(keys ...[]byte) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("keyring needs at least one key")
+	}
+
+	keyring := &Keyring{}
+
+	for _, key := range keys {
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("cookie keys must be %d bytes, got %d", KeySize, len(key))
+		}
+
+		block, err := aes.NewCipher(key)
+
+		if err != nil {
+			return nil, err
+		}
+
+		aead, err := cipher.NewGCM(block)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sum := sha256.Sum256(key)
+
+		keyring.keys = append(keyring.keys, keyringKey{id: sum[:keyIdSize], aead: aead})
+	}
+
+	return keyring, nil
+}
+
+// ParseKeyring reads a comma separated list of base64 encoded keys, the
+// current key first.
+func ParseKeyring(value string) (*Keyring, error) {
+	var keys [][]byte
+
+	for _, encoded := range strings.Split(value, ",") {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+
+		if err != nil {
+			return nil, fmt.Errorf("decoding cookie key: %v", err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	return NewKeyring(keys...)
+}
+
+// GenerateKeyring returns a keyring with a single random key.
+func GenerateKeyring() (*Keyring, error) {
+	key := make([]byte, KeySize)
+
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	return NewKeyring(key)
+}
+
+// Seal encrypts the value as key id, nonce and ciphertext. The cookie name is
+// authenticated along with it, so a value can't be moved to another cookie.
+func (k *Keyring) Seal(name string, value []byte) ([]byte, error) {
+	key := k.keys[0]
+
+	out := make([]byte, 0, keyIdSize+key.aead.NonceSize()+len(value)+key.aead.Overhead())
+	out = append(out, key.id...)
+
+	nonce := make([]byte, key.aead.NonceSize())
+
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out = append(out, nonce...)
+
+	return key.aead.Seal(out, nonce, value, []byte(name)), nil
+}
+
+// Open decrypts a value sealed under the same cookie name by any key of the keyring.
+func (k *Keyring) Open(name string, sealed []byte) ([]byte, error) {
+	if len(sealed) < keyIdSize {
+		return nil, ErrInvalidValue
+	}
+
+	id, rest := sealed[:keyIdSize], sealed[keyIdSize:]
+
+	for _, key := range k.keys {
+		if string(key.id) != string(id) {
+			continue
+		}
+
+		if len(rest) < key.aead.NonceSize() {
+			return nil, ErrInvalidValue
+		}
+
+		nonce, ciphertext := rest[:key.aead.NonceSize()], rest[key.aead.NonceSize():]
+
+		plaintext, err := key.aead.Open(nil, nonce, ciphertext, []byte(name))
+
+		if err != nil {
+			return nil, ErrInvalidValue
+		}
+
+		return plaintext, nil
+	}
+
+	return nil, ErrInvalidValue
+}
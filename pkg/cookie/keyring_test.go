@@ -0,0 +1,160 @@
+package cookie
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func testKey(fill byte) []byte {
+	return bytes.Repeat([]byte{fill}, KeySize)
+}
+
+func testKeyring(t testing.TB, keys ...[]byte) *Keyring {
+	t.Helper()
+
+	keyring, err := NewKeyring(keys...)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return keyring
+}
+
+func TestKeyringRotation(t *testing.T) {
+	old := testKeyring(t, testKey(1))
+	rotated := testKeyring(t, testKey(2), testKey(1))
+
+	sealed, err := old.Seal("session", []byte("value"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value, err := rotated.Open("session", sealed); err != nil || string(value) != "value" {
+		t.Fatalf("rotated keyring can't open the old value: %q, %v", value, err)
+	}
+
+	sealed, err = rotated.Seal("session", []byte("value"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := old.Open("session", sealed); !errors.Is(err, ErrInvalidValue) {
+		t.Fatalf("old keyring opened a value sealed with the new key: %v", err)
+	}
+}
+
+func TestParseKeyring(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString(testKey(1)) + ", " + base64.StdEncoding.EncodeToString(testKey(2))
+
+	if _, err := ParseKeyring(encoded); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, value := range []string{"", "not base64", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err := ParseKeyring(value); err == nil {
+			t.Errorf("ParseKeyring(%q) accepted an invalid key", value)
+		}
+	}
+}
+
+func FuzzSealOpen(f *testing.F) {
+	f.Add("session", []byte("value"), 0)
+	f.Add("", []byte{}, 3)
+	f.Add("oidcState", bytes.Repeat([]byte{0xff}, 64), 40)
+
+	keyring := testKeyring(f, testKey(1), testKey(2))
+	other := testKeyring(f, testKey(3))
+
+	f.Fuzz(func(t *testing.T, name string, value []byte, flip int) {
+		sealed, err := keyring.Seal(name, value)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		opened, err := keyring.Open(name, sealed)
+
+		if err != nil || !bytes.Equal(opened, value) {
+			t.Fatalf("round trip gave %q, %v; want %q", opened, err, value)
+		}
+
+		if _, err := keyring.Open(name+"x", sealed); !errors.Is(err, ErrInvalidValue) {
+			t.Fatalf("opened under another cookie name: %v", err)
+		}
+
+		if _, err := other.Open(name, sealed); !errors.Is(err, ErrInvalidValue) {
+			t.Fatalf("opened with a key outside the keyring: %v", err)
+		}
+
+		if flip < 0 {
+			flip = -flip
+		}
+
+		tampered := bytes.Clone(sealed)
+		tampered[flip%len(tampered)] ^= 0x01
+
+		if _, err := keyring.Open(name, tampered); !errors.Is(err, ErrInvalidValue) {
+			t.Fatalf("opened a value with byte %d flipped: %v", flip%len(tampered), err)
+		}
+
+		if _, err := keyring.Open(name, sealed[:len(sealed)-1]); !errors.Is(err, ErrInvalidValue) {
+			t.Fatalf("opened a truncated value: %v", err)
+		}
+	})
+}
+
+func FuzzOpen(f *testing.F) {
+	keyring := testKeyring(f, testKey(1))
+
+	sealed, err := keyring.Seal("session", []byte("value"))
+
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	f.Add(sealed)
+	f.Add([]byte{})
+	f.Add(sealed[:keyIdSize])
+	f.Add(sealed[:keyIdSize+2])
+
+	f.Fuzz(func(t *testing.T, value []byte) {
+		opened, err := keyring.Open("session", value)
+
+		if err == nil && string(opened) != "value" {
+			t.Fatalf("opened a forged value as %q", opened)
+		}
+	})
+}
+
+func FuzzReadEncrypted(f *testing.F) {
+	keyring := testKeyring(f, testKey(1))
+
+	w := httptest.NewRecorder()
+
+	if err := WriteEncrypted(w, http.Cookie{Name: "session", Value: "session-value"}, keyring); err != nil {
+		f.Fatal(err)
+	}
+
+	f.Add(w.Result().Cookies()[0].Value)
+	f.Add("")
+	f.Add("====")
+	f.Add("c2Vzc2lvbi12YWx1ZQ==")
+
+	f.Fuzz(func(t *testing.T, raw string) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Cookie", "session="+raw)
+
+		value, err := ReadEncrypted(r, "session", keyring)
+
+		if err == nil && value != "session-value" {
+			t.Fatalf("read a forged cookie as %q", value)
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package realip
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// FromRequest returns the client IP of the request. X-Forwarded-For is only
+// honoured when the service runs behind a proxy that sets it, otherwise any
+// client could pick its own address. Proxies append the address they saw, so
+// only the last entry comes from the proxy; anything before it is whatever the
+// client sent.
+func FromRequest(r *http.Request, trustForwarded bool) string {
+	if trustForwarded {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			last := forwarded[len(forwarded)-1]
+
+			if i := strings.LastIndex(last, ","); i >= 0 {
+				last = last[i+1:]
+			}
+
+			if ip := net.ParseIP(strings.TrimSpace(last)); ip != nil {
+				return ip.String()
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
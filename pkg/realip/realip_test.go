@@ -0,0 +1,36 @@
+package realip
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFromRequest(t *testing.T) {
+	tests := []struct {
+		name      string
+		forwarded []string
+		trust     bool
+		want      string
+	}{
+		{name: "no proxy", want: "192.0.2.1"},
+		{name: "untrusted header", forwarded: []string{"203.0.113.9"}, want: "192.0.2.1"},
+		{name: "set by the proxy", forwarded: []string{"203.0.113.9"}, trust: true, want: "203.0.113.9"},
+		{name: "spoofed entries first", forwarded: []string{"10.0.0.1, 198.51.100.7, 203.0.113.9"}, trust: true, want: "203.0.113.9"},
+		{name: "spoofed header line first", forwarded: []string{"10.0.0.1", "203.0.113.9"}, trust: true, want: "203.0.113.9"},
+		{name: "ipv6", forwarded: []string{"2001:db8::1"}, trust: true, want: "2001:db8::1"},
+		{name: "garbage", forwarded: []string{"203.0.113.9, not-an-ip"}, trust: true, want: "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+
+		for _, value := range tt.forwarded {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+
+		if got := FromRequest(r, tt.trust); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
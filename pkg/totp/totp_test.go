@@ -0,0 +1,125 @@
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the RFC 6238 appendix B key, "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// RFC 6238 appendix B, SHA1, cut to the last 6 of the 8 digits listed there
+var rfcVectors = []struct {
+	unix int64
+	step int64
+	code string
+}{
+	{unix: 59, step: 0x1, code: "287082"},
+	{unix: 1111111109, step: 0x23523EC, code: "081804"},
+	{unix: 1111111111, step: 0x23523ED, code: "050471"},
+	{unix: 1234567890, step: 0x273EF07, code: "005924"},
+	{unix: 2000000000, step: 0x3F940AA, code: "279037"},
+	{unix: 20000000000, step: 0x27BC86AA, code: "353130"},
+}
+
+func TestCodeMatchesRFC6238(t *testing.T) {
+	for _, tt := range rfcVectors {
+		step := Step(time.Unix(tt.unix, 0))
+
+		if step != tt.step {
+			t.Errorf("%d: step %X, want %X", tt.unix, step, tt.step)
+		}
+
+		for _, secret := range []string{rfcSecret, strings.ToLower(rfcSecret)} {
+			code, err := Code(secret, step)
+
+			if err != nil || code != tt.code {
+				t.Errorf("%d: code %q, %v, want %q", tt.unix, code, err, tt.code)
+			}
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	code := func(step int64) string {
+		code, err := Code(rfcSecret, step)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return code
+	}
+
+	tests := []struct {
+		name string
+		code string
+		step int64
+		ok   bool
+	}{
+		{name: "current step", code: code(current), step: current, ok: true},
+		{name: "previous step", code: code(current - 1), step: current - 1, ok: true},
+		{name: "next step", code: code(current + 1), step: current + 1, ok: true},
+		{name: "spaced and padded", code: " " + code(current)[:3] + " " + code(current)[3:] + " ", step: current, ok: true},
+		{name: "two steps back", code: code(current - 2)},
+		{name: "two steps ahead", code: code(current + 2)},
+		{name: "too short", code: code(current)[:5]},
+		{name: "too long", code: code(current) + "0"},
+		{name: "empty"},
+	}
+
+	for _, tt := range tests {
+		step, ok := Validate(rfcSecret, tt.code, now)
+
+		if ok != tt.ok || step != tt.step {
+			t.Errorf("%s: got step %d, %v, want %d, %v", tt.name, step, ok, tt.step, tt.ok)
+		}
+	}
+
+	if _, ok := Validate("not base32!", "287082", time.Unix(59, 0)); ok {
+		t.Error("invalid secret validated")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := encoding.DecodeString(secret)
+
+	if err != nil || len(key) != 20 {
+		t.Fatalf("secret %q decodes to %d bytes, %v, want 20", secret, len(key), err)
+	}
+
+	if other, _ := GenerateSecret(); other == secret {
+		t.Fatal("two secrets alike")
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri, err := url.Parse(URI("Auth Service", "ada@example.com", rfcSecret))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Auth Service:ada@example.com" {
+		t.Errorf("label: got %s://%s%s", uri.Scheme, uri.Host, uri.Path)
+	}
+
+	want := map[string]string{"secret": rfcSecret, "issuer": "Auth Service", "algorithm": "SHA1", "digits": "6", "period": "30"}
+
+	for name, value := range want {
+		if got := uri.Query().Get(name); got != value {
+			t.Errorf("%s: got %q, want %q", name, got, value)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+// Package postgres carries the database schema, so binaries can apply it
+// without the file next to them.
+package postgres
+
+import _ "embed"
+
+// Schema creates every table that is missing. It is safe to run again.
+//
+//go:embed init.sql
+var Schema string